@@ -0,0 +1,89 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultAttributeTTL is how long attributes fetched from an AttributeProvider are
+// cached
+const DefaultAttributeTTL = time.Minute
+
+// AttributeProvider fetches external facts about a subject, such as its department,
+// for use by matchers
+type AttributeProvider func(ctx context.Context, sub string) (map[string]string, error)
+
+// attributeCache caches the attributes of each subject for ttl
+type attributeCache struct {
+	provider AttributeProvider
+	ttl      time.Duration
+	mutex    sync.Mutex
+	entries  map[string]attributeEntry
+}
+
+type attributeEntry struct {
+	attrs   map[string]string
+	expires time.Time
+}
+
+// WithAttributeProvider lets matchers consult the attributes of subjects through
+// Attributes, enabling models that mix roles with attribute checks. Attributes are
+// cached per subject for DefaultAttributeTTL, see WithAttributeTTL.
+func WithAttributeProvider(f AttributeProvider) Option {
+	return func(m *Manager) {
+		ttl := DefaultAttributeTTL
+		if m.attrs != nil {
+			ttl = m.attrs.ttl
+		}
+		m.attrs = &attributeCache{provider: f, ttl: ttl, entries: map[string]attributeEntry{}}
+	}
+}
+
+// WithAttributeTTL sets how long attributes are cached, zero disables caching. It must
+// be given after WithAttributeProvider.
+func WithAttributeTTL(ttl time.Duration) Option {
+	return func(m *Manager) {
+		if m.attrs != nil {
+			m.attrs.ttl = ttl
+		}
+	}
+}
+
+// Attributes returns the attributes of sub from the provider given to
+// WithAttributeProvider, or nil without a provider. Failed lookups aren't cached.
+func (m *Manager) Attributes(ctx context.Context, sub string) (map[string]string, error) {
+	c := m.attrs
+	if c == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	c.mutex.Lock()
+	e, ok := c.entries[sub]
+	c.mutex.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.attrs, nil
+	}
+	attrs, err := c.provider(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.Attributes: %w", err)
+	}
+	if c.ttl > 0 {
+		c.mutex.Lock()
+		c.entries[sub] = attributeEntry{attrs: attrs, expires: now.Add(c.ttl)}
+		c.mutex.Unlock()
+	}
+	return attrs, nil
+}
+
+// InvalidateAttributes drops the cached attributes of sub, e.g. after it changed
+// department
+func (m *Manager) InvalidateAttributes(sub string) {
+	if m.attrs == nil {
+		return
+	}
+	m.attrs.mutex.Lock()
+	delete(m.attrs.entries, sub)
+	m.attrs.mutex.Unlock()
+}
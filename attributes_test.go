@@ -0,0 +1,50 @@
+package tulip
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributes(t *testing.T) {
+	calls := 0
+	provider := func(ctx context.Context, sub string) (map[string]string, error) {
+		calls++
+		if sub == "nobody" {
+			return nil, errors.New("not found")
+		}
+		return map[string]string{"department": "physics"}, nil
+	}
+	// teachers may only teach classes of their own department
+	matcher := func(m *Manager, request ...string) bool {
+		attrs, err := m.Attributes(context.Background(), request[0])
+		if err != nil || attrs["department"] != request[4] {
+			return false
+		}
+		return RBACWithDomain(m, request[:4]...)
+	}
+	m := newManager(matcher, []Option{WithAttributeProvider(provider)})
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach", "physics"))
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach", "chemistry"))
+	assert.Equal(t, 1, calls)
+
+	m.InvalidateAttributes("alice")
+	_, err := m.Attributes(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	_, err = m.Attributes(context.Background(), "nobody")
+	assert.Error(t, err)
+	_, err = m.Attributes(context.Background(), "nobody")
+	assert.Error(t, err)
+	assert.Equal(t, 4, calls)
+
+	attrs, err := newManager(nil, nil).Attributes(context.Background(), "alice")
+	assert.NoError(t, err)
+	assert.Nil(t, attrs)
+}
@@ -0,0 +1,101 @@
+package tulip
+
+import (
+	"fmt"
+	"time"
+)
+
+// BundlePType is the policy type permission bundles are stored under
+const BundlePType = "b"
+
+// DefineBundle stores a named set of permissions, such as "project-viewer" allowing
+// "list" and "read" on "projects", as rules of type BundlePType of the form
+// (bundle, object, action). It returns the number of permissions added to the bundle.
+//
+// Bundles are assigned like roles, with grouping rules of the form
+// (subject, bundle, domain) where subject is a user or a role, see AssignBundle.
+// RBACWithDomain expands assigned bundles into their permissions.
+func (m *Manager) DefineBundle(name string, perms ...Permission) (int, error) {
+	inserted, err := m.addRules([]typedRules{{BundlePType, bundleRules(name, perms)}}, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.DefineBundle: %w", err)
+	}
+	return inserted, nil
+}
+
+// RemoveBundle removes all permissions of bundle name. Rules assigning it are kept.
+func (m *Manager) RemoveBundle(name string) error {
+	perms := m.Bundle(name)
+	if len(perms) == 0 {
+		return nil
+	}
+	if err := m.removeRules([]typedRules{{BundlePType, bundleRules(name, perms)}}); err != nil {
+		return fmt.Errorf("tulip.RemoveBundle: %w", err)
+	}
+	return nil
+}
+
+// Bundle returns the permissions of bundle name
+func (m *Manager) Bundle(name string) []Permission {
+	var res []Permission
+	for _, rule := range m.FilterType(BundlePType, m.Pseudonym(name)) {
+		res = append(res, Permission{Object: rule[1], Action: rule[2]})
+	}
+	return res
+}
+
+// AssignBundle assigns bundle to subject, a user or a role, in domain. It returns
+// false if the bundle is already assigned.
+func (m *Manager) AssignBundle(subject, bundle, domain string) (bool, error) {
+	inserted, err := m.AddPolicy("g", []string{subject, bundle, domain})
+	if err != nil {
+		return false, fmt.Errorf("tulip.AssignBundle: %w", err)
+	}
+	return inserted, nil
+}
+
+// UnassignBundle takes back a bundle assigned with AssignBundle
+func (m *Manager) UnassignBundle(subject, bundle, domain string) error {
+	if err := m.RemovePolicy("g", []string{subject, bundle, domain}); err != nil {
+		return fmt.Errorf("tulip.UnassignBundle: %w", err)
+	}
+	return nil
+}
+
+func bundleRules(name string, perms []Permission) [][]string {
+	rules := make([][]string, len(perms))
+	for i, p := range perms {
+		rules[i] = []string{name, p.Object, p.Action}
+	}
+	return rules
+}
+
+// hasBundles tells whether any bundle is cached
+func (m *Manager) hasBundles() bool {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
+	p := m.policySet(BundlePType, false)
+	return p != nil && len(*p) > 0
+}
+
+// findBundleGrant returns the bundle rule granting one of acts on obj, through a
+// bundle assigned in one of doms to subjects or to the roles they hold.
+func (m *Manager) findBundleGrant(subjects, doms []string, obj string, acts []string) []string {
+	names := append([]string(nil), subjects[1:]...)
+	for _, role := range subjects[1:] {
+		for _, d := range doms {
+			for _, g := range m.FilterGroups(role, "", d) {
+				names = append(names, g[1])
+			}
+		}
+	}
+	for _, name := range names {
+		for _, b := range m.FilterType(BundlePType, name) {
+			if containsString(acts, b[2]) && m.objectCovers(b[1], obj) {
+				return b
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestBundles(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("g", []string{"alice", "project-viewer", "acme"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "auditor", "acme"}, SourceLocal)
+	m.cacheInsert("g", []string{"auditor", "project-viewer", "acme"}, SourceLocal)
+	assert.False(t, m.Enforce("alice", "acme", "projects", "read"))
+
+	m.cacheInsert(BundlePType, []string{"project-viewer", "projects", "list"}, SourceLocal)
+	m.cacheInsert(BundlePType, []string{"project-viewer", "projects", "read"}, SourceLocal)
+	assert.Equal(t, []Permission{{"projects", "list"}, {"projects", "read"}}, m.Bundle("project-viewer"))
+	assert.True(t, m.Enforce("alice", "acme", "projects", "read"))
+	assert.True(t, m.Enforce("bob", "acme", "projects", "list"))
+	assert.False(t, m.Enforce("alice", "acme", "projects", "delete"))
+	assert.False(t, m.Enforce("alice", "globex", "projects", "read"))
+}
+
+func testBundles(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	n, err := m.DefineBundle("project-viewer", Permission{"projects", "list"}, Permission{"projects", "read"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = m.AssignBundle("alice", "project-viewer", "acme")
+	require.NoError(t, err)
+	assert.True(t, m.Enforce("alice", "acme", "projects", "read"))
+
+	require.NoError(t, m.RemoveBundle("project-viewer"))
+	assert.Nil(t, m.Bundle("project-viewer"))
+	assert.False(t, m.Enforce("alice", "acme", "projects", "read"))
+	require.NoError(t, m.UnassignBundle("alice", "project-viewer", "acme"))
+}
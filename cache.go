@@ -0,0 +1,174 @@
+package tulip
+
+import "sync"
+
+// ruleWidth is the number of values stored for every rule
+const ruleWidth = 6
+
+// padRule returns a copy of rule extended with empty values to ruleWidth, the shape
+// of rules kept in the cache.
+func padRule(rule []string) []string {
+	n := len(rule)
+	if n < ruleWidth {
+		n = ruleWidth
+	}
+	sl := make([]string, n)
+	copy(sl, rule)
+	return sl
+}
+
+// policySet returns the cached policies of type ptype. Sets for types other than "p"
+// and "g" are created on demand if create is true, otherwise nil is returned for them.
+// Caller must hold m.mutex.
+func (m *Manager) policySet(ptype string, create bool) *Policies {
+	switch ptype {
+	case "p":
+		return &m.p
+	case "g":
+		return &m.g
+	}
+	p, ok := m.extra[ptype]
+	if !ok && create {
+		// copy on write, the map is shared with views
+		extra := make(map[string]*Policies, len(m.extra)+1)
+		for k, v := range m.extra {
+			extra[k] = v
+		}
+		p = &Policies{}
+		extra[ptype] = p
+		m.extra = extra
+	}
+	return p
+}
+
+// cacheMutex returns the mutex guarding the cached rules of m, which lookups hold for
+// reading. Views share the rules of the manager they were made from, and its mutex.
+func (m *Manager) cacheMutex() *sync.RWMutex {
+	if m.origin != nil {
+		return &m.origin.mutex
+	}
+	return &m.mutex
+}
+
+// snapshot returns a copy of the cached rules of every type that has any, keyed by
+// type. Rules themselves are shared as they are never modified once cached.
+func (m *Manager) snapshot() map[string]Policies {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	res := map[string]Policies{}
+	if len(m.p) > 0 {
+		res["p"] = append(Policies(nil), m.p...)
+	}
+	if len(m.g) > 0 {
+		res["g"] = append(Policies(nil), m.g...)
+	}
+	for ptype, p := range m.extra {
+		if len(*p) > 0 {
+			res[ptype] = append(Policies(nil), *p...)
+		}
+	}
+	return res
+}
+
+// trimRule returns rule without its trailing empty values
+func trimRule(rule []string) []string {
+	n := len(rule)
+	for n > 0 && rule[n-1] == "" {
+		n--
+	}
+	return rule[:n]
+}
+
+// cachedCount returns the number of cached rules of all types. Caller must hold
+// m.mutex.
+func (m *Manager) cachedCount() int {
+	n := m.p.Len() + m.g.Len()
+	for _, p := range m.extra {
+		n += p.Len()
+	}
+	return n
+}
+
+// cacheInsert adds rule to the cached policies of type ptype unless that would exceed
+// the policy limit, and reports whether the cache changed. Caller must hold m.mutex.
+func (m *Manager) cacheInsert(ptype string, rule []string, source EventSource) bool {
+	if m.sqlOnly {
+		return false
+	}
+	// a rule added again without expiry is permanent
+	m.unexpire(ptype, rule)
+	p := m.policySet(ptype, true)
+	rule = padRule(rule)
+	if m.interner != nil {
+		m.interner.internRule(rule)
+	}
+	if m.maxPolicies > 0 && m.cachedCount() >= m.maxPolicies {
+		if p.Find(rule) == nil {
+			m.recordLimitExceeded(ptype, rule)
+		}
+		return false
+	}
+	if !p.Insert(rule) {
+		return false
+	}
+	if ptype == "p" && m.prefixIndex != nil {
+		m.prefixIndex.insert(rule)
+	}
+	m.emit(PolicyEvent{Op: EventInsert, PType: ptype, Rule: rule, Source: source})
+	return true
+}
+
+// cacheRemove removes rule from the cached policies of type ptype and reports whether
+// the cache changed. Caller must hold m.mutex.
+func (m *Manager) cacheRemove(ptype string, rule []string, source EventSource) bool {
+	m.unschedule(ptype, rule)
+	m.unexpire(ptype, rule)
+	p := m.policySet(ptype, false)
+	if p == nil {
+		return false
+	}
+	rule = padRule(rule)
+	if !p.Remove(rule) {
+		return false
+	}
+	if ptype == "p" && m.prefixIndex != nil {
+		m.prefixIndex.remove(rule)
+	}
+	m.emit(PolicyEvent{Op: EventRemove, PType: ptype, Rule: rule, Source: source})
+	return true
+}
+
+// replaceCache swaps the cached policies for freshly loaded ones, reporting rules
+// that changed as SourceRefresh events. Caller must hold m.mutex.
+func (m *Manager) replaceCache(p, g Policies, extra map[string]*Policies) (added, removed int) {
+	diff := func(ptype string, prev, next Policies) {
+		a, r := diffPolicies(prev, next)
+		added += len(a)
+		removed += len(r)
+		for _, rule := range r {
+			m.emit(PolicyEvent{Op: EventRemove, PType: ptype, Rule: rule, Source: SourceRefresh})
+		}
+		for _, rule := range a {
+			m.emit(PolicyEvent{Op: EventInsert, PType: ptype, Rule: rule, Source: SourceRefresh})
+		}
+	}
+	diff("p", m.p, p)
+	diff("g", m.g, g)
+	for ptype, set := range m.extra {
+		var next Policies
+		if s, ok := extra[ptype]; ok {
+			next = *s
+		}
+		diff(ptype, *set, next)
+	}
+	for ptype, set := range extra {
+		if _, ok := m.extra[ptype]; !ok {
+			diff(ptype, nil, *set)
+		}
+	}
+	m.p, m.g, m.extra = p, g, extra
+	if m.prefixIndex != nil {
+		m.prefixIndex = newPrefixIndex(m.prefixIndex.col, p)
+	}
+	return added, removed
+}
@@ -0,0 +1,123 @@
+package tulip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Codec transforms rule values on their way to and from the database. Lookups such as
+// QueryPolicies and RemoveFilteredPolicies compare encoded values in SQL, so Encode
+// must be deterministic: equal values must always encode to the same string.
+type Codec interface {
+	Encode(value string) (string, error)
+	Decode(value string) (string, error)
+}
+
+// WithCodec makes the manager encode the values v0..v5 of every rule it stores and
+// decode them when loading rules or receiving notifications, e.g. to encrypt them at
+// rest with the codec returned by NewAESCodec or one backed by a KMS. Rule types and
+// ids aren't encoded, ids are still computed from the plain values. The cache holds
+// plain values, so matchers are unaffected.
+func WithCodec(c Codec) Option {
+	return func(m *Manager) {
+		m.codec = c
+	}
+}
+
+// encodeValues returns a copy of values encoded with the codec, empty values are
+// left as is.
+func (m *Manager) encodeValues(values []string) ([]string, error) {
+	if m.codec == nil {
+		return values, nil
+	}
+	res := make([]string, len(values))
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+		enc, err := m.codec.Encode(v)
+		if err != nil {
+			return nil, fmt.Errorf("encoding rule value: %w", err)
+		}
+		res[i] = enc
+	}
+	return res, nil
+}
+
+// decodeValues decodes values in place, empty values are left as is
+func (m *Manager) decodeValues(values []string) error {
+	if m.codec == nil {
+		return nil
+	}
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+		dec, err := m.codec.Decode(v)
+		if err != nil {
+			return fmt.Errorf("decoding rule value: %w", err)
+		}
+		values[i] = dec
+	}
+	return nil
+}
+
+// aesCodec encrypts values with AES-GCM using a nonce derived from the value, which
+// makes the ciphertext deterministic as required by Codec.
+type aesCodec struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// NewAESCodec returns a Codec encrypting values with AES-256-GCM under keys derived
+// from key, which must be at least 16 bytes long. The nonce is an HMAC of the value,
+// so equal values have equal ciphertexts: this reveals which rules share a value but
+// nothing else. Encoded values are base64 strings.
+func NewAESCodec(key []byte) (Codec, error) {
+	if len(key) < 16 {
+		return nil, fmt.Errorf("tulip.NewAESCodec: key has %d bytes, at least 16 are required", len(key))
+	}
+	block, err := aes.NewCipher(deriveKey(key, "tulip:codec:encryption"))
+	if err != nil {
+		return nil, fmt.Errorf("tulip.NewAESCodec: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.NewAESCodec: %w", err)
+	}
+	return &aesCodec{aead: aead, nonceKey: deriveKey(key, "tulip:codec:nonce")}, nil
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func (c *aesCodec) Encode(value string) (string, error) {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+	return base64.RawStdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+func (c *aesCodec) Decode(value string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
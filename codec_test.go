@@ -0,0 +1,86 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAESCodec(t *testing.T) {
+	_, err := NewAESCodec([]byte("short"))
+	assert.Error(t, err)
+
+	c, err := NewAESCodec([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	enc, err := c.Encode("alice@example.com")
+	require.NoError(t, err)
+	assert.NotContains(t, enc, "alice")
+	again, err := c.Encode("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, enc, again)
+	dec, err := c.Decode(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", dec)
+
+	other, err := NewAESCodec([]byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	_, err = other.Decode(enc)
+	assert.Error(t, err)
+}
+
+func TestCodecPolicyArgs(t *testing.T) {
+	c, err := NewAESCodec([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	m := newManager(RBACWithDomain, []Option{WithCodec(c)})
+	rule := []string{"alice", "uni", "class_a", "teach"}
+	args, err := m.policyArgs("p", rule)
+	require.NoError(t, err)
+	assert.Equal(t, PolicyID("p", rule), args[0].(pgtype.Text).String)
+	enc, err := c.Encode("alice")
+	require.NoError(t, err)
+	assert.Equal(t, enc, args[2].(pgtype.Text).String)
+	assert.Equal(t, []string{"alice", "uni", "class_a", "teach"}, rule)
+}
+
+func testCodec(t *testing.T, connStr string, opts []Option) {
+	c, err := NewAESCodec([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithCodec(c),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	other, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer other.Close()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	waitForNotification(t, other, 1, 1)
+	assert.True(t, other.Enforce("aaron", "uni", "class_a", "teach"))
+
+	var raw string
+	require.NoError(t, m.pool.QueryRow(context.Background(),
+		"SELECT v0 FROM "+m.tableName+" WHERE p_type = 'g'",
+	).Scan(&raw))
+	assert.NotEqual(t, "aaron", raw)
+
+	groups, err := m.QueryGroupingPolicies(context.Background(), "aaron")
+	require.NoError(t, err)
+	assert.Equal(t, Policies{{"aaron", "teacher", "uni", "", "", ""}}, groups)
+
+	require.NoError(t, m.RemoveFilteredPolicies(nil, []string{"aaron"}))
+	assert.False(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+}
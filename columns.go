@@ -0,0 +1,103 @@
+package tulip
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Columns names the columns of the rule table, see WithColumns
+type Columns struct {
+	ID            string
+	PType         string
+	Values        [ruleWidth]string
+	EffectiveFrom string
+}
+
+// DefaultColumns are the names of the columns of tables created by tulip
+var DefaultColumns = Columns{
+	ID:            "id",
+	PType:         "p_type",
+	Values:        [ruleWidth]string{"v0", "v1", "v2", "v3", "v4", "v5"},
+	EffectiveFrom: "effective_from",
+}
+
+// WithColumns maps the columns of the rule table to custom names, so that an existing
+// permissions table can be used as is, typically along with WithSkipTableCreate.
+// Empty names keep their default from DefaultColumns. The table also needs a nullable
+// timestamptz column for EffectiveFrom, which NewManager adds unless the table
+// creation is skipped. Columns of the normalized schema can't be renamed.
+func WithColumns(cols Columns) Option {
+	return func(m *Manager) {
+		m.columns = cols
+	}
+}
+
+// columns holds the identifiers of the rule table columns, quoted as needed
+type columns struct {
+	id    string
+	ptype string
+	v     [ruleWidth]string
+	from  string
+}
+
+var plainIdentRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+func quoteIdent(name string) string {
+	if plainIdentRe.MatchString(name) {
+		return name
+	}
+	return pgx.Identifier{name}.Sanitize()
+}
+
+func newColumns(cols Columns) columns {
+	pick := func(name, def string) string {
+		if name == "" {
+			name = def
+		}
+		return quoteIdent(name)
+	}
+	c := columns{
+		id:    pick(cols.ID, DefaultColumns.ID),
+		ptype: pick(cols.PType, DefaultColumns.PType),
+		from:  pick(cols.EffectiveFrom, DefaultColumns.EffectiveFrom),
+	}
+	for i := range c.v {
+		c.v[i] = pick(cols.Values[i], DefaultColumns.Values[i])
+	}
+	return c
+}
+
+// values lists the value columns, each prefixed with qualifier if not empty
+func (c columns) values(qualifier string) string {
+	names := make([]string, len(c.v))
+	for i, v := range c.v {
+		names[i] = qualifier + v
+	}
+	return strings.Join(names, ", ")
+}
+
+// all lists every column in the order taken by the insert statement
+func (c columns) all() string {
+	return fmt.Sprintf("%s, %s, %s, %s", c.id, c.ptype, c.values(""), c.from)
+}
+
+// filterClause returns a WHERE condition matching rules of type ptype whose values
+// equal the non-empty values of pattern, along with its positional arguments.
+func (c columns) filterClause(ptype string, pattern []string) (string, []interface{}, error) {
+	if len(pattern) > ruleWidth {
+		return "", nil, fmt.Errorf("pattern has %d values, at most %d are supported", len(pattern), ruleWidth)
+	}
+	conds := []string{c.ptype + " = $1"}
+	args := []interface{}{ptype}
+	for i, s := range pattern {
+		if s == "" {
+			continue
+		}
+		args = append(args, s)
+		conds = append(conds, fmt.Sprintf("%s = $%d", c.v[i], len(args)))
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
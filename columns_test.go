@@ -0,0 +1,44 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testCustomColumns(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithColumns(Columns{
+			ID:     "rule_id",
+			PType:  "Kind",
+			Values: [ruleWidth]string{"subject", "domain", "object", "action"},
+		}),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}, {"teacher", "uni", "class_b", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+
+	other, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer other.Close()
+	assert.True(t, other.Enforce("aaron", "uni", "class_a", "teach"))
+
+	rules, err := m.QueryPolicies(context.Background(), "teacher", "", "class_b")
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	require.NoError(t, m.RemovePolicies([][]string{{"teacher", "uni", "class_a", "teach"}}, nil))
+	assert.False(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.True(t, m.Enforce("aaron", "uni", "class_b", "teach"))
+}
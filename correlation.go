@@ -0,0 +1,46 @@
+package tulip
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type correlationKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying id, which the manager adds as
+// field "correlation_id" to the log lines of calls made with the returned context, so
+// that they can be tied to the application request.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty string
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// WithCorrelationIDFunc sets how the manager gets the correlation ID of a context, e.g.
+// to use the trace ID of the current span. Defaults to CorrelationID.
+func WithCorrelationIDFunc(f func(ctx context.Context) string) Option {
+	return func(m *Manager) {
+		m.correlationID = f
+	}
+}
+
+// log returns the logger to use for a call made with ctx, which carries its
+// correlation ID if there is one. It returns nil without logger.
+func (m *Manager) log(ctx context.Context) *zap.Logger {
+	if m.logger == nil {
+		return nil
+	}
+	f := m.correlationID
+	if f == nil {
+		f = CorrelationID
+	}
+	if id := f(ctx); id != "" {
+		return m.logger.With(zap.String("correlation_id", id))
+	}
+	return m.logger
+}
@@ -0,0 +1,41 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCorrelationID(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	m := newManager(RBACWithDomain, []Option{WithZapLogger(zap.New(core))})
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+
+	ctx := ContextWithCorrelationID(context.Background(), "req-42")
+	assert.Equal(t, "req-42", CorrelationID(ctx))
+	assert.True(t, m.EnforceContext(ctx, "alice", "uni", "class_a", "teach"))
+	entries := logs.FilterMessage("enforced request").AllUntimed()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "req-42", fields["correlation_id"])
+	assert.Equal(t, true, fields["allowed"])
+
+	assert.False(t, m.Enforce("bob", "uni", "class_a", "teach"))
+	entries = logs.FilterMessage("enforced request").AllUntimed()
+	require.Len(t, entries, 2)
+	assert.NotContains(t, entries[1].ContextMap(), "correlation_id")
+
+	m = newManager(RBACWithDomain, []Option{
+		WithZapLogger(zap.New(core)),
+		WithCorrelationIDFunc(func(ctx context.Context) string { return "trace-1" }),
+	})
+	m.EnforceContext(context.Background(), "bob", "uni", "class_a", "teach")
+	entries = logs.FilterMessage("enforced request").AllUntimed()
+	require.Len(t, entries, 3)
+	assert.Equal(t, "trace-1", entries[2].ContextMap()["correlation_id"])
+}
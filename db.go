@@ -8,7 +8,11 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func connectDatabase(dbname string, arg interface{}) (*pgxpool.Pool, error) {
+// connConfigurer applies manager-level connection settings to a connection config
+// before it is used to open a connection.
+type connConfigurer func(ctx context.Context, cfg *pgx.ConnConfig) error
+
+func connectDatabase(ctx context.Context, dbname string, arg interface{}, configure connConfigurer) (*pgxpool.Pool, error) {
 	var cfg *pgx.ConnConfig
 	var err error
 	switch v := arg.(type) {
@@ -22,60 +26,66 @@ func connectDatabase(dbname string, arg interface{}) (*pgxpool.Pool, error) {
 	default:
 		return nil, fmt.Errorf("must pass in a PostgreS URL string or an instance of *pgx.ConnConfig, received %T instead", arg)
 	}
-	cfg.Database = dbname
-	pcfg, err := pgxpool.ParseConfig(cfg.ConnString())
-	if err != nil {
-		return nil, err
-	}
-	pcfg.ConnConfig.Database = dbname
-	return pgxpool.ConnectConfig(context.Background(), pcfg)
+	return connectPool(ctx, dbname, cfg.ConnString(), configure)
 }
 
-func createDatabase(dbname string, arg interface{}) (*pgxpool.Pool, error) {
-	var conn *pgx.Conn
+func createDatabase(ctx context.Context, dbname string, arg interface{}, configure connConfigurer) (*pgxpool.Pool, error) {
+	var cfg *pgx.ConnConfig
 	var err error
-	ctx := context.Background()
 	switch v := arg.(type) {
 	case string:
-		conn, err = pgx.Connect(ctx, v)
+		cfg, err = pgx.ParseConfig(v)
 		if err != nil {
 			return nil, err
 		}
 	case *pgx.ConnConfig:
-		conn, err = pgx.ConnectConfig(ctx, v)
-		if err != nil {
-			return nil, err
-		}
+		cfg = v.Copy()
 	default:
 		return nil, fmt.Errorf("must pass in a PostgreS URL string or an instance of *pgx.ConnConfig, received %T instead", arg)
 	}
+	if configure != nil {
+		if err := configure(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+	admin, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// closing the connection releases the lock taken below
+	defer admin.Close(ctx)
 
-	rows, err := conn.Query(ctx, "SELECT FROM pg_database WHERE datname = $1", dbname)
+	// CREATE DATABASE can't run in a transaction, hold a session lock instead so that
+	// concurrently starting instances don't both try to create the database
+	if _, err = admin.Exec(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey("db:"+dbname)); err != nil {
+		return nil, err
+	}
+	rows, err := admin.Query(ctx, "SELECT FROM pg_database WHERE datname = $1", dbname)
 	if err != nil {
 		return nil, err
 	}
 	createdb := !rows.Next()
 	rows.Close()
 
+	config := admin.Config()
+	config.Database = dbname
 	if createdb {
-		_, err = conn.Exec(ctx, "CREATE DATABASE "+dbname)
+		_, err = admin.Exec(ctx, "CREATE DATABASE "+dbname)
 		if err != nil {
 			return nil, err
 		}
-	}
-	if err := conn.Close(ctx); err != nil {
-		return nil, err
-	}
-
-	config := conn.Config()
-	config.Database = dbname
-	if createdb {
-		conn, err = pgx.ConnectConfig(ctx, config)
+		if configure != nil {
+			if err := configure(ctx, config); err != nil {
+				return nil, err
+			}
+		}
+		conn, err := pgx.ConnectConfig(ctx, config)
 		if err != nil {
 			return nil, err
 		}
 		_, err = conn.Exec(ctx, "create domain uint64 as numeric(20,0)")
 		if err != nil {
+			conn.Close(ctx)
 			return nil, err
 		}
 		if err := conn.Close(ctx); err != nil {
@@ -83,10 +93,23 @@ func createDatabase(dbname string, arg interface{}) (*pgxpool.Pool, error) {
 		}
 	}
 
-	cfg, err := pgxpool.ParseConfig(config.ConnString())
+	return connectPool(ctx, dbname, config.ConnString(), configure)
+}
+
+// connectPool opens a pool against database dbname. Settings that can't be expressed
+// in connString (such as a TLS config) are reapplied through configure, which also runs
+// before each new pool connection so that rotating credentials are picked up.
+func connectPool(ctx context.Context, dbname, connString string, configure connConfigurer) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, err
 	}
 	cfg.ConnConfig.Database = dbname
+	if configure != nil {
+		if err := configure(ctx, cfg.ConnConfig); err != nil {
+			return nil, err
+		}
+		cfg.BeforeConnect = configure
+	}
 	return pgxpool.ConnectConfig(ctx, cfg)
 }
@@ -0,0 +1,49 @@
+package tulip
+
+import "fmt"
+
+// PlannedChange is the outcome of a change checked by DryRun
+type PlannedChange struct {
+	Change
+	// ID is the id of the row of the rule, see WithIDFunc
+	ID string
+	// Applied tells whether the change would alter the stored rules. It is false when
+	// adding a rule that is already stored or removing one that isn't, including
+	// because of an earlier change of the same dry run.
+	Applied bool
+	// Err is the error the change would be rejected with, such as ErrInvalidRule
+	Err error
+}
+
+// DryRun checks changes as if they were made in order, without touching the database
+// or the cache, to review them before making them. An update is a removal followed
+// by an insertion, and rules read with ImportIAMPolicy or ImportKubernetesRBAC can be
+// checked as insertions. Rules are checked against the cached rules, as with Simulate.
+// DryRun only returns an error if the manager can't accept mutations at all, such as
+// ErrReadOnly.
+func (m *Manager) DryRun(changes []Change) ([]PlannedChange, error) {
+	if err := m.checkWritable(); err != nil {
+		return nil, fmt.Errorf("tulip.DryRun: %w", err)
+	}
+	view := m.sandbox()
+	res := make([]PlannedChange, len(changes))
+	for i, c := range changes {
+		res[i].Change = c
+		if c.Op == EventInsert {
+			if err := m.ValidateRule(c.PType, c.Rule); err != nil {
+				res[i].Err = err
+				continue
+			}
+		}
+		rule := m.pseudonymizeRule(c.PType, c.Rule)
+		res[i].ID = m.idFunc(c.PType, rule)
+		p := view.policySet(c.PType, true)
+		switch c.Op {
+		case EventInsert:
+			res[i].Applied = p.Insert(padRule(rule))
+		case EventRemove:
+			res[i].Applied = p.Remove(padRule(rule))
+		}
+	}
+	return res, nil
+}
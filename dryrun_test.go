@@ -0,0 +1,43 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{
+		WithValidation(ValidationConfig{Arity: map[string]int{"p": 4, "g": 3}}),
+	})
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+
+	res, err := m.DryRun([]Change{
+		{Op: EventInsert, PType: "g", Rule: []string{"bob", "teacher", "uni"}},
+		{Op: EventInsert, PType: "g", Rule: []string{"alice", "teacher", "uni"}},
+		{Op: EventRemove, PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}},
+		{Op: EventInsert, PType: "p", Rule: []string{"teacher", "uni", "class_a", "grade"}},
+		{Op: EventRemove, PType: "g", Rule: []string{"carol", "teacher", "uni"}},
+		{Op: EventInsert, PType: "g", Rule: []string{"bob", "teacher", "uni"}},
+		{Op: EventInsert, PType: "p", Rule: []string{"teacher", "uni", "class_a"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 7)
+	for i, applied := range []bool{true, false, true, true, false, false, false} {
+		assert.Equal(t, applied, res[i].Applied, i)
+	}
+	assert.Equal(t, PolicyID("g", []string{"bob", "teacher", "uni"}), res[0].ID)
+	assert.NoError(t, res[1].Err)
+	assert.ErrorIs(t, res[6].Err, ErrInvalidRule)
+	assert.Empty(t, res[6].ID)
+
+	// nothing was changed
+	assert.Equal(t, 1, m.PolicyCount())
+	assert.Equal(t, 1, m.GroupingPolicyCount())
+	assert.False(t, m.HasRole("bob", "teacher", "uni"))
+
+	_, err = NewStaticEnforcer(nil, nil, RBACWithDomain).DryRun(nil)
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,59 @@
+package tulip
+
+import "context"
+
+// Enforcer evaluates requests against a set of policies
+type Enforcer interface {
+	Enforce(request ...string) bool
+	FindExact(rule ...string) []string
+	Filter(rule ...string) Policies
+	FilterGroups(rule ...string) Policies
+}
+
+// matcherView is an Enforcer evaluating requests against the rules of a manager with
+// a different matcher
+type matcherView struct {
+	m       *Manager
+	matcher Matcher
+}
+
+// WithMatcher returns an Enforcer sharing the connections, cache and listener of m but
+// evaluating requests with matcher, e.g. to serve a strict and a permissive model over
+// the same rules. It costs nothing to create and stays in sync with m until m is
+// closed.
+func (m *Manager) WithMatcher(matcher Matcher) Enforcer {
+	return &matcherView{m: m, matcher: matcher}
+}
+
+func (v *matcherView) Enforce(request ...string) bool {
+	return v.m.enforce(context.Background(), "view", v.matcher, request)
+}
+
+func (v *matcherView) FindExact(rule ...string) []string {
+	return v.m.FindExact(rule...)
+}
+
+func (v *matcherView) Filter(rule ...string) Policies {
+	return v.m.Filter(rule...)
+}
+
+func (v *matcherView) FilterGroups(rule ...string) Policies {
+	return v.m.FilterGroups(rule...)
+}
+
+// NewStaticEnforcer returns a manager holding policies p and grouping policies g in
+// memory only, to unit test matchers without a database. Like other managers it
+// supports Enforce, Filter, FindExact and the rest of the lookup functions, while
+// functions that need the database return ErrClosed. Options configuring evaluation,
+// such as WithDomainHierarchy, apply as usual.
+func NewStaticEnforcer(p, g Policies, matcher Matcher, opts ...Option) *Manager {
+	m := newManager(matcher, opts)
+	for _, rule := range p {
+		m.cacheInsert("p", m.pseudonymizeRule("p", rule), SourceLocal)
+	}
+	for _, rule := range g {
+		m.cacheInsert("g", m.pseudonymizeRule("g", rule), SourceLocal)
+	}
+	m.closed = 1
+	return m
+}
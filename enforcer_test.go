@@ -0,0 +1,43 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMatcher(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	strict := m.WithMatcher(func(m *Manager, request ...string) bool {
+		return m.FindExact(request...) != nil
+	})
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.False(t, strict.Enforce("alice", "uni", "class_a", "teach"))
+	assert.True(t, strict.Enforce("teacher", "uni", "class_a", "teach"))
+	assert.Equal(t, m.FilterGroups("alice"), strict.FilterGroups("alice"))
+
+	// the view keeps up with the cache
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+	assert.True(t, strict.Enforce("alice", "uni", "class_a", "teach"))
+}
+
+func TestNewStaticEnforcer(t *testing.T) {
+	e := NewStaticEnforcer(
+		Policies{{"teacher", "uni/cs", "class_a", "teach"}},
+		Policies{{"alice", "teacher", "uni"}},
+		RBACWithDomain,
+		WithDomainHierarchy("/"),
+	)
+	assert.True(t, e.Enforce("alice", "uni/cs", "class_a", "teach"))
+	assert.True(t, e.Enforce("teacher", "uni/cs/ai", "class_a", "teach"))
+	assert.False(t, e.Enforce("alice", "uni", "class_a", "teach"))
+	assert.NotNil(t, e.FindExact("teacher", "uni/cs", "class_a", "teach"))
+	assert.Len(t, e.FilterGroups("alice"), 1)
+
+	_, err := e.AddPolicy("p", []string{"alice", "uni/cs", "class_a", "teach"})
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.NoError(t, e.Close())
+}
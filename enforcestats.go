@@ -0,0 +1,178 @@
+package tulip
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OtherKey is the key under which WithEnforceStats counts the requests of domains and
+// subjects beyond its limit
+const OtherKey = "_other"
+
+// EnforceCount counts the decisions made for a domain or a subject
+type EnforceCount struct {
+	Allowed int64
+	Denied  int64
+}
+
+// Total returns the number of requests counted
+func (c EnforceCount) Total() int64 {
+	return c.Allowed + c.Denied
+}
+
+// AllowRatio returns the share of requests that were allowed, or 0 if there were none
+func (c EnforceCount) AllowRatio() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+	return float64(c.Allowed) / float64(c.Total())
+}
+
+// enforceStats counts decisions by domain and subject
+type enforceStats struct {
+	mutex     sync.Mutex
+	maxKeys   int
+	subIndex  int
+	domIndex  int
+	byDomain  map[string]*EnforceCount
+	bySubject map[string]*EnforceCount
+	labels    map[string][2]Labels
+}
+
+// WithEnforceStats counts allowed and denied requests by domain and by subject, as
+// reported by Stats, and by domain with MetricEnforceTotal, to see which tenants drive
+// the load. The values are read from the "dom" and "sub" fields of the request, at the
+// positions of the fields of "p", see WithFields. Subjects are counted by pseudonym
+// with WithPseudonymizedSubjects. To bound memory and metric cardinality, at most maxKeys
+// domains and maxKeys subjects are counted individually, the first ones seen; the
+// requests of the others are counted under OtherKey. Combine with WithUsageTracking
+// and HotPolicies to see which rules are used the most.
+func WithEnforceStats(maxKeys int) Option {
+	return func(m *Manager) {
+		m.enforceStats = &enforceStats{
+			maxKeys:   maxKeys,
+			byDomain:  map[string]*EnforceCount{},
+			bySubject: map[string]*EnforceCount{},
+			labels:    map[string][2]Labels{},
+		}
+	}
+}
+
+// fieldIndex returns the position of field name in the rules of "p", or -1
+func (m *Manager) fieldIndex(name string) int {
+	for i, s := range m.Fields("p") {
+		if s == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// count increments the count of key in counts, or of OtherKey when there are too many
+// keys. It returns the key counted. Caller must hold s.mutex.
+func (s *enforceStats) count(counts map[string]*EnforceCount, key string, allowed bool) string {
+	c, ok := counts[key]
+	if !ok {
+		if len(counts) >= s.maxKeys {
+			key = OtherKey
+			if c, ok = counts[key]; !ok {
+				c = &EnforceCount{}
+				counts[key] = c
+			}
+		} else {
+			c = &EnforceCount{}
+			counts[key] = c
+		}
+	}
+	if allowed {
+		c.Allowed++
+	} else {
+		c.Denied++
+	}
+	return key
+}
+
+// recordDecision counts the decision made for request
+func (m *Manager) recordDecision(request []string, allowed bool) {
+	s := m.enforceStats
+	if s == nil {
+		return
+	}
+	var dom, sub string
+	if s.domIndex >= 0 && s.domIndex < len(request) {
+		dom = request[s.domIndex]
+	}
+	if s.subIndex >= 0 && s.subIndex < len(request) {
+		sub = request[s.subIndex]
+	}
+	s.mutex.Lock()
+	dom = s.count(s.byDomain, dom, allowed)
+	s.count(s.bySubject, sub, allowed)
+	labels, ok := s.labels[dom]
+	if !ok && m.metrics != nil {
+		// allocated once per domain as they are used on every request
+		labels = [2]Labels{
+			{"domain": dom, "decision": "deny"},
+			{"domain": dom, "decision": "allow"},
+		}
+		s.labels[dom] = labels
+	}
+	s.mutex.Unlock()
+	if m.metrics != nil {
+		if allowed {
+			m.metrics.Inc(MetricEnforceTotal, labels[1])
+		} else {
+			m.metrics.Inc(MetricEnforceTotal, labels[0])
+		}
+	}
+}
+
+// snapshot copies the counts into res
+func (s *enforceStats) snapshot(res *Stats) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res.EnforceByDomain = make(map[string]EnforceCount, len(s.byDomain))
+	for k, c := range s.byDomain {
+		res.EnforceByDomain[k] = *c
+	}
+	res.EnforceBySubject = make(map[string]EnforceCount, len(s.bySubject))
+	for k, c := range s.bySubject {
+		res.EnforceBySubject[k] = *c
+	}
+}
+
+// PolicyHits is the number of times a rule granted access, see HotPolicies
+type PolicyHits struct {
+	PType string
+	Rule  []string
+	Hits  int64
+}
+
+// HotPolicies returns the n rules that granted access the most times, most used first.
+// It requires WithUsageTracking and returns nil without it.
+func (m *Manager) HotPolicies(n int) []PolicyHits {
+	if m.usage == nil {
+		return nil
+	}
+	m.usage.mutex.Lock()
+	res := make([]PolicyHits, 0, len(m.usage.hits))
+	for key, hits := range m.usage.hits {
+		values := strings.Split(key, "\x00")
+		res = append(res, PolicyHits{PType: values[0], Rule: trimRule(values[1:]), Hits: hits})
+	}
+	m.usage.mutex.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Hits != res[j].Hits {
+			return res[i].Hits > res[j].Hits
+		}
+		if res[i].PType != res[j].PType {
+			return res[i].PType < res[j].PType
+		}
+		return compareRules(res[i].Rule, res[j].Rule) < 0
+	})
+	if n >= 0 && n < len(res) {
+		res = res[:n]
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceStats(t *testing.T) {
+	assert.Nil(t, newManager(RBACWithDomain, nil).Stats().EnforceByDomain)
+
+	metrics := newTestMetrics()
+	m := newManager(RBACWithDomain, []Option{WithEnforceStats(2), WithMetricsCollector(metrics)})
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("alice", "uni", "class_b", "teach"))
+	assert.False(t, m.Enforce("bob", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("alice", "school", "class_a", "teach"))
+	assert.False(t, m.Enforce("carol", "college", "class_a", "teach"))
+
+	stats := m.Stats()
+	assert.Equal(t, map[string]EnforceCount{
+		"uni":    {Allowed: 1, Denied: 2},
+		"school": {Denied: 1},
+		OtherKey: {Denied: 1},
+	}, stats.EnforceByDomain)
+	assert.Equal(t, map[string]EnforceCount{
+		"alice":  {Allowed: 1, Denied: 2},
+		"bob":    {Denied: 1},
+		OtherKey: {Denied: 1},
+	}, stats.EnforceBySubject)
+	assert.InDelta(t, 1.0/3, stats.EnforceByDomain["uni"].AllowRatio(), 1e-9)
+	assert.Equal(t, 5, metrics.counters[MetricEnforceTotal])
+}
+
+func TestHotPolicies(t *testing.T) {
+	assert.Nil(t, newManager(RBACWithDomain, nil).HotPolicies(1))
+
+	m := newManager(RBACWithDomain, []Option{WithUsageTracking()})
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"bob", "uni", "class_b", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	for i := 0; i < 3; i++ {
+		assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	}
+	assert.True(t, m.Enforce("bob", "uni", "class_b", "teach"))
+
+	assert.Equal(t, []PolicyHits{
+		{PType: "g", Rule: []string{"alice", "teacher", "uni"}, Hits: 3},
+		{PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}, Hits: 3},
+	}, m.HotPolicies(2))
+	assert.Len(t, m.HotPolicies(-1), 3)
+}
@@ -0,0 +1,76 @@
+package tulip
+
+import "errors"
+
+var (
+	// ErrRuleExists is returned by CreatePolicy when the rule is already stored
+	ErrRuleExists = errors.New("tulip: rule already exists")
+
+	// ErrRuleNotFound is returned when removing a rule that isn't stored
+	ErrRuleNotFound = errors.New("tulip: rule not found")
+
+	// ErrEmptyValue is returned when a rule to be stored contains an empty value
+	ErrEmptyValue = errors.New("tulip: rule has empty value")
+
+	// ErrClosed is returned when using a manager after Close has been called
+	ErrClosed = errors.New("tulip: manager is closed")
+
+	// ErrTooManyPolicies is returned when the table holds more rules than allowed by
+	// WithMaxPolicies
+	ErrTooManyPolicies = errors.New("tulip: too many policies")
+
+	// ErrMatcherNotFound is returned by EnforceWith when no matcher is registered under
+	// the given name
+	ErrMatcherNotFound = errors.New("tulip: matcher not found")
+
+	// ErrReadOnly is returned by mutation methods of a manager created with WithReadOnly
+	ErrReadOnly = errors.New("tulip: manager is read-only")
+
+	// ErrMissingClaim is returned by ClaimMapper.Map when the subject claim is absent
+	ErrMissingClaim = errors.New("tulip: missing claim")
+
+	// ErrUsageWindow is returned by UnusedPolicies when usage hasn't been tracked for
+	// the whole window
+	ErrUsageWindow = errors.New("tulip: usage not tracked over the whole window")
+
+	// ErrIdempotencyKeyReused is returned when an idempotency key is reused for a
+	// different kind of mutation
+	ErrIdempotencyKeyReused = errors.New("tulip: idempotency key reused for a different operation")
+
+	// ErrSnapshotExists is returned by TagSnapshot when the name is already taken
+	ErrSnapshotExists = errors.New("tulip: snapshot already exists")
+
+	// ErrSnapshotNotFound is returned by RestoreSnapshot when there is no snapshot by
+	// that name
+	ErrSnapshotNotFound = errors.New("tulip: snapshot not found")
+
+	// ErrInvalidSchemaName is returned when a schema or tenant name isn't made of
+	// lowercase letters, digits and underscores
+	ErrInvalidSchemaName = errors.New("tulip: invalid schema name")
+
+	// ErrUnsupported is returned by functions that need Postgres when the manager keeps
+	// its rules in another Storage, or that need an option the manager wasn't created
+	// with
+	ErrUnsupported = errors.New("tulip: not supported by the storage")
+
+	// ErrEventLogTampered is returned by VerifyEventLog when the hash chain of the event
+	// log is broken
+	ErrEventLogTampered = errors.New("tulip: event log tampered with")
+
+	// ErrInvalidRule is returned when a rule to be stored is rejected by WithValidation
+	ErrInvalidRule = errors.New("tulip: invalid rule")
+
+	// ErrRevisionNotFound is returned by RollbackTo when the revision doesn't exist
+	ErrRevisionNotFound = errors.New("tulip: revision not found")
+
+	// ErrMissingField is returned when building a rule that lacks a field of its model
+	ErrMissingField = errors.New("tulip: missing field")
+
+	// ErrUnknownField is returned when building a rule with a field that isn't part of
+	// its model
+	ErrUnknownField = errors.New("tulip: unknown field")
+
+	// ErrNotReady is returned when enforcing requests with StartupError before the
+	// manager first loaded its rules
+	ErrNotReady = errors.New("tulip: manager has not loaded its rules yet")
+)
@@ -0,0 +1,317 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// WithEventLog keeps an append-only log of every change made to the rule table, named
+// after it with suffix "_log". The rule table becomes a projection of the log: each
+// insert or delete is appended to the log by a trigger in the same transaction, so
+// the two can't diverge. Log entries can't be updated or deleted, and each entry holds
+// a hash chained to the previous one so that tampering is detected by VerifyEventLog.
+//
+// Entries written by the same transaction share a revision, revisions increase by one
+// per transaction, see Revision and RollbackTo. Rules already stored when the log is
+// created are logged as the first revision. The event log isn't supported with
+// normalized tables.
+func WithEventLog() Option {
+	return func(m *Manager) {
+		m.eventLog = true
+	}
+}
+
+// logHashSQL computes the hash of a log entry from the hash of the previous entry,
+// prev, and the entry's values given in the order of the log table.
+const logHashSQL = `encode(sha256(convert_to(json_build_array(
+	%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s,
+	extract(epoch from %s), extract(epoch from %s)
+)::text, 'UTF8')), 'hex')`
+
+// logHash returns logHashSQL with every column prefixed with qualifier
+func logHash(prev, qualifier string) string {
+	args := []interface{}{prev}
+	for _, col := range []string{
+		"rev", "op", "id", "p_type", "v0", "v1", "v2", "v3", "v4", "v5", "effective_from", "created_at",
+	} {
+		args = append(args, qualifier+col)
+	}
+	return fmt.Sprintf(logHashSQL, args...)
+}
+
+func eventLogSQL(t string, c columns, lockKey int64) []string {
+	return []string{
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_log (
+				seq bigserial PRIMARY KEY,
+				rev bigint NOT NULL,
+				tx bigint NOT NULL,
+				op text NOT NULL,
+				id text NOT NULL,
+				p_type text,
+				v0 text,
+				v1 text,
+				v2 text,
+				v3 text,
+				v4 text,
+				v5 text,
+				effective_from timestamptz,
+				created_at timestamptz NOT NULL,
+				hash text NOT NULL
+			)
+		`, t),
+		fmt.Sprintf(`
+			create or replace function log_append_%[1]s (op text, r %[1]s)
+			returns void
+			language plpgsql
+			as $$
+				declare
+					last record;
+					e %[1]s_log;
+				begin
+					-- serializes writers so that revisions and hashes follow commit order
+					PERFORM pg_advisory_xact_lock(%[2]d);
+					e.rev := 1;
+					e.tx := txid_current();
+					e.op := op;
+					e.id := r.%[3]s;
+					e.p_type := r.%[4]s;
+					e.v0 := r.%[5]s;
+					e.v1 := r.%[6]s;
+					e.v2 := r.%[7]s;
+					e.v3 := r.%[8]s;
+					e.v4 := r.%[9]s;
+					e.v5 := r.%[10]s;
+					e.effective_from := r.%[11]s;
+					e.created_at := clock_timestamp();
+					e.hash := '';
+					SELECT l.rev, l.tx, l.hash INTO last FROM %[1]s_log l ORDER BY l.seq DESC LIMIT 1;
+					IF FOUND THEN
+						e.hash := last.hash;
+						e.rev := last.rev;
+						IF last.tx <> e.tx THEN
+							e.rev := last.rev + 1;
+						END IF;
+					END IF;
+					e.hash := %[12]s;
+					INSERT INTO %[1]s_log (rev, tx, op, id, p_type, v0, v1, v2, v3, v4, v5, effective_from, created_at, hash)
+					VALUES (e.rev, e.tx, e.op, e.id, e.p_type, e.v0, e.v1, e.v2, e.v3, e.v4, e.v5, e.effective_from, e.created_at, e.hash);
+				end;
+			$$
+		`, t, lockKey, c.id, c.ptype, c.v[0], c.v[1], c.v[2], c.v[3], c.v[4], c.v[5], c.from, logHash("e.hash", "e.")),
+		fmt.Sprintf(`
+			create or replace function tg_log_%[1]s ()
+			returns trigger
+			language plpgsql
+			as $$
+				begin
+					IF (TG_OP = 'DELETE' OR TG_OP = 'UPDATE') THEN
+						PERFORM log_append_%[1]s('DELETE', OLD);
+					END IF;
+					IF (TG_OP = 'INSERT' OR TG_OP = 'UPDATE') THEN
+						PERFORM log_append_%[1]s('INSERT', NEW);
+					END IF;
+					RETURN NULL;
+				end;
+			$$
+		`, t),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS log_%s ON %s", t, t),
+		fmt.Sprintf(`
+			CREATE TRIGGER log_%s
+			AFTER INSERT OR UPDATE OR DELETE
+			ON %s
+			FOR EACH ROW
+			EXECUTE PROCEDURE tg_log_%s()
+		`, t, t, t),
+		fmt.Sprintf(`
+			create or replace function tg_log_immutable_%[1]s ()
+			returns trigger
+			language plpgsql
+			as $$
+				begin
+					RAISE EXCEPTION '%[1]s_log is append-only';
+				end;
+			$$
+		`, t),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS immutable_%s_log ON %s_log", t, t),
+		fmt.Sprintf(`
+			CREATE TRIGGER immutable_%s_log
+			BEFORE UPDATE OR DELETE OR TRUNCATE
+			ON %s_log
+			FOR EACH STATEMENT
+			EXECUTE PROCEDURE tg_log_immutable_%s()
+		`, t, t, t),
+		// logs the rules stored before the log was created
+		fmt.Sprintf(`
+			SELECT log_append_%[1]s('INSERT', r) FROM %[1]s r
+			WHERE NOT EXISTS (SELECT 1 FROM %[1]s_log)
+		`, t),
+	}
+}
+
+// LogEntry is a change recorded by the event log, see WithEventLog
+type LogEntry struct {
+	// Seq orders entries, it increases with every entry but may have gaps
+	Seq int64
+	// Rev is the revision of the transaction that made the change
+	Rev           int64
+	Op            EventOp
+	PType         string
+	Rule          []string
+	EffectiveFrom time.Time
+	At            time.Time
+	// Hash chains the entry to the previous one
+	Hash string
+}
+
+// eventLogLockKey returns the advisory lock serializing writes to the event log
+func (m *Manager) eventLogLockKey() int64 {
+	return advisoryLockKey(m.qualifiedTableName() + "_log")
+}
+
+// checkEventLog returns an error if the manager doesn't keep an event log
+func (m *Manager) checkEventLog() error {
+	if m.isClosed() {
+		return ErrClosed
+	}
+	if err := m.checkPostgres(); err != nil {
+		return err
+	}
+	if !m.eventLog {
+		return fmt.Errorf("%w: event log is disabled", ErrUnsupported)
+	}
+	return nil
+}
+
+// EventLog returns the entries of the event log with a revision greater than
+// sinceRev, oldest first. It requires WithEventLog.
+func (m *Manager) EventLog(ctx context.Context, sinceRev int64) ([]LogEntry, error) {
+	if err := m.checkEventLog(); err != nil {
+		return nil, fmt.Errorf("tulip.EventLog: %w", err)
+	}
+	var (
+		e             LogEntry
+		op            string
+		pType         pgtype.Text
+		v             [ruleWidth]pgtype.Text
+		effectiveFrom pgtype.Timestamptz
+		res           []LogEntry
+	)
+	_, err := m.readerPool().QueryFunc(ctx,
+		fmt.Sprintf(`
+			SELECT seq, rev, op, p_type, v0, v1, v2, v3, v4, v5, effective_from, created_at, hash
+			FROM %s_log WHERE rev > $1 ORDER BY seq
+		`, m.tableName),
+		[]interface{}{sinceRev},
+		[]interface{}{
+			&e.Seq, &e.Rev, &op, &pType, &v[0], &v[1], &v[2], &v[3], &v[4], &v[5], &effectiveFrom, &e.At, &e.Hash,
+		},
+		func(pgx.QueryFuncRow) error {
+			entry := e
+			entry.Op = EventInsert
+			if op == "DELETE" {
+				entry.Op = EventRemove
+			}
+			entry.PType = pType.String
+			entry.Rule = make([]string, ruleWidth)
+			for i := range v {
+				entry.Rule[i] = v[i].String
+			}
+			if err := m.decodeValues(entry.Rule); err != nil {
+				return err
+			}
+			entry.Rule = trimRule(entry.Rule)
+			if effectiveFrom.Status == pgtype.Present {
+				entry.EffectiveFrom = effectiveFrom.Time
+			}
+			res = append(res, entry)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.EventLog: %w", err)
+	}
+	return res, nil
+}
+
+// RulesAt replays the event log to return the rules that were stored at revision
+// rev, in no particular order. It requires WithEventLog.
+func (m *Manager) RulesAt(ctx context.Context, rev int64) ([]StoredRule, error) {
+	if err := m.checkEventLog(); err != nil {
+		return nil, fmt.Errorf("tulip.RulesAt: %w", err)
+	}
+	var (
+		pType         pgtype.Text
+		v             [ruleWidth]pgtype.Text
+		effectiveFrom pgtype.Timestamptz
+		res           []StoredRule
+	)
+	_, err := m.readerPool().QueryFunc(ctx,
+		fmt.Sprintf(`
+			SELECT p_type, v0, v1, v2, v3, v4, v5, effective_from FROM (%s) l
+		`, rulesAtSQL(m.tableName)),
+		[]interface{}{rev},
+		[]interface{}{&pType, &v[0], &v[1], &v[2], &v[3], &v[4], &v[5], &effectiveFrom},
+		func(pgx.QueryFuncRow) error {
+			r := StoredRule{PType: pType.String, Rule: make([]string, ruleWidth)}
+			for i := range v {
+				r.Rule[i] = v[i].String
+			}
+			if err := m.decodeValues(r.Rule); err != nil {
+				return err
+			}
+			r.Rule = trimRule(r.Rule)
+			if effectiveFrom.Status == pgtype.Present {
+				r.EffectiveFrom = effectiveFrom.Time
+			}
+			res = append(res, r)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.RulesAt: %w", err)
+	}
+	return res, nil
+}
+
+// rulesAtSQL selects the log entries of the rules stored at revision $1
+func rulesAtSQL(t string) string {
+	return fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT DISTINCT ON (id) * FROM %s_log WHERE rev <= $1 ORDER BY id, seq DESC
+		) latest WHERE op = 'INSERT'
+	`, t)
+}
+
+// VerifyEventLog recomputes the hash chain of the event log and returns
+// ErrEventLogTampered if an entry was modified, or if entries were inserted or
+// removed before the last one, by other means than the log trigger. It requires
+// WithEventLog.
+func (m *Manager) VerifyEventLog(ctx context.Context) error {
+	if err := m.checkEventLog(); err != nil {
+		return fmt.Errorf("tulip.VerifyEventLog: %w", err)
+	}
+	var seq int64
+	var valid bool
+	_, err := m.readerPool().QueryFunc(ctx,
+		fmt.Sprintf(`
+			SELECT seq, hash = %s FROM %s_log l ORDER BY seq
+		`, logHash("coalesce(lag(l.hash) OVER (ORDER BY l.seq), '')", "l."), m.tableName),
+		nil,
+		[]interface{}{&seq, &valid},
+		func(pgx.QueryFuncRow) error {
+			if !valid {
+				return fmt.Errorf("%w: entry %d", ErrEventLogTampered, seq)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("tulip.VerifyEventLog: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testEventLog(t *testing.T, connStr string, opts []Option) {
+	tableName := BrokenRandomLowerAlphaString(5)
+	opts = append(opts,
+		WithTableName(tableName),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithEventLog(),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+	ctx := context.Background()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	require.NoError(t, m.RemovePolicies(nil, [][]string{{"aaron", "teacher", "uni"}}))
+
+	entries, err := m.EventLog(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, int64(1), entries[0].Rev)
+	assert.Equal(t, int64(1), entries[1].Rev)
+	assert.Equal(t, EventInsert, entries[1].Op)
+	assert.Equal(t, []string{"aaron", "teacher", "uni"}, entries[1].Rule)
+	assert.Equal(t, int64(2), entries[2].Rev)
+	assert.Equal(t, EventRemove, entries[2].Op)
+
+	entries, err = m.EventLog(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	rules, err := m.RulesAt(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, rules, 2)
+	rules, err = m.RulesAt(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, StoredRule{PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}}, rules[0])
+
+	require.NoError(t, m.VerifyEventLog(ctx))
+	_, err = m.pool.Exec(ctx, fmt.Sprintf("UPDATE %s_log SET v0 = 'mallory'", tableName))
+	assert.Error(t, err, "the log is append-only")
+
+	// tampering with the log behind the trigger's back breaks the chain
+	_, err = m.pool.Exec(ctx, fmt.Sprintf(`
+		ALTER TABLE %[1]s_log DISABLE TRIGGER immutable_%[1]s_log;
+		UPDATE %[1]s_log SET v0 = 'mallory' WHERE seq = (SELECT min(seq) FROM %[1]s_log);
+	`, tableName))
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.VerifyEventLog(ctx), ErrEventLogTampered)
+}
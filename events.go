@@ -0,0 +1,90 @@
+package tulip
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// DefaultEventBufferSize is the capacity of the channel returned by Events
+const DefaultEventBufferSize = 1024
+
+// EventOp is the kind of change described by a PolicyEvent
+type EventOp string
+
+const (
+	EventInsert EventOp = "insert"
+	EventRemove EventOp = "remove"
+)
+
+// EventSource tells where the change described by a PolicyEvent originated
+type EventSource string
+
+const (
+	// SourceLocal marks changes made through this manager
+	SourceLocal EventSource = "local"
+	// SourceRemote marks changes received as notifications from the database
+	SourceRemote EventSource = "remote"
+	// SourceRefresh marks changes found by a full reload, i.e. missed notifications
+	SourceRefresh EventSource = "refresh"
+	// SourceSchedule marks scheduled rules taking effect, see AddScheduledPolicies
+	SourceSchedule EventSource = "schedule"
+	// SourceExpiry marks grouping rules that expired, see WithGroupExpiry
+	SourceExpiry EventSource = "expiry"
+)
+
+// PolicyEvent describes a change to the cached policies
+type PolicyEvent struct {
+	Op     EventOp
+	PType  string
+	Rule   []string
+	Source EventSource
+}
+
+// WithEventBufferSize specifies the capacity of the channel returned by Events
+func WithEventBufferSize(n int) Option {
+	return func(m *Manager) {
+		m.eventBufferSize = n
+	}
+}
+
+// Events returns a channel receiving an event for every rule inserted into or removed
+// from the cache. Each change is reported once, changes made through this manager
+// are reported as SourceLocal and are not reported again when their notification
+// arrives. Differences found by full reloads are reported as SourceRefresh.
+//
+// Events is not delivered to a slow consumer: when the channel is full new events
+// are dropped and logged. The channel is closed by Close.
+func (m *Manager) Events() <-chan PolicyEvent {
+	atomic.StoreInt32(&m.eventsSubscribed, 1)
+	return m.events
+}
+
+// emit sends ev to the events channel without blocking. Caller must hold m.mutex.
+func (m *Manager) emit(ev PolicyEvent) {
+	if ev.Source == SourceLocal {
+		m.audit(AuditEvent{Type: AuditPolicyChange, Op: ev.Op, PType: ev.PType, Rule: trimRule(ev.Rule)})
+	}
+	if atomic.LoadInt32(&m.eventsSubscribed) == 0 || m.eventsClosed {
+		return
+	}
+	select {
+	case m.events <- ev:
+	default:
+		if m.logger != nil {
+			m.logger.Warn("dropped policy event, events channel is full",
+				zap.String("op", string(ev.Op)),
+				zap.String("ptype", ev.PType),
+				zap.Strings("rule", ev.Rule),
+			)
+		}
+	}
+}
+
+// closeEvents closes the events channel. Caller must hold m.mutex.
+func (m *Manager) closeEvents() {
+	if !m.eventsClosed {
+		m.eventsClosed = true
+		close(m.events)
+	}
+}
@@ -0,0 +1,337 @@
+package tulip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// opExpiry is the notification op sent when the expiry of a stored rule is set or
+// cleared
+const opExpiry = "EXPIRY"
+
+// errNoGroupExpiry is returned by the methods requiring WithGroupExpiry without it
+var errNoGroupExpiry = errors.New("group expiry requires WithGroupExpiry")
+
+// expiringRule is a cached rule that stops applying at
+type expiringRule struct {
+	ptype string
+	rule  []string
+	at    time.Time
+}
+
+// ExpiringPolicy is a cached grouping rule that stops applying at ExpiresAt
+type ExpiringPolicy struct {
+	Rule      []string
+	ExpiresAt time.Time
+}
+
+// WithGroupExpiry lets grouping rules carry an expiry, e.g. to make alice on-call
+// admin until Monday with AddGroupingPoliciesUntil. Expiries are kept in the table
+// <table>_expiry, created with the rule table; Enforce and lookups ignore a rule once
+// it expired, on every manager, without any write. Expired rules stay stored until
+// PurgeExpiredGroupingPolicies removes them, typically run with WithMaintenance and
+// PurgeExpiredGroupingPoliciesTask, and are returned by QueryGroupingPolicies until
+// then. Adding a stored rule again without expiry, e.g. with AddPolicy, makes it
+// permanent. Expiries are not kept by snapshots, revisions or the event log.
+//
+// Group expiry is not supported with WithNormalizedSchema, WithSQLEnforcement or a
+// custom Storage.
+func WithGroupExpiry() Option {
+	return func(m *Manager) {
+		m.groupExpiry = true
+	}
+}
+
+// expiryTableSQL returns the statements creating the expiry table of table tableName
+// and the trigger clearing the expiry of rules added again, whether or not they were
+// already stored
+func expiryTableSQL(tableName string, c columns) []string {
+	return []string{
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[1]s_expiry (
+				id text PRIMARY KEY REFERENCES %[1]s (%[2]s) ON DELETE CASCADE,
+				expires_at timestamptz NOT NULL
+			)
+		`, tableName, c.id),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_expiry_expires_at_idx ON %[1]s_expiry (expires_at)", tableName),
+		fmt.Sprintf(`
+			create or replace function tg_clear_expiry_%[1]s ()
+			returns trigger
+			language plpgsql
+			as $$
+				begin
+					DELETE FROM %[1]s_expiry WHERE id = NEW.%[2]s;
+					RETURN NEW;
+				end;
+			$$
+		`, tableName, c.id),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS clear_expiry_%s ON %s", tableName, tableName),
+		fmt.Sprintf(`
+			CREATE TRIGGER clear_expiry_%s
+			BEFORE INSERT
+			ON %s
+			FOR EACH ROW
+			EXECUTE PROCEDURE tg_clear_expiry_%s()
+		`, tableName, tableName, tableName),
+	}
+}
+
+// expiryTriggerSQL returns the statements installing the trigger notifying changes of
+// the expiry table of table tableName. Expiries removed along with their rule aren't
+// notified, the removal of the rule is.
+func expiryTriggerSQL(tableName, channel string, c columns) []string {
+	return []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS notify_%s_expiry ON %s_expiry", tableName, tableName),
+		fmt.Sprintf(`
+			create or replace function tg_notify_%[1]s_expiry ()
+			returns trigger
+			language plpgsql
+			as $$
+				declare
+					channel text := TG_ARGV[0];
+				begin
+					IF (TG_OP = 'DELETE') THEN
+						PERFORM pg_notify(channel, json_build_object(
+							'v', %[5]d, 'op', '%[6]s', 'p_type', t.%[2]s, 'rule', ARRAY[%[3]s],
+							'ts', extract(epoch from clock_timestamp()),
+							'origin', current_setting('%[7]s', true)
+						)::text)
+						FROM %[1]s t WHERE t.%[4]s = OLD.id;
+					ELSE
+						PERFORM pg_notify(channel, json_build_object(
+							'v', %[5]d, 'op', '%[6]s', 'p_type', t.%[2]s, 'rule', ARRAY[%[3]s],
+							'ts', extract(epoch from clock_timestamp()), 'expires_at', NEW.expires_at,
+							'origin', current_setting('%[7]s', true)
+						)::text)
+						FROM %[1]s t WHERE t.%[4]s = NEW.id;
+					END IF;
+					RETURN NULL;
+				end;
+			$$
+		`, tableName, c.ptype, c.values("t."), c.id, notificationVersion, opExpiry, originParam),
+		fmt.Sprintf(`
+			CREATE TRIGGER notify_%s_expiry
+			AFTER INSERT OR UPDATE OR DELETE
+			ON %s_expiry
+			FOR EACH ROW
+			EXECUTE PROCEDURE tg_notify_%s_expiry('%s')
+		`, tableName, tableName, tableName, channel),
+	}
+}
+
+// AddGroupingPoliciesUntil stores grouping rules that stop applying at until. Rules
+// already stored are given the new expiry, replacing any earlier one. It requires
+// WithGroupExpiry and returns the number of rules inserted.
+func (m *Manager) AddGroupingPoliciesUntil(rules [][]string, until time.Time) (inserted int, err error) {
+	if !m.groupExpiry {
+		return 0, fmt.Errorf("tulip.AddGroupingPoliciesUntil: %w", errNoGroupExpiry)
+	}
+	if err := m.checkWritable(); err != nil {
+		return 0, fmt.Errorf("tulip.AddGroupingPoliciesUntil: %w", err)
+	}
+	if !until.After(time.Now()) {
+		return 0, fmt.Errorf("tulip.AddGroupingPoliciesUntil: expiry %v is not in the future", until)
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	sets := []typedRules{{"g", rules}}
+	if err := m.validateSets(sets); err != nil {
+		return 0, fmt.Errorf("tulip.AddGroupingPoliciesUntil: %w", err)
+	}
+	sets = m.pseudonymizeSets(sets)
+	expiresAt := pgtype.Timestamptz{Time: until, Status: pgtype.Present}
+	b := &pgx.Batch{}
+	for _, rule := range sets[0].rules {
+		args, err := m.policyArgs("g", rule)
+		if err != nil {
+			return 0, fmt.Errorf("tulip.AddGroupingPoliciesUntil: %w", err)
+		}
+		b.Queue(m.stmts.insert, append(args, pgtype.Timestamptz{Status: pgtype.Null})...)
+		b.Queue(fmt.Sprintf(`
+			INSERT INTO %s_expiry (id, expires_at) VALUES ($1, $2)
+			ON CONFLICT (id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		`, m.tableName), args[0], expiresAt)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	var added []bool
+	err = m.retryChange(ctx, func() error {
+		return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+			inserted, added = 0, make([]bool, len(sets[0].rules))
+			br := tx.SendBatch(ctx, b)
+			defer br.Close()
+			for i := 0; i < b.Len(); i++ {
+				tag, err := br.Exec()
+				if err != nil {
+					return err
+				}
+				if i%2 == 0 {
+					added[i/2] = tag.RowsAffected() > 0
+					inserted += int(tag.RowsAffected())
+				}
+			}
+			return br.Close()
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddGroupingPoliciesUntil: %w", err)
+	}
+	m.mutex.Lock()
+	for i, rule := range sets[0].rules {
+		if added[i] {
+			m.cacheInsert("g", rule, SourceLocal)
+		}
+		m.expireAt("g", rule, until)
+	}
+	m.mutex.Unlock()
+	return inserted, nil
+}
+
+// AddRoleForUserInDomainUntil gives role to user in domain until the given time, see
+// AddGroupingPoliciesUntil. It reports whether the rule was inserted.
+func (m *Manager) AddRoleForUserInDomainUntil(user, role, domain string, until time.Time) (bool, error) {
+	inserted, err := m.AddGroupingPoliciesUntil([][]string{{user, role, domain}}, until)
+	if err != nil {
+		return false, fmt.Errorf("tulip.AddRoleForUserInDomainUntil: %w", err)
+	}
+	return inserted > 0, nil
+}
+
+// ExpiringGroupingPolicies returns the cached grouping rules that have an expiry,
+// soonest first
+func (m *Manager) ExpiringGroupingPolicies() []ExpiringPolicy {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var res []ExpiringPolicy
+	for _, er := range m.expiring {
+		if er.ptype == "g" {
+			res = append(res, ExpiringPolicy{Rule: trimRule(er.rule), ExpiresAt: er.at})
+		}
+	}
+	return res
+}
+
+// PurgeExpiredGroupingPolicies removes the stored grouping rules that expired and
+// returns how many were removed. It requires WithGroupExpiry.
+func (m *Manager) PurgeExpiredGroupingPolicies(ctx context.Context) (int, error) {
+	if !m.groupExpiry {
+		return 0, fmt.Errorf("tulip.PurgeExpiredGroupingPolicies: %w", errNoGroupExpiry)
+	}
+	if err := m.checkWritable(); err != nil {
+		return 0, fmt.Errorf("tulip.PurgeExpiredGroupingPolicies: %w", err)
+	}
+	var purged int
+	err := m.retry(ctx, func() error {
+		tag, err := m.pool.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM %[1]s t USING %[1]s_expiry e
+			WHERE e.id = t.%[2]s AND e.expires_at <= now()
+		`, m.tableName, m.cols.id))
+		purged = int(tag.RowsAffected())
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.PurgeExpiredGroupingPolicies: %w", err)
+	}
+	if logger := m.log(ctx); logger != nil && purged > 0 {
+		logger.Info("purged expired grouping policies", zap.Int("count", purged))
+	}
+	return purged, nil
+}
+
+// PurgeExpiredGroupingPoliciesTask returns a maintenance task removing the expired
+// grouping rules, see PurgeExpiredGroupingPolicies
+func PurgeExpiredGroupingPoliciesTask() MaintenanceTask {
+	return func(ctx context.Context, m *Manager) error {
+		_, err := m.PurgeExpiredGroupingPolicies(ctx)
+		return err
+	}
+}
+
+// applyExpiry applies a notification that the expiry of a stored rule was set to at,
+// or cleared if at is nil, reporting whether the cache changed. Caller must hold
+// m.mutex.
+func (m *Manager) applyExpiry(ptype string, rule []string, at *time.Time) (added, removed bool) {
+	if at != nil && !at.After(time.Now()) {
+		return false, m.cacheRemove(ptype, rule, SourceExpiry)
+	}
+	added = m.cacheInsert(ptype, rule, SourceRemote)
+	if at != nil {
+		m.expireAt(ptype, rule, *at)
+	}
+	return added, false
+}
+
+// expireAt has rule stop applying at the given time, replacing any earlier expiry of
+// the same rule. Caller must hold m.mutex.
+func (m *Manager) expireAt(ptype string, rule []string, at time.Time) {
+	rule = padRule(rule)
+	m.unexpire(ptype, rule)
+	i := sort.Search(len(m.expiring), func(i int) bool {
+		return m.expiring[i].at.After(at)
+	})
+	m.expiring = append(m.expiring, expiringRule{})
+	copy(m.expiring[i+1:], m.expiring[i:])
+	m.expiring[i] = expiringRule{ptype, rule, at}
+	m.resetExpiry()
+}
+
+// unexpire clears the expiry of rule if any. Caller must hold m.mutex.
+func (m *Manager) unexpire(ptype string, rule []string) {
+	if len(m.expiring) == 0 {
+		return
+	}
+	rule = padRule(rule)
+	for i, er := range m.expiring {
+		if er.ptype == ptype && stringSliceEqual(er.rule, rule) {
+			m.expiring = append(m.expiring[:i], m.expiring[i+1:]...)
+			return
+		}
+	}
+}
+
+// replaceExpiring replaces all expiries, as found by a full load. Caller must hold
+// m.mutex.
+func (m *Manager) replaceExpiring(expiring []expiringRule) {
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].at.Before(expiring[j].at)
+	})
+	m.expiring = expiring
+	m.resetExpiry()
+}
+
+// resetExpiry arms the timer for the earliest expiry. Caller must hold m.mutex.
+func (m *Manager) resetExpiry() {
+	if m.expiry != nil {
+		m.expiry.Stop()
+		m.expiry = nil
+	}
+	if len(m.expiring) == 0 || m.isClosed() {
+		return
+	}
+	m.expiry = time.AfterFunc(time.Until(m.expiring[0].at), m.expireDue)
+}
+
+// expireDue removes the rules whose expiry has come from the cache
+func (m *Manager) expireDue() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	n := 0
+	for n < len(m.expiring) && !m.expiring[n].at.After(now) {
+		n++
+	}
+	due := append([]expiringRule(nil), m.expiring[:n]...)
+	m.expiring = m.expiring[n:]
+	for _, er := range due {
+		m.cacheRemove(er.ptype, er.rule, SourceExpiry)
+	}
+	m.resetExpiry()
+}
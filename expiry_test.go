@@ -0,0 +1,110 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGroupExpirySQL(t *testing.T) {
+	m := newManager(nil, []Option{WithTableName("acl"), WithGroupExpiry()})
+	stmts := m.tableStmts()
+	require.Len(t, stmts, 7)
+	assert.Contains(t, stmts[2], "CREATE TABLE IF NOT EXISTS acl_expiry")
+	assert.Contains(t, stmts[6], "BEFORE INSERT")
+	_, tables := m.notifyTriggers()
+	assert.Equal(t, []string{"acl", "acl_expiry"}, tables)
+	assert.Contains(t, m.stmts.load, "LEFT JOIN acl_expiry e ON e.id = t.id")
+
+	_, err := m.AddGroupingPoliciesUntil([][]string{{"alice", "admin", "uni"}}, time.Now().Add(-time.Hour))
+	assert.Error(t, err)
+	inserted, err := m.AddGroupingPoliciesUntil(nil, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, inserted)
+	_, err = newManager(nil, nil).AddGroupingPoliciesUntil(nil, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, errNoGroupExpiry)
+	_, err = NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain, WithGroupExpiry())
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestGroupExpiry(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithGroupExpiry()})
+	m.cacheInsert("p", []string{"admin", "uni", "pager", "ack"}, SourceLocal)
+	now := time.Now()
+	m.mutex.Lock()
+	m.applyExpiry("g", []string{"alice", "admin", "uni"}, &[]time.Time{now.Add(50 * time.Millisecond)}[0])
+	m.applyExpiry("g", []string{"bob", "admin", "uni"}, &[]time.Time{now.Add(time.Hour)}[0])
+	m.applyExpiry("g", []string{"carol", "admin", "uni"}, &[]time.Time{now.Add(-time.Second)}[0])
+	m.mutex.Unlock()
+	assert.True(t, m.Enforce("alice", "uni", "pager", "ack"))
+	assert.True(t, m.Enforce("bob", "uni", "pager", "ack"))
+	assert.False(t, m.Enforce("carol", "uni", "pager", "ack"))
+	assert.Equal(t, []ExpiringPolicy{
+		{Rule: []string{"alice", "admin", "uni"}, ExpiresAt: now.Add(50 * time.Millisecond)},
+		{Rule: []string{"bob", "admin", "uni"}, ExpiresAt: now.Add(time.Hour)},
+	}, m.ExpiringGroupingPolicies())
+
+	// adding a rule again without expiry makes it permanent
+	m.mutex.Lock()
+	m.applyExpiry("g", []string{"bob", "admin", "uni"}, nil)
+	m.mutex.Unlock()
+	retryUntil(t, 10*time.Millisecond, 100, func() bool {
+		return len(m.ExpiringGroupingPolicies()) == 0
+	}, func() string { return "waiting for expiry" })
+	assert.Equal(t, 1, m.Stats().GroupingPolicyCount)
+	assert.True(t, m.Enforce("bob", "uni", "pager", "ack"))
+	assert.False(t, m.Enforce("alice", "uni", "pager", "ack"))
+}
+
+func testGroupExpiry(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithGroupExpiry(),
+	)
+	a, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = a.AddPolicy("p", []string{"admin", "uni", "pager", "ack"})
+	require.NoError(t, err)
+	inserted, err := a.AddRoleForUserInDomainUntil("alice", "admin", "uni", time.Now().Add(500*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, inserted)
+	_, err = a.AddGroupingPoliciesUntil([][]string{{"bob", "admin", "uni"}}, time.Now().Add(500*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, b.WaitForSync(ctx))
+	assert.True(t, b.Enforce("alice", "uni", "pager", "ack"))
+	assert.Len(t, b.ExpiringGroupingPolicies(), 2)
+
+	// bob's membership is made permanent
+	_, err = b.AddPolicy("g", []string{"bob", "admin", "uni"})
+	require.NoError(t, err)
+	require.NoError(t, a.WaitForSync(ctx))
+	assert.Len(t, a.ExpiringGroupingPolicies(), 1)
+
+	retryUntil(t, 50*time.Millisecond, 40, func() bool {
+		return !a.Enforce("alice", "uni", "pager", "ack") && !b.Enforce("alice", "uni", "pager", "ack")
+	}, func() string { return "waiting for expiry" })
+	assert.True(t, a.Enforce("bob", "uni", "pager", "ack"))
+	assert.True(t, b.Enforce("bob", "uni", "pager", "ack"))
+
+	// expired rules are skipped by loads until purged
+	require.NoError(t, a.LoadPolicies())
+	assert.False(t, a.Enforce("alice", "uni", "pager", "ack"))
+	purged, err := a.PurgeExpiredGroupingPolicies(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	rules, err := a.QueryGroupingPolicies(ctx)
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
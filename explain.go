@@ -0,0 +1,111 @@
+package tulip
+
+// Explanation traces how a request (sub, dom, obj, act) is evaluated, see Explain
+type Explanation struct {
+	Request []string
+	// Allowed is the decision of the manager's matcher
+	Allowed bool
+	// Domains are the requested domain followed by its ancestors, see
+	// WithDomainHierarchy
+	Domains []string
+	// Actions are the requested action followed by the actions implying it, see
+	// WithActionImplication
+	Actions []string
+	// Groups are the grouping rules assigning roles to the subject in Domains
+	Groups [][]string
+	// Candidates are the rules granting permissions to the subject, its roles or the
+	// bundles they hold, in the order they were considered
+	Candidates []Candidate
+	// PType and Rule identify the rule granting the request, Rule is nil if none does
+	PType string
+	Rule  []string
+}
+
+// Candidate is a rule considered while evaluating a request
+type Candidate struct {
+	PType string
+	Rule  []string
+	// Via is the role or bundle the rule applies through, empty for rules granted to
+	// the subject directly
+	Via string
+	// Eliminated is the value that doesn't match the request: "domain", "object" or
+	// "action", empty if the rule grants the request
+	Eliminated string
+}
+
+// Explain evaluates request like RBACWithDomain and records each step: the roles
+// resolved, every rule of the subject and of its roles considered along with the
+// value that eliminates it, and the rule granting the request if any, to answer
+// questions such as "why can't alice see this?". The steps follow RBACWithDomain, with
+// its hierarchies, implications and bundles, whereas Allowed is the decision of the
+// manager's matcher. Requests of fewer than four values are only decided. Explain
+// doesn't record rule usage.
+func (m *Manager) Explain(request ...string) *Explanation {
+	request = m.pseudonymizeRequest(request)
+	view := m.view()
+	e := &Explanation{Request: request}
+	if len(request) < 4 {
+		e.Allowed = view.matcher(view, request...)
+		return e
+	}
+	sub, dom, obj, act := request[0], request[1], request[2], request[3]
+	e.Domains = view.domainAncestors(dom)
+	e.Actions = view.grantingActions(act)
+	roles := []string{}
+	for _, d := range e.Domains {
+		for _, g := range view.FilterGroups(sub, "", d) {
+			e.Groups = append(e.Groups, trimRule(g))
+			roles = append(roles, g[1])
+		}
+	}
+
+	consider := func(c Candidate) {
+		c.Rule = trimRule(c.Rule)
+		if c.Eliminated == "" && e.Rule == nil {
+			e.PType, e.Rule = c.PType, c.Rule
+		}
+		e.Candidates = append(e.Candidates, c)
+	}
+	for i, s := range append([]string{sub}, roles...) {
+		via := ""
+		if i > 0 {
+			via = s
+		}
+		for _, p := range view.Filter(s) {
+			c := Candidate{PType: "p", Rule: p, Via: via}
+			switch {
+			case !containsString(e.Domains, p[1]):
+				c.Eliminated = "domain"
+			case !view.objectCovers(p[2], obj):
+				c.Eliminated = "object"
+			case !containsString(e.Actions, p[3]):
+				c.Eliminated = "action"
+			}
+			consider(c)
+		}
+	}
+	// bundles are assigned to the subject's roles or to the roles they hold in turn,
+	// see findBundleGrant
+	bundles := append([]string(nil), roles...)
+	for _, role := range roles {
+		for _, d := range e.Domains {
+			for _, g := range view.FilterGroups(role, "", d) {
+				bundles = append(bundles, g[1])
+			}
+		}
+	}
+	for _, name := range bundles {
+		for _, b := range view.FilterType(BundlePType, name) {
+			c := Candidate{PType: BundlePType, Rule: b, Via: name}
+			switch {
+			case !view.objectCovers(b[1], obj):
+				c.Eliminated = "object"
+			case !containsString(e.Actions, b[2]):
+				c.Eliminated = "action"
+			}
+			consider(c)
+		}
+	}
+	e.Allowed = view.matcher(view, request...)
+	return e
+}
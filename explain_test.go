@@ -0,0 +1,41 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("p", []string{"alice", "college", "class_a", "read"}, SourceLocal)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "write"}, SourceLocal)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_b", "read"}, SourceLocal)
+
+	e := m.Explain("alice", "uni", "class_a", "read")
+	assert.False(t, e.Allowed)
+	assert.Equal(t, [][]string{{"alice", "teacher", "uni"}}, e.Groups)
+	assert.Equal(t, []Candidate{
+		{PType: "p", Rule: []string{"alice", "college", "class_a", "read"}, Eliminated: "domain"},
+		{PType: "p", Rule: []string{"teacher", "uni", "class_a", "write"}, Via: "teacher", Eliminated: "action"},
+		{PType: "p", Rule: []string{"teacher", "uni", "class_b", "read"}, Via: "teacher", Eliminated: "object"},
+	}, e.Candidates)
+	assert.Nil(t, e.Rule)
+
+	e = m.Explain("alice", "uni", "class_a", "write")
+	assert.True(t, e.Allowed)
+	assert.Equal(t, "p", e.PType)
+	assert.Equal(t, []string{"teacher", "uni", "class_a", "write"}, e.Rule)
+
+	m.cacheInsert(BundlePType, []string{"teacher", "class_a", "read"}, SourceLocal)
+	e = m.Explain("alice", "uni", "class_a", "read")
+	assert.True(t, e.Allowed)
+	assert.Equal(t, BundlePType, e.PType)
+	assert.Equal(t, []string{"teacher", "class_a", "read"}, e.Rule)
+
+	m.matcher = func(m *Manager, request ...string) bool { return request[0] == "root" }
+	e = m.Explain("root", "uni")
+	assert.True(t, e.Allowed, "other request shapes are only decided")
+	assert.Nil(t, e.Candidates)
+}
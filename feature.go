@@ -0,0 +1,82 @@
+package tulip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FeaturePType is the policy type feature flags are stored under
+const FeaturePType = "f"
+
+// SetFeature enables or disables feature for tenant, such as the features of the plan
+// a tenant is subscribed to, as a rule of type FeaturePType of the form
+// (tenant, feature, enabled). Feature rules are stored in the rule table and synced
+// like any other rule.
+func (m *Manager) SetFeature(tenant, feature string, enabled bool) error {
+	rule := []string{tenant, feature, strconv.FormatBool(enabled)}
+	var stale [][]string
+	for _, f := range m.FilterType(FeaturePType, tenant, feature) {
+		if f[2] != rule[2] {
+			stale = append(stale, trimRule(f))
+		}
+	}
+	if len(stale) > 0 {
+		if err := m.removeRules([]typedRules{{FeaturePType, stale}}); err != nil {
+			return fmt.Errorf("tulip.SetFeature: %w", err)
+		}
+	}
+	if _, err := m.addRules([]typedRules{{FeaturePType, [][]string{rule}}}, time.Time{}); err != nil {
+		return fmt.Errorf("tulip.SetFeature: %w", err)
+	}
+	return nil
+}
+
+// RemoveFeature removes the flag of feature for tenant, which is then disabled
+func (m *Manager) RemoveFeature(tenant, feature string) error {
+	var rules [][]string
+	for _, f := range m.FilterType(FeaturePType, tenant, feature) {
+		rules = append(rules, trimRule(f))
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	if err := m.removeRules([]typedRules{{FeaturePType, rules}}); err != nil {
+		return fmt.Errorf("tulip.RemoveFeature: %w", err)
+	}
+	return nil
+}
+
+// HasFeature tells whether feature is enabled for tenant. Features without a flag are
+// disabled, and so are features with conflicting flags, e.g. written to the table
+// directly.
+func (m *Manager) HasFeature(tenant, feature string) bool {
+	enabled := false
+	for _, f := range m.FilterType(FeaturePType, tenant, feature) {
+		on, err := strconv.ParseBool(f[2])
+		if err != nil || !on {
+			return false
+		}
+		enabled = true
+	}
+	return enabled
+}
+
+// Features returns the features enabled for tenant, sorted
+func (m *Manager) Features(tenant string) []string {
+	seen := map[string]bool{}
+	for _, f := range m.FilterType(FeaturePType, tenant) {
+		if _, ok := seen[f[1]]; !ok {
+			seen[f[1]] = m.HasFeature(tenant, f[1])
+		}
+	}
+	var res []string
+	for feature, on := range seen {
+		if on {
+			res = append(res, feature)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
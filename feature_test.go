@@ -0,0 +1,36 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+
+	assert.False(t, m.HasFeature("acme", "sso"))
+	require.NoError(t, m.SetFeature("acme", "sso", true))
+	require.NoError(t, m.SetFeature("acme", "audit-log", true))
+	require.NoError(t, m.SetFeature("acme", "beta", false))
+	assert.True(t, m.HasFeature("acme", "sso"))
+	assert.False(t, m.HasFeature("acme", "beta"))
+	assert.False(t, m.HasFeature("globex", "sso"))
+	assert.Equal(t, []string{"audit-log", "sso"}, m.Features("acme"))
+
+	require.NoError(t, m.SetFeature("acme", "sso", false))
+	assert.False(t, m.HasFeature("acme", "sso"))
+	assert.Equal(t, 3, m.PolicyTypeCount(FeaturePType))
+
+	require.NoError(t, m.RemoveFeature("acme", "audit-log"))
+	assert.False(t, m.HasFeature("acme", "audit-log"))
+	assert.Nil(t, m.Features("acme"))
+
+	m.cacheInsert(FeaturePType, []string{"globex", "sso", "true"}, SourceLocal)
+	m.cacheInsert(FeaturePType, []string{"globex", "sso", "false"}, SourceLocal)
+	assert.False(t, m.HasFeature("globex", "sso"), "conflicting flags disable the feature")
+}
@@ -0,0 +1,182 @@
+package tulip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultFields are the field names of the rules of each policy type, following the
+// model of RBACWithDomain. Types without registered field names have none, see
+// WithFields.
+var DefaultFields = map[string][]string{
+	"p": {"sub", "dom", "obj", "act"},
+	"g": {"sub", "role", "dom"},
+}
+
+// WithFields registers the names of the fields of rules of type ptype, in order, e.g.
+//
+//	WithFields("p2", "sub", "obj", "act")
+//
+// They replace DefaultFields for ptype and are used by BuildRule.
+func WithFields(ptype string, names ...string) Option {
+	return func(m *Manager) {
+		if m.fields == nil {
+			m.fields = map[string][]string{}
+		}
+		m.fields[ptype] = names
+	}
+}
+
+// Fields returns the field names of rules of type ptype, or nil if there are none
+func (m *Manager) Fields(ptype string) []string {
+	if names, ok := m.fields[ptype]; ok {
+		return names
+	}
+	return DefaultFields[ptype]
+}
+
+// RuleBuilder assigns the values of a rule by field name rather than by position,
+// see Rule.
+type RuleBuilder struct {
+	values map[string]string
+}
+
+// Rule starts building a rule, e.g.
+//
+//	Rule().Sub("alice").Dom("uni").Obj("class_a").Act("teach")
+//
+// The rule is turned into values in the order of a model with Build or
+// Manager.BuildRule.
+func Rule() *RuleBuilder {
+	return &RuleBuilder{values: map[string]string{}}
+}
+
+// Field sets the value of field name
+func (b *RuleBuilder) Field(name, value string) *RuleBuilder {
+	b.values[name] = value
+	return b
+}
+
+// Sub sets field "sub"
+func (b *RuleBuilder) Sub(value string) *RuleBuilder {
+	return b.Field("sub", value)
+}
+
+// Dom sets field "dom"
+func (b *RuleBuilder) Dom(value string) *RuleBuilder {
+	return b.Field("dom", value)
+}
+
+// Obj sets field "obj"
+func (b *RuleBuilder) Obj(value string) *RuleBuilder {
+	return b.Field("obj", value)
+}
+
+// Act sets field "act"
+func (b *RuleBuilder) Act(value string) *RuleBuilder {
+	return b.Field("act", value)
+}
+
+// Role sets field "role"
+func (b *RuleBuilder) Role(value string) *RuleBuilder {
+	return b.Field("role", value)
+}
+
+// Build returns the values of the rule ordered as fields. It returns ErrMissingField
+// if any of fields isn't set and ErrUnknownField if a field that isn't one of fields
+// is set.
+func (b *RuleBuilder) Build(fields ...string) ([]string, error) {
+	rule := make([]string, len(fields))
+	var missing []string
+	for i, name := range fields {
+		v, ok := b.values[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		rule[i] = v
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("tulip.RuleBuilder.Build: %w: %s", ErrMissingField, strings.Join(missing, ", "))
+	}
+	known := make(map[string]bool, len(fields))
+	for _, name := range fields {
+		known[name] = true
+	}
+	for name := range b.values {
+		if !known[name] {
+			return nil, fmt.Errorf("tulip.RuleBuilder.Build: %w: %s", ErrUnknownField, name)
+		}
+	}
+	return rule, nil
+}
+
+// BuildRule returns the values of rule b of type ptype, ordered as the fields of ptype
+// and ready to be passed to AddPolicy or Enforce, see RuleBuilder.Build.
+func (m *Manager) BuildRule(ptype string, b *RuleBuilder) ([]string, error) {
+	names := m.Fields(ptype)
+	if names == nil {
+		return nil, fmt.Errorf("tulip.BuildRule: no fields registered for type %q", ptype)
+	}
+	rule, err := b.Build(names...)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.BuildRule: %w", err)
+	}
+	return rule, nil
+}
+
+// filterArgs turns values keyed by the field names of ptype into the arguments of
+// Filter, with empty strings for the fields left out
+func (m *Manager) filterArgs(ptype string, values map[string]string) ([]string, error) {
+	names := m.Fields(ptype)
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	n := 0
+	for name := range values {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, name)
+		}
+		if i >= n {
+			n = i + 1
+		}
+	}
+	rule := make([]string, n)
+	for name, v := range values {
+		rule[index[name]] = v
+	}
+	return rule, nil
+}
+
+// FilterBy filters policies by field name rather than by position, e.g.
+//
+//	m.FilterBy(map[string]string{"dom": "uni", "act": "teach"})
+//
+// is m.Filter("", "uni", "", "teach"). It returns ErrUnknownField if a name isn't a
+// field of "p", see WithFields.
+func (m *Manager) FilterBy(values map[string]string) (Policies, error) {
+	rule, err := m.filterArgs("p", values)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.FilterBy: %w", err)
+	}
+	return m.Filter(rule...), nil
+}
+
+// FilterGroupsBy is FilterBy for grouping policies, whose fields are those of "g"
+func (m *Manager) FilterGroupsBy(values map[string]string) (Policies, error) {
+	rule, err := m.filterArgs("g", values)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.FilterGroupsBy: %w", err)
+	}
+	return m.FilterGroups(rule...), nil
+}
+
+// FilterTypeBy is FilterBy for policies of type ptype
+func (m *Manager) FilterTypeBy(ptype string, values map[string]string) (Policies, error) {
+	rule, err := m.filterArgs(ptype, values)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.FilterTypeBy: %w", err)
+	}
+	return m.FilterType(ptype, rule...), nil
+}
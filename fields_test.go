@@ -0,0 +1,62 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRule(t *testing.T) {
+	m := newManager(nil, []Option{WithFields("p2", "sub", "obj", "act")})
+
+	rule, err := m.BuildRule("p", Rule().Act("teach").Obj("class_a").Dom("uni").Sub("alice"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "uni", "class_a", "teach"}, rule)
+
+	rule, err = m.BuildRule("g", Rule().Role("admin").Sub("alice").Dom("uni"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "admin", "uni"}, rule)
+
+	rule, err = m.BuildRule("p2", Rule().Sub("alice").Obj("class_a").Act("teach"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "class_a", "teach"}, rule)
+
+	_, err = m.BuildRule("p", Rule().Sub("alice").Obj("class_a").Act("teach"))
+	assert.ErrorIs(t, err, ErrMissingField)
+
+	_, err = m.BuildRule("p2", Rule().Sub("alice").Dom("uni").Obj("class_a").Act("teach"))
+	assert.ErrorIs(t, err, ErrUnknownField)
+
+	_, err = m.BuildRule("p3", Rule().Sub("alice"))
+	assert.Error(t, err)
+}
+
+func TestFilterBy(t *testing.T) {
+	m := NewStaticEnforcer(Policies{
+		{"alice", "uni", "class_a", "teach"},
+		{"bob", "uni", "class_b", "teach"},
+		{"bob", "uni", "class_b", "learn"},
+		{"carol", "school", "class_c", "teach"},
+	}, Policies{
+		{"alice", "admin", "uni"},
+		{"bob", "admin", "school"},
+	}, RBACWithDomain)
+
+	res, err := m.FilterBy(map[string]string{"dom": "uni", "act": "teach"})
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.ElementsMatch(t, m.Filter("", "uni", "", "teach"), res)
+
+	res, err = m.FilterBy(map[string]string{})
+	require.NoError(t, err)
+	assert.Len(t, res, 4)
+
+	res, err = m.FilterGroupsBy(map[string]string{"role": "admin", "dom": "school"})
+	require.NoError(t, err)
+	assert.Equal(t, m.FilterGroups("", "admin", "school"), res)
+	assert.Len(t, res, 1)
+
+	_, err = m.FilterBy(map[string]string{"role": "admin"})
+	assert.ErrorIs(t, err, ErrUnknownField)
+}
@@ -1,5 +1,14 @@
 package tulip
 
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
 // Matcher encapsulates the logic of matching a query request against
 // internal policies and grouping polcies.
 type Matcher func(m *Manager, request ...string) bool
@@ -11,33 +20,174 @@ type Matcher func(m *Manager, request ...string) bool
 //     g = _, _, _
 //     e = some(where (p.eft == allow))
 //     m = (r.sub == p.sub || g(r.sub, p.sub, r.dom)) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+//
+// Options such as WithDomainHierarchy, WithObjectHierarchy and
+// WithActionImplication extend the model, and bundles defined with DefineBundle are
+// expanded into their permissions.
 func RBACWithDomain(m *Manager, request ...string) bool {
 	sub, dom, obj, act := request[0], request[1], request[2], request[3]
-	if p := m.FindExact(sub, dom, obj, act); p != nil {
+	if m.hierarchical() {
+		return rbacHierarchical(m, sub, dom, obj, act)
+	}
+	start := m.timing()
+	p := m.FindExact(sub, dom, obj, act)
+	m.observeSince(MetricMatchPhaseSeconds, start, exactPhaseLabels)
+	if p != nil {
+		m.RecordUsage("p", p)
 		return true
 	}
+	start = m.timing()
 	groups := m.FilterGroups(sub, "", dom)
+	m.observeSince(MetricMatchPhaseSeconds, start, groupsPhaseLabels)
+	start = m.timing()
 	policies := m.FilterWithGroups(0, groups, 1)
-	if len(policies) == 0 {
-		return false
+	if len(policies) > 0 {
+		policies = policies.Filter("", dom, obj, act)
+	}
+	m.observeSince(MetricMatchPhaseSeconds, start, filterPhaseLabels)
+	if m.usage != nil {
+		for _, p := range policies {
+			m.RecordUsage("p", p)
+			for _, g := range groups {
+				if g[1] == p[0] {
+					m.RecordUsage("g", g)
+				}
+			}
+		}
 	}
-	policies = policies.Filter("", dom, obj, act)
 	return len(policies) > 0
 }
 
+// AllOf returns a matcher that grants a request when all of matchers do
+func AllOf(matchers ...Matcher) Matcher {
+	return func(m *Manager, request ...string) bool {
+		for _, matcher := range matchers {
+			if !matcher(m, request...) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyOf returns a matcher that grants a request when any of matchers does
+func AnyOf(matchers ...Matcher) Matcher {
+	return func(m *Manager, request ...string) bool {
+		for _, matcher := range matchers {
+			if matcher(m, request...) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a matcher that grants a request when matcher doesn't
+func Not(matcher Matcher) Matcher {
+	return func(m *Manager, request ...string) bool {
+		return !matcher(m, request...)
+	}
+}
+
+// Delegated returns a matcher for requests made by a service on behalf of a user, of
+// the form (service, user, rest...). It grants a request when matcher grants both
+// (service, rest...) and (user, rest...), so that e.g. a service allowed to read
+// documents only reads those the user may read as well.
+func Delegated(matcher Matcher) Matcher {
+	return func(m *Manager, request ...string) bool {
+		if len(request) < 2 {
+			return false
+		}
+		// the service is the subject of the request, already pseudonymized
+		rest := request[2:]
+		return matcher(m, append([]string{request[0]}, rest...)...) &&
+			matcher(m, append([]string{m.hashSubject(request[1])}, rest...)...)
+	}
+}
+
 // FindExact finds the policy that match this rule exactly
 func (m *Manager) FindExact(rule ...string) []string {
-	return m.p.Find(rule)
+	if p := m.ctxP.Find(rule); p != nil {
+		return p
+	}
+	mu := m.cacheMutex()
+	mu.RLock()
+	p := m.p.Find(rule)
+	mu.RUnlock()
+	if p != nil || m.sources == nil {
+		return p
+	}
+	for _, src := range m.sources {
+		if p := src.FindExact(rule...); p != nil {
+			return p
+		}
+	}
+	return nil
 }
 
 // Filter filters policies
 func (m *Manager) Filter(rule ...string) Policies {
-	return m.p.Filter(rule...)
+	mu := m.cacheMutex()
+	mu.RLock()
+	res := m.p.Filter(rule...)
+	mu.RUnlock()
+	if m.ctxP != nil {
+		res = append(res, m.ctxP.Filter(rule...)...)
+	}
+	for _, src := range m.sources {
+		res = append(res, src.Filter(rule...)...)
+	}
+	return res
+}
+
+// FindExactType finds the policy of type ptype, such as "p2", that match this rule exactly
+func (m *Manager) FindExactType(ptype string, rule ...string) []string {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
+	if p := m.policySet(ptype, false); p != nil {
+		return p.Find(rule)
+	}
+	return nil
+}
+
+// FilterType filters policies of type ptype, such as "p2"
+func (m *Manager) FilterType(ptype string, rule ...string) Policies {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
+	if p := m.policySet(ptype, false); p != nil {
+		return p.Filter(rule...)
+	}
+	return nil
 }
 
 // Filter filters grouping policies
 func (m *Manager) FilterGroups(rule ...string) Policies {
-	return m.g.Filter(rule...)
+	if m.groupMemo == nil {
+		return m.filterGroups(rule)
+	}
+	key := strings.Join(rule, "\x00")
+	res, ok := m.groupMemo[key]
+	if !ok {
+		res = m.filterGroups(rule)
+		m.groupMemo[key] = res
+	}
+	return res
+}
+
+func (m *Manager) filterGroups(rule []string) Policies {
+	mu := m.cacheMutex()
+	mu.RLock()
+	res := m.g.Filter(rule...)
+	mu.RUnlock()
+	if m.ctxG != nil {
+		res = append(res, m.ctxG.Filter(rule...)...)
+	}
+	for _, src := range m.sources {
+		res = append(res, src.FilterGroups(rule...)...)
+	}
+	return res
 }
 
 func (m *Manager) FilterWithGroups(policyValueIndex int, groups Policies, groupValueIndex int) Policies {
@@ -46,13 +196,202 @@ func (m *Manager) FilterWithGroups(policyValueIndex int, groups Policies, groupV
 	}
 	var result Policies
 	filterSlice := make([]string, policyValueIndex+1)
+	mu := m.cacheMutex()
 	for _, g := range groups {
 		filterSlice[policyValueIndex] = g[groupValueIndex]
+		mu.RLock()
 		result = append(result, m.p.Filter(filterSlice...)...)
+		mu.RUnlock()
+		if m.ctxP != nil {
+			result = append(result, m.ctxP.Filter(filterSlice...)...)
+		}
+		for _, src := range m.sources {
+			result = append(result, src.Filter(filterSlice...)...)
+		}
 	}
 	return result
 }
 
 func (m *Manager) Enforce(request ...string) bool {
-	return m.matcher(m, request...)
+	return m.enforce(context.Background(), "default", m.matcher, request)
+}
+
+// EnforceOnBehalfOf evaluates request for service acting on behalf of user: both must
+// be granted request, as if each was its subject. For example
+//
+//	m.EnforceOnBehalfOf("svc:mailer", "alice", "uni", "inbox", "read")
+//
+// requires both ("svc:mailer", "uni", "inbox", "read") and ("alice", "uni", "inbox",
+// "read"). See Delegated for a matcher doing the same.
+func (m *Manager) EnforceOnBehalfOf(service, user string, request ...string) bool {
+	return m.Enforce(append([]string{service}, request...)...) &&
+		m.Enforce(append([]string{user}, request...)...)
+}
+
+// EnforceAll tells whether every one of requests is granted, for endpoints requiring
+// several permissions at once. It stops at the first denied request. Grouping rules
+// are looked up once for all requests, so requests sharing a subject and domain only
+// resolve its roles once. EnforceAll grants an empty list of requests.
+func (m *Manager) EnforceAll(requests [][]string) bool {
+	matcher := m.memoized()
+	for _, request := range requests {
+		if !m.enforce(context.Background(), "default", matcher, request) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnforceAny tells whether at least one of requests is granted. It stops at the first
+// granted request and looks up grouping rules like EnforceAll. EnforceAny denies an
+// empty list of requests.
+func (m *Manager) EnforceAny(requests [][]string) bool {
+	matcher := m.memoized()
+	for _, request := range requests {
+		if m.enforce(context.Background(), "default", matcher, request) {
+			return true
+		}
+	}
+	return false
+}
+
+// memoized returns the matcher of m evaluating requests against a view of m that
+// remembers the grouping rules it looked up, to share them across requests
+func (m *Manager) memoized() Matcher {
+	view := m.view()
+	view.usage = m.usage
+	view.groupMemo = map[string]Policies{}
+	return func(v *Manager, request ...string) bool {
+		if v == m {
+			v = view
+		}
+		return m.matcher(v, request...)
+	}
+}
+
+// EnforceContext is Enforce for a request made with ctx. The correlation ID of ctx is
+// added to the log lines of the call, including the decision logged at debug level,
+// and ctx bounds the database queries made with WithReadThrough or
+// WithSQLEnforcement.
+func (m *Manager) EnforceContext(ctx context.Context, request ...string) bool {
+	return m.enforce(ctx, "default", m.matcher, request)
+}
+
+// enforce evaluates request with matcher, name labels the measurements
+func (m *Manager) enforce(ctx context.Context, name string, matcher Matcher, request []string) bool {
+	if m.metrics != nil {
+		defer m.observeSince(MetricEnforceSeconds, time.Now(), Labels{"matcher": name})
+	}
+	pseudonymized := m.pseudonymizeRequest(request)
+	allowed := m.evaluate(ctx, matcher, request, pseudonymized)
+	request = pseudonymized
+	if logger := m.log(ctx); logger != nil {
+		if ce := logger.Check(zap.DebugLevel, "enforced request"); ce != nil {
+			ce.Write(zap.Strings("request", request), zap.Bool("allowed", allowed))
+		}
+	}
+	m.auditDecision(request, allowed)
+	m.recordDecision(request, allowed)
+	return allowed
+}
+
+func (m *Manager) decide(ctx context.Context, matcher Matcher, request []string) bool {
+	if !m.Ready() {
+		return m.startup == StartupAllow
+	}
+	if m.sqlOnly {
+		return m.enforceSQL(ctx, request)
+	}
+	if allowed, ok := m.enforceReadThrough(ctx, matcher, request); ok {
+		return allowed
+	}
+	return matcher(m, request...)
+}
+
+// EnforceWithContext evaluates request as if policies p and grouping policies g were
+// stored in addition to the cached ones. The extra rules only live for this call,
+// which makes it possible to model session attributes or just-in-time group
+// membership without writing them to the database. The extra rules are ignored with
+// WithSQLEnforcement.
+func (m *Manager) EnforceWithContext(request []string, p, g [][]string) bool {
+	view := m.contextual(m.pseudonymizeRules("p", p), m.pseudonymizeRules("g", g))
+	return m.enforce(context.Background(), "context", view.bound(), request)
+}
+
+// bound returns the matcher of m evaluating requests against m, whichever manager it
+// is given, for views of a manager to be evaluated through its enforce
+func (m *Manager) bound() Matcher {
+	return func(_ *Manager, request ...string) bool {
+		return m.matcher(m, request...)
+	}
+}
+
+// view returns a manager sharing the cached rules and the matching configuration of m,
+// but without any connection, to evaluate requests against modified rules.
+func (m *Manager) view() *Manager {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
+	origin := m
+	if m.origin != nil {
+		origin = m.origin
+	}
+	return &Manager{
+		matcher:        m.matcher,
+		matchers:       m.matchers,
+		requestMatcher: m.requestMatcher,
+		namespaces:     m.namespaces,
+		sources:        m.sources,
+		domainSep:      m.domainSep,
+		objectSep:      m.objectSep,
+		impliedBy:      m.impliedBy,
+		actionType:     m.actionType,
+		attrs:          m.attrs,
+		pseudonymSalt:  m.pseudonymSalt,
+		clock:          m.clock,
+		p:              m.p,
+		g:              m.g,
+		extra:          m.extra,
+		origin:         origin,
+		// views can't be written to
+		closed: 1,
+	}
+}
+
+// contextual returns a read-only view of m whose lookups also see rules p and g
+func (m *Manager) contextual(p, g [][]string) *Manager {
+	view := m.view()
+	view.ctxP, view.ctxG = Policies{}, Policies{}
+	for _, rule := range p {
+		view.ctxP.Insert(padRule(rule))
+	}
+	for _, rule := range g {
+		view.ctxG.Insert(padRule(rule))
+	}
+	return view
+}
+
+// WithNamedMatcher registers an additional matcher under name, to be used with
+// EnforceWith. This lets one manager serve requests of different shapes.
+func WithNamedMatcher(name string, matcher Matcher) Option {
+	return func(m *Manager) {
+		if m.matchers == nil {
+			m.matchers = map[string]Matcher{}
+		}
+		m.matchers[name] = matcher
+	}
+}
+
+// EnforceWith evaluates request with the matcher registered under name. It returns
+// ErrMatcherNotFound if there is no such matcher, and ErrNotReady before the rules are
+// loaded with StartupError.
+func (m *Manager) EnforceWith(name string, request ...string) (bool, error) {
+	matcher, ok := m.matchers[name]
+	if !ok {
+		return false, fmt.Errorf("tulip.EnforceWith: %w: %q", ErrMatcherNotFound, name)
+	}
+	if !m.Ready() && m.startup == StartupError {
+		return false, fmt.Errorf("tulip.EnforceWith: %w", ErrNotReady)
+	}
+	return m.enforce(context.Background(), name, matcher, request), nil
 }
@@ -0,0 +1,65 @@
+package tulip
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ForwardAuthConfig configures the handler returned by NewForwardAuthHandler
+type ForwardAuthConfig struct {
+	// IdentityHeader names the header carrying the authenticated subject, set by an
+	// authenticating proxy or middleware. Defaults to "X-Forwarded-User".
+	IdentityHeader string
+	// DomainHeader names a header carrying the domain. If empty or absent from the
+	// request, Domain is used.
+	DomainHeader string
+	Domain       string
+}
+
+// NewForwardAuthHandler returns a handler implementing the forward-auth contract of
+// reverse proxies such as Traefik (forwardAuth), Caddy (forward_auth) and NGINX
+// (auth_request). For each subrequest it enforces (subject, domain, path, method),
+// where the path and method of the original request are read from X-Forwarded-Uri
+// and X-Forwarded-Method, or X-Original-URI and X-Original-Method for NGINX. It
+// responds 200 if access is granted, 403 if it isn't and 401 if the request carries no
+// identity.
+func NewForwardAuthHandler(m *Manager, cfg ForwardAuthConfig) http.Handler {
+	if cfg.IdentityHeader == "" {
+		cfg.IdentityHeader = "X-Forwarded-User"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub := r.Header.Get(cfg.IdentityHeader)
+		if sub == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		dom := cfg.Domain
+		if cfg.DomainHeader != "" {
+			if v := r.Header.Get(cfg.DomainHeader); v != "" {
+				dom = v
+			}
+		}
+		uri := firstHeader(r, "X-Forwarded-Uri", "X-Original-URI")
+		method := firstHeader(r, "X-Forwarded-Method", "X-Original-Method")
+		u, err := url.ParseRequestURI(uri)
+		if err != nil || method == "" {
+			http.Error(w, "missing or invalid forwarded request", http.StatusBadRequest)
+			return
+		}
+		if !m.Enforce(sub, dom, u.Path, method) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// firstHeader returns the first non-empty value among headers
+func firstHeader(r *http.Request, headers ...string) string {
+	for _, h := range headers {
+		if v := r.Header.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package tulip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardAuthHandler(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"alice", "web", "/reports", "GET"}, SourceLocal)
+	h := NewForwardAuthHandler(m, ForwardAuthConfig{Domain: "web"})
+
+	for _, c := range []struct {
+		headers map[string]string
+		status  int
+	}{
+		{map[string]string{"X-Forwarded-User": "alice", "X-Forwarded-Uri": "/reports?year=2021", "X-Forwarded-Method": "GET"}, http.StatusOK},
+		{map[string]string{"X-Forwarded-User": "alice", "X-Original-URI": "/reports", "X-Original-Method": "GET"}, http.StatusOK},
+		{map[string]string{"X-Forwarded-User": "alice", "X-Forwarded-Uri": "/reports", "X-Forwarded-Method": "POST"}, http.StatusForbidden},
+		{map[string]string{"X-Forwarded-User": "bob", "X-Forwarded-Uri": "/reports", "X-Forwarded-Method": "GET"}, http.StatusForbidden},
+		{map[string]string{"X-Forwarded-Uri": "/reports", "X-Forwarded-Method": "GET"}, http.StatusUnauthorized},
+		{map[string]string{"X-Forwarded-User": "alice"}, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, c.status, rec.Code, "%v", c.headers)
+	}
+}
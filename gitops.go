@@ -0,0 +1,307 @@
+package tulip
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ParsePolicyCSV reads rules in the CSV format of Casbin policy files, one rule per
+// line starting with its type:
+//
+//	p, alice, uni, class_a, teach
+//	g, bob, teacher, uni
+//
+// Spaces after commas, empty lines and lines starting with # are ignored. Rules are
+// returned by type, in the order read.
+func ParsePolicyCSV(r io.Reader) (map[string][][]string, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	res := map[string][][]string{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tulip.ParsePolicyCSV: %w", err)
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) < 2 || record[0] == "" {
+			return nil, fmt.Errorf("tulip.ParsePolicyCSV: line %d: rule has no values", line)
+		}
+		if len(record)-1 > ruleWidth {
+			return nil, fmt.Errorf("tulip.ParsePolicyCSV: line %d: rule has %d values, at most %d are supported",
+				line, len(record)-1, ruleWidth)
+		}
+		res[record[0]] = append(res[record[0]], record[1:])
+	}
+}
+
+// PolicyRepo lists the rules that should be stored by type, e.g. policy files kept
+// under version control
+type PolicyRepo interface {
+	Rules(ctx context.Context) (map[string][][]string, error)
+}
+
+// PolicyRepoFunc adapts a function to PolicyRepo
+type PolicyRepoFunc func(ctx context.Context) (map[string][][]string, error)
+
+func (f PolicyRepoFunc) Rules(ctx context.Context) (map[string][][]string, error) {
+	return f(ctx)
+}
+
+// DirRepo returns a repo reading the rules of every file with extension ".csv"
+// under dir, in the format of ParsePolicyCSV
+func DirRepo(dir string) PolicyRepo {
+	return PolicyRepoFunc(func(ctx context.Context) (map[string][][]string, error) {
+		return readPolicyDir(dir)
+	})
+}
+
+func readPolicyDir(dir string) (map[string][][]string, error) {
+	res := map[string][][]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".csv" {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rules, err := ParsePolicyCSV(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for ptype, l := range rules {
+			res[ptype] = append(res[ptype], l...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tulip.DirRepo: %w", err)
+	}
+	return res, nil
+}
+
+// GitRepo reads policy files from a Git repository, like DirRepo. The repository
+// is cloned into Dir on first use and brought up to date with the remote branch on
+// every call, discarding local changes. It requires the git executable.
+type GitRepo struct {
+	// URL is the repository to clone
+	URL string
+	// Branch to follow, the remote's default branch if empty
+	Branch string
+	// Path is the directory holding the policy files within the repository, the root
+	// if empty
+	Path string
+	// Dir is where the repository is checked out
+	Dir string
+}
+
+func (s *GitRepo) Rules(ctx context.Context) (map[string][][]string, error) {
+	if err := s.update(ctx); err != nil {
+		return nil, fmt.Errorf("tulip.GitRepo: %w", err)
+	}
+	return readPolicyDir(filepath.Join(s.Dir, s.Path))
+}
+
+func (s *GitRepo) update(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(s.Dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		args := []string{"clone", "--depth", "1"}
+		if s.Branch != "" {
+			args = append(args, "--branch", s.Branch)
+		}
+		return git(ctx, "", append(args, "--", s.URL, s.Dir)...)
+	} else if err != nil {
+		return err
+	}
+	ref := "HEAD"
+	if s.Branch != "" {
+		ref = s.Branch
+	}
+	if err := git(ctx, s.Dir, "fetch", "--depth", "1", "origin", ref); err != nil {
+		return err
+	}
+	return git(ctx, s.Dir, "reset", "--hard", "FETCH_HEAD")
+}
+
+func git(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// policyDiff compares the cached rules with desired
+func (m *Manager) policyDiff(desired map[string][][]string) []Change {
+	current := m.snapshot()
+	ptypes := map[string]bool{}
+	for ptype := range current {
+		ptypes[ptype] = true
+	}
+	want := map[string]Policies{}
+	for ptype, rules := range desired {
+		ptypes[ptype] = true
+		p := Policies{}
+		for _, rule := range rules {
+			p.Insert(padRule(m.pseudonymizeRule(ptype, rule)))
+		}
+		want[ptype] = p
+	}
+	sorted := make([]string, 0, len(ptypes))
+	for ptype := range ptypes {
+		sorted = append(sorted, ptype)
+	}
+	sort.Strings(sorted)
+	var res []Change
+	for _, ptype := range sorted {
+		added, removed := diffPolicies(current[ptype], want[ptype])
+		for _, rule := range added {
+			res = append(res, Change{Op: EventInsert, PType: ptype, Rule: trimRule(rule)})
+		}
+		for _, rule := range removed {
+			res = append(res, Change{Op: EventRemove, PType: ptype, Rule: trimRule(rule)})
+		}
+	}
+	return res
+}
+
+// Reconcile makes desired, rules by type, the exact set of stored rules, adding the
+// missing rules and removing the others. It returns the changes made.
+func (m *Manager) Reconcile(desired map[string][][]string) ([]Change, error) {
+	changes := m.policyDiff(desired)
+	var added, removed []typedRules
+	for _, c := range changes {
+		sets := &added
+		if c.Op == EventRemove {
+			sets = &removed
+		}
+		if n := len(*sets); n > 0 && (*sets)[n-1].ptype == c.PType {
+			(*sets)[n-1].rules = append((*sets)[n-1].rules, c.Rule)
+		} else {
+			*sets = append(*sets, typedRules{c.PType, [][]string{c.Rule}})
+		}
+	}
+	if len(added) > 0 {
+		if _, err := m.addRules(added, time.Time{}); err != nil {
+			return nil, fmt.Errorf("tulip.Reconcile: %w", err)
+		}
+	}
+	if len(removed) > 0 {
+		if err := m.removeRules(removed); err != nil {
+			return nil, fmt.Errorf("tulip.Reconcile: %w", err)
+		}
+	}
+	return changes, nil
+}
+
+// Reconciler periodically makes the stored rules match a PolicyRepo, such as a Git
+// repository of policy files, for policy as code. The reconciler owns every rule:
+// rules added by other means are removed on the next sync. The number of rules that
+// differ from the repo is reported to the metrics collector as MetricReconcileDriftRules,
+// and the changes made are reported by Events like any other change.
+type Reconciler struct {
+	m        *Manager
+	repo     PolicyRepo
+	interval time.Duration
+
+	// OnSync, if set, is called with the outcome of each sync
+	OnSync func(changes []Change, err error)
+}
+
+// NewReconciler returns a reconciler syncing the rules of m with repo every interval
+// once started with Run. An interval of zero or less defaults to DefaultSyncPeriod.
+func NewReconciler(m *Manager, repo PolicyRepo, interval time.Duration) *Reconciler {
+	if interval <= 0 {
+		interval = DefaultSyncPeriod
+	}
+	return &Reconciler{
+		m:        m,
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Sync reconciles the rules once
+func (r *Reconciler) Sync(ctx context.Context) ([]Change, error) {
+	desired, err := r.repo.Rules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.Reconciler.Sync: listing rules: %w", err)
+	}
+	changes, err := r.m.Reconcile(desired)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.Reconciler.Sync: %w", err)
+	}
+	r.reportDrift(changes)
+	return changes, nil
+}
+
+func (r *Reconciler) reportDrift(changes []Change) {
+	if r.m.metrics == nil {
+		return
+	}
+	inserted, removed := 0, 0
+	for _, c := range changes {
+		if c.Op == EventRemove {
+			removed++
+		} else {
+			inserted++
+		}
+	}
+	r.m.metricSet(MetricReconcileDriftRules, float64(inserted), Labels{"op": string(EventInsert)})
+	r.m.metricSet(MetricReconcileDriftRules, float64(removed), Labels{"op": string(EventRemove)})
+}
+
+// Run syncs immediately then every interval until ctx is done, which it returns.
+// Failed syncs are logged and retried at the next interval.
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		changes, err := r.Sync(ctx)
+		if logger := r.m.log(ctx); logger != nil {
+			if err != nil {
+				logger.Error("policy reconciliation failed", zap.Error(err))
+			} else if len(changes) > 0 {
+				logger.Info("policy drift corrected", zap.Int("changes", len(changes)))
+			}
+		}
+		if r.OnSync != nil {
+			r.OnSync(changes, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
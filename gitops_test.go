@@ -0,0 +1,97 @@
+package tulip
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicyCSV(t *testing.T) {
+	rules, err := ParsePolicyCSV(strings.NewReader(`
+# teachers
+p, teacher, uni, class_a, teach
+p,  admin , uni, "grades, final", write
+
+g, aaron, teacher, uni
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string][][]string{
+		"p": {{"teacher", "uni", "class_a", "teach"}, {"admin", "uni", "grades, final", "write"}},
+		"g": {{"aaron", "teacher", "uni"}},
+	}, rules)
+
+	_, err = ParsePolicyCSV(strings.NewReader("p, a, b\np\n"))
+	assert.EqualError(t, err, "tulip.ParsePolicyCSV: line 2: rule has no values")
+	_, err = ParsePolicyCSV(strings.NewReader("p, 1, 2, 3, 4, 5, 6, 7\n"))
+	assert.Error(t, err)
+}
+
+func TestReconciler(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "roles"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.csv"), []byte("p, teacher, uni, class_a, teach\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "roles", "uni.csv"), []byte("g, aaron, teacher, uni\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("p, ignored, uni\n"), 0644))
+
+	metrics := newTestMetrics()
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain,
+		WithoutPeriodicSync(), WithMetricsCollector(metrics))
+	require.NoError(t, err)
+	defer m.Close()
+	_, err = m.AddPolicies(nil, [][]string{{"mallory", "teacher", "uni"}})
+	require.NoError(t, err)
+
+	r := NewReconciler(m, DirRepo(dir), 0)
+	assert.Equal(t, DefaultSyncPeriod, r.interval)
+	changes, err := r.Sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Op: EventInsert, PType: "g", Rule: []string{"aaron", "teacher", "uni"}},
+		{Op: EventRemove, PType: "g", Rule: []string{"mallory", "teacher", "uni"}},
+		{Op: EventInsert, PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}},
+	}, changes)
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("mallory", "uni", "class_a", "teach"))
+	// the gauge labeled "remove" is set last
+	assert.Equal(t, float64(1), metrics.gauges[MetricReconcileDriftRules])
+
+	changes, err = r.Sync(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestGitRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	origin := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = origin
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	commit := func(content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(origin, "policy.csv"), []byte(content), 0644))
+		git("add", "-A")
+		git("commit", "-q", "-m", "update")
+	}
+	git("init", "-q", "-b", "main")
+	commit("p, teacher, uni, class_a, teach\n")
+
+	repo := &GitRepo{URL: origin, Branch: "main", Dir: filepath.Join(t.TempDir(), "checkout")}
+	rules, err := repo.Rules(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string][][]string{"p": {{"teacher", "uni", "class_a", "teach"}}}, rules)
+
+	commit("g, aaron, teacher, uni\n")
+	rules, err = repo.Rules(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string][][]string{"g": {{"aaron", "teacher", "uni"}}}, rules)
+}
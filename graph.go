@@ -0,0 +1,48 @@
+package tulip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ExportRoleGraph writes the grouping rules of domain as a GraphViz DOT graph with an
+// edge from every member to the role it holds. Roles, i.e. subjects held by others,
+// are drawn as boxes and users as ellipses. Render it with e.g. `dot -Tsvg`.
+func (m *Manager) ExportRoleGraph(w io.Writer, domain string) error {
+	groups := m.FilterGroups("", "", domain)
+	roles := map[string]bool{}
+	users := map[string]bool{}
+	for _, g := range groups {
+		roles[g[1]] = true
+	}
+	for _, g := range groups {
+		if !roles[g[0]] {
+			users[g[0]] = true
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", strconv.Quote(domain))
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	for _, set := range []struct {
+		names map[string]bool
+		shape string
+	}{{users, "ellipse"}, {roles, "box"}} {
+		names := make([]string, 0, len(set.names))
+		for name := range set.names {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(bw, "\t%s [shape=%s];\n", strconv.Quote(name), set.shape)
+		}
+	}
+	for _, g := range groups {
+		fmt.Fprintf(bw, "\t%s -> %s;\n", strconv.Quote(g[0]), strconv.Quote(g[1]))
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,32 @@
+package tulip
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRoleGraph(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"teacher", "staff", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "lab \"x\"", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"carol", "teacher", "lab"}, SourceLocal)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, m.ExportRoleGraph(buf, "uni"))
+	assert.Equal(t, `digraph "uni" {
+	rankdir=LR;
+	"alice" [shape=ellipse];
+	"bob" [shape=ellipse];
+	"lab \"x\"" [shape=box];
+	"staff" [shape=box];
+	"teacher" [shape=box];
+	"alice" -> "teacher";
+	"bob" -> "lab \"x\"";
+	"teacher" -> "staff";
+}
+`, buf.String())
+}
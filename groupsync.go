@@ -0,0 +1,181 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Membership assigns User to Role
+type Membership struct {
+	User string
+	Role string
+}
+
+// GroupSource lists the role memberships held in an external directory, such as the
+// groups of an LDAP or Active Directory server mapped to role names.
+type GroupSource interface {
+	Memberships(ctx context.Context) ([]Membership, error)
+}
+
+// GroupSourceFunc adapts a function to GroupSource
+type GroupSourceFunc func(ctx context.Context) ([]Membership, error)
+
+func (f GroupSourceFunc) Memberships(ctx context.Context) ([]Membership, error) {
+	return f(ctx)
+}
+
+// GroupingDiff lists the grouping rules added and removed by a reconciliation
+type GroupingDiff struct {
+	Added   [][]string
+	Removed [][]string
+}
+
+// membershipRoles returns the roles memberships assign
+func membershipRoles(memberships []Membership) map[string]bool {
+	roles := map[string]bool{}
+	for _, ms := range memberships {
+		roles[ms.Role] = true
+	}
+	return roles
+}
+
+// groupingDiff compares the cached grouping rules of domain giving one of roles with
+// memberships. The rules giving other roles are left out.
+func (m *Manager) groupingDiff(domain string, roles map[string]bool, memberships []Membership) GroupingDiff {
+	desired := Policies{}
+	for _, ms := range memberships {
+		desired.Insert(padRule(m.pseudonymizeRule("g", []string{ms.User, ms.Role, domain})))
+	}
+	current := Policies{}
+	for role := range roles {
+		if role == "" {
+			continue
+		}
+		for _, rule := range m.FilterGroups("", m.Pseudonym(role), domain) {
+			current.Insert(rule)
+		}
+	}
+	added, removed := diffPolicies(current, desired)
+	diff := GroupingDiff{}
+	for _, rule := range added {
+		diff.Added = append(diff.Added, trimRule(rule))
+	}
+	for _, rule := range removed {
+		diff.Removed = append(diff.Removed, trimRule(rule))
+	}
+	return diff
+}
+
+// ReconcileGroupings makes memberships the exact set of members of the roles they
+// assign in domain, adding the missing grouping rules and removing the others. Rules
+// giving other roles, such as role hierarchies, bundle assignments or manual grants,
+// are left alone. It returns the changes made.
+func (m *Manager) ReconcileGroupings(domain string, memberships []Membership) (GroupingDiff, error) {
+	diff, err := m.reconcileGroupings(domain, membershipRoles(memberships), memberships)
+	if err != nil {
+		return diff, fmt.Errorf("tulip.ReconcileGroupings: %w", err)
+	}
+	return diff, nil
+}
+
+// reconcileGroupings makes memberships the exact set of members of roles in domain
+func (m *Manager) reconcileGroupings(domain string, roles map[string]bool, memberships []Membership) (GroupingDiff, error) {
+	diff := m.groupingDiff(domain, roles, memberships)
+	if len(diff.Added) > 0 {
+		if _, err := m.AddPolicies(nil, diff.Added); err != nil {
+			return GroupingDiff{}, err
+		}
+	}
+	if len(diff.Removed) > 0 {
+		if err := m.RemovePolicies(nil, diff.Removed); err != nil {
+			return GroupingDiff{Added: diff.Added}, err
+		}
+	}
+	return diff, nil
+}
+
+// GroupSyncer periodically reconciles the grouping rules of a domain with the
+// memberships of a GroupSource, so that role assignments follow a corporate
+// directory. The syncer owns the members of the roles the source assigns: members
+// added to them by other means are removed on the next sync, while the grouping rules
+// of other roles are left alone. It remembers the roles it synced, so that a role
+// whose last member left the directory is emptied. The roles are only remembered in
+// memory: the members of a role that left the directory while no syncer ran, e.g.
+// across a restart, are kept until removed by other means.
+type GroupSyncer struct {
+	m        *Manager
+	source   GroupSource
+	domain   string
+	interval time.Duration
+	mutex    sync.Mutex
+	roles    map[string]bool
+
+	// OnSync, if set, is called with the outcome of each sync
+	OnSync func(diff GroupingDiff, err error)
+}
+
+// NewGroupSyncer returns a syncer reconciling domain with source every interval once
+// started with Run. An interval of zero or less defaults to DefaultSyncPeriod.
+func NewGroupSyncer(m *Manager, source GroupSource, domain string, interval time.Duration) *GroupSyncer {
+	if interval <= 0 {
+		interval = DefaultSyncPeriod
+	}
+	return &GroupSyncer{
+		m:        m,
+		source:   source,
+		domain:   domain,
+		interval: interval,
+		roles:    map[string]bool{},
+	}
+}
+
+// Sync reconciles the domain once
+func (s *GroupSyncer) Sync(ctx context.Context) (GroupingDiff, error) {
+	memberships, err := s.source.Memberships(ctx)
+	if err != nil {
+		return GroupingDiff{}, fmt.Errorf("tulip.GroupSyncer.Sync: listing memberships: %w", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for role := range membershipRoles(memberships) {
+		s.roles[role] = true
+	}
+	diff, err := s.m.reconcileGroupings(s.domain, s.roles, memberships)
+	if err != nil {
+		return diff, fmt.Errorf("tulip.GroupSyncer.Sync: %w", err)
+	}
+	return diff, nil
+}
+
+// Run syncs immediately then every interval until ctx is done, which it returns.
+// Failed syncs are logged and retried at the next interval.
+func (s *GroupSyncer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		diff, err := s.Sync(ctx)
+		if logger := s.m.logger; logger != nil {
+			if err != nil {
+				logger.Error("group sync failed", zap.String("domain", s.domain), zap.Error(err))
+			} else {
+				logger.Info("group sync done",
+					zap.String("domain", s.domain),
+					zap.Int("added", len(diff.Added)),
+					zap.Int("removed", len(diff.Removed)),
+				)
+			}
+		}
+		if s.OnSync != nil {
+			s.OnSync(diff, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
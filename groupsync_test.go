@@ -0,0 +1,87 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGroupingDiff(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("g", []string{"alice", "eng", "corp"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "eng", "corp"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "eng", "lab"}, SourceLocal)
+	m.cacheInsert("g", []string{"eng", "staff", "corp"}, SourceLocal)
+	m.cacheInsert("g", []string{"dave", "admin", "corp"}, SourceLocal)
+
+	memberships := []Membership{
+		{"alice", "eng"},
+		{"carol", "eng"},
+		{"carol", "eng"},
+	}
+	diff := m.groupingDiff("corp", membershipRoles(memberships), memberships)
+	assert.Equal(t, [][]string{{"carol", "eng", "corp"}}, diff.Added)
+	assert.Equal(t, [][]string{{"bob", "eng", "corp"}}, diff.Removed)
+}
+
+func TestGroupSyncerKeepsOtherRoles(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+	_, err = m.AddPolicies(nil, [][]string{
+		{"eng", "staff", "corp"},
+		{"dave", "admin", "corp"},
+		{"erin", "eng", "corp"},
+	})
+	require.NoError(t, err)
+	_, err = m.AssignBundle("alice", "reader", "corp")
+	require.NoError(t, err)
+
+	memberships := []Membership{{"alice", "eng"}, {"bob", "ops"}}
+	s := NewGroupSyncer(m, GroupSourceFunc(func(ctx context.Context) ([]Membership, error) {
+		return memberships, nil
+	}), "corp", 0)
+	assert.Equal(t, DefaultSyncPeriod, s.interval)
+	diff, err := s.Sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"erin", "eng", "corp"}}, diff.Removed)
+	assert.True(t, m.HasRole("eng", "staff", "corp"))
+	assert.True(t, m.HasRole("dave", "admin", "corp"))
+	assert.True(t, m.HasRole("alice", "reader", "corp"))
+
+	// the last member of ops left the directory
+	memberships = []Membership{{"alice", "eng"}}
+	diff, err = s.Sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "ops", "corp"}}, diff.Removed)
+	assert.Equal(t, 4, m.GroupingPolicyCount())
+}
+
+func testGroupSyncer(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	memberships := []Membership{{"alice", "eng"}, {"bob", "eng"}}
+	s := NewGroupSyncer(m, GroupSourceFunc(func(ctx context.Context) ([]Membership, error) {
+		return memberships, nil
+	}), "corp", 0)
+	ctx := context.Background()
+	diff, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Len(t, diff.Added, 2)
+
+	memberships = []Membership{{"bob", "eng"}}
+	diff, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, diff.Added)
+	assert.Equal(t, [][]string{{"alice", "eng", "corp"}}, diff.Removed)
+	assert.Equal(t, 1, m.GroupingPolicyCount())
+}
@@ -0,0 +1,183 @@
+package tulip
+
+import "strings"
+
+// WithDomainHierarchy treats domains as paths whose segments are separated by sep, such
+// as "org/team/project" with "/". RBACWithDomain then applies grants and role
+// assignments of a domain to all of its descendants, e.g. a role held in "org" grants
+// its "org" permissions in "org/team/project" too.
+//
+// Evaluation looks up each ancestor of the requested domain in the sorted cache, so
+// its cost grows with the depth of the domain rather than with the number of rules.
+func WithDomainHierarchy(sep string) Option {
+	return func(m *Manager) {
+		m.domainSep = sep
+	}
+}
+
+// WithObjectHierarchy treats objects as paths whose segments are separated by sep,
+// such as "folder:/a/b/c" with "/". RBACWithDomain then applies a grant on an object
+// to all of its descendants, e.g. a grant on "folder:/a" allows the same action on
+// "folder:/a/b/c" but not on "folder:/ab". Combine it with WithPrefixIndex(2) to look
+// grants up through the radix tree rather than through the rules of every subject.
+func WithObjectHierarchy(sep string) Option {
+	return func(m *Manager) {
+		m.objectSep = sep
+	}
+}
+
+// WithActionImplication declares actions that imply others, such as
+//
+//	WithActionImplication(map[string][]string{
+//		"admin": {"write"},
+//		"write": {"read"},
+//	})
+//
+// RBACWithDomain then allows an action to anyone granted an action implying it, here
+// "read" to those granted "write" or "admin". Implications are transitive.
+func WithActionImplication(implies map[string][]string) Option {
+	return func(m *Manager) {
+		if m.impliedBy == nil {
+			m.impliedBy = map[string][]string{}
+		}
+		for act, implied := range implies {
+			for _, s := range implied {
+				m.impliedBy[s] = append(m.impliedBy[s], act)
+			}
+		}
+	}
+}
+
+// WithActionGroupings works like WithActionImplication but reads implications from
+// the stored rules of type ptype, such as "g2", of the form (action, implied action),
+// so that they can be changed at runtime.
+func WithActionGroupings(ptype string) Option {
+	return func(m *Manager) {
+		m.actionType = ptype
+	}
+}
+
+// domainAncestors returns dom followed by its ancestors, nearest first
+func (m *Manager) domainAncestors(dom string) []string {
+	doms := []string{dom}
+	if m.domainSep == "" {
+		return doms
+	}
+	for i := strings.LastIndex(dom, m.domainSep); i > 0; i = strings.LastIndex(dom[:i], m.domainSep) {
+		doms = append(doms, dom[:i])
+	}
+	return doms
+}
+
+// hierarchical tells whether RBACWithDomain must go through rbacHierarchical
+func (m *Manager) hierarchical() bool {
+	return m.domainSep != "" || m.objectSep != "" || m.impliedBy != nil || m.actionType != "" ||
+		m.hasBundles()
+}
+
+// grantingActions returns act followed by the actions implying it
+func (m *Manager) grantingActions(act string) []string {
+	acts := []string{act}
+	if m.impliedBy == nil && m.actionType == "" {
+		return acts
+	}
+	seen := map[string]bool{act: true}
+	for i := 0; i < len(acts); i++ {
+		next := m.impliedBy[acts[i]]
+		if m.actionType != "" {
+			for _, rule := range m.FilterType(m.actionType, "", acts[i]) {
+				next = append(next, rule[0])
+			}
+		}
+		for _, a := range next {
+			if !seen[a] {
+				seen[a] = true
+				acts = append(acts, a)
+			}
+		}
+	}
+	return acts
+}
+
+// objectCovers tells whether a grant on object granted applies to obj
+func (m *Manager) objectCovers(granted, obj string) bool {
+	if granted == obj {
+		return true
+	}
+	if m.objectSep == "" || !strings.HasPrefix(obj, granted) {
+		return false
+	}
+	return strings.HasSuffix(granted, m.objectSep) || strings.HasPrefix(obj[len(granted):], m.objectSep)
+}
+
+// findGrant returns the "p" rule granting one of acts on obj to one of subjects in one
+// of doms, along with the position of that subject.
+func (m *Manager) findGrant(subjects, doms []string, obj string, acts []string) ([]string, int) {
+	if m.objectSep != "" && m.prefixIndex != nil && m.prefixIndex.col == 2 {
+		for _, p := range m.FilterPrefixesOf(2, obj) {
+			if !containsString(acts, p[3]) || !m.objectCovers(p[2], obj) || !containsString(doms, p[1]) {
+				continue
+			}
+			for i, s := range subjects {
+				if s == p[0] {
+					return p, i
+				}
+			}
+		}
+		return nil, 0
+	}
+	for i, s := range subjects {
+		for _, d := range doms {
+			if m.objectSep == "" {
+				for _, act := range acts {
+					if p := m.FindExact(s, d, obj, act); p != nil {
+						return p, i
+					}
+				}
+				continue
+			}
+			for _, p := range m.Filter(s, d) {
+				if containsString(acts, p[3]) && m.objectCovers(p[2], obj) {
+					return p, i
+				}
+			}
+		}
+	}
+	return nil, 0
+}
+
+func containsString(sl []string, s string) bool {
+	for _, v := range sl {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// rbacHierarchical is RBACWithDomain for managers configured with hierarchies
+func rbacHierarchical(m *Manager, sub, dom, obj, act string) bool {
+	doms := m.domainAncestors(dom)
+	subjects := []string{sub}
+	var groups Policies
+	for _, d := range doms {
+		for _, g := range m.FilterGroups(sub, "", d) {
+			subjects = append(subjects, g[1])
+			groups = append(groups, g)
+		}
+	}
+	acts := m.grantingActions(act)
+	p, i := m.findGrant(subjects, doms, obj, acts)
+	if p == nil {
+		if b := m.findBundleGrant(subjects, doms, obj, acts); b != nil {
+			m.RecordUsage(BundlePType, b)
+			return true
+		}
+		return false
+	}
+	m.RecordUsage("p", p)
+	if i > 0 {
+		m.RecordUsage("g", groups[i-1])
+	}
+	return true
+}
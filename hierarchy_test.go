@@ -0,0 +1,64 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainHierarchy(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithDomainHierarchy("/")})
+	assert.Equal(t, []string{"org/team/project", "org/team", "org"}, m.domainAncestors("org/team/project"))
+	assert.Equal(t, []string{"/org/team", "/org"}, m.domainAncestors("/org/team"))
+
+	m.cacheInsert("p", []string{"admin", "org", "billing", "read"}, SourceLocal)
+	m.cacheInsert("p", []string{"dev", "org/team", "repo", "push"}, SourceLocal)
+	m.cacheInsert("p", []string{"carol", "org/team/project", "repo", "read"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "admin", "org"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "dev", "org/team/project"}, SourceLocal)
+
+	assert.True(t, m.Enforce("alice", "org/team/project", "billing", "read"))
+	assert.True(t, m.Enforce("bob", "org/team/project", "repo", "push"))
+	assert.False(t, m.Enforce("bob", "org/team", "repo", "push"))
+	assert.True(t, m.Enforce("carol", "org/team/project/x", "repo", "read"))
+	assert.False(t, m.Enforce("carol", "org/team", "repo", "read"))
+	assert.False(t, m.Enforce("alice", "organization", "billing", "read"))
+}
+
+func TestObjectHierarchy(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithObjectHierarchy("/")},
+		{WithObjectHierarchy("/"), WithPrefixIndex(2)},
+	} {
+		m := newManager(RBACWithDomain, opts)
+		m.cacheInsert("p", []string{"alice", "d", "folder:/a", "read"}, SourceLocal)
+		m.cacheInsert("p", []string{"viewer", "d", "folder:/b/", "read"}, SourceLocal)
+		m.cacheInsert("g", []string{"bob", "viewer", "d"}, SourceLocal)
+
+		assert.True(t, m.Enforce("alice", "d", "folder:/a", "read"))
+		assert.True(t, m.Enforce("alice", "d", "folder:/a/b/c", "read"))
+		assert.False(t, m.Enforce("alice", "d", "folder:/ab", "read"))
+		assert.False(t, m.Enforce("alice", "d", "folder:/a/b", "write"))
+		assert.False(t, m.Enforce("alice", "e", "folder:/a/b", "read"))
+		assert.True(t, m.Enforce("bob", "d", "folder:/b/c", "read"))
+		assert.False(t, m.Enforce("bob", "d", "folder:/a/c", "read"))
+	}
+}
+
+func TestActionImplication(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{
+		WithActionImplication(map[string][]string{"admin": {"write"}, "write": {"read"}}),
+		WithActionGroupings("g2"),
+	})
+	m.cacheInsert("p", []string{"alice", "d", "doc", "admin"}, SourceLocal)
+	m.cacheInsert("p", []string{"bob", "d", "doc", "write"}, SourceLocal)
+	m.cacheInsert("p", []string{"carol", "d", "doc", "owner"}, SourceLocal)
+	m.cacheInsert("g2", []string{"owner", "admin"}, SourceLocal)
+
+	assert.Equal(t, []string{"read", "write", "admin", "owner"}, m.grantingActions("read"))
+	assert.True(t, m.Enforce("alice", "d", "doc", "read"))
+	assert.True(t, m.Enforce("bob", "d", "doc", "read"))
+	assert.False(t, m.Enforce("bob", "d", "doc", "admin"))
+	assert.True(t, m.Enforce("carol", "d", "doc", "write"))
+	assert.False(t, m.Enforce("carol", "d", "doc", "delete"))
+}
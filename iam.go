@@ -0,0 +1,163 @@
+package tulip
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// EffectAllow and EffectDeny are the effects, stored as the fifth value of rules
+	// used with IAMMatcher
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// stringOrSlice decodes a JSON string or array of strings
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*s = []string{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+type iamStatement struct {
+	Sid         string          `json:"Sid"`
+	Effect      string          `json:"Effect"`
+	Action      stringOrSlice   `json:"Action"`
+	Resource    stringOrSlice   `json:"Resource"`
+	NotAction   json.RawMessage `json:"NotAction"`
+	NotResource json.RawMessage `json:"NotResource"`
+	Principal   json.RawMessage `json:"Principal"`
+	Condition   json.RawMessage `json:"Condition"`
+}
+
+// ImportIAMPolicy converts an AWS IAM-style JSON policy document into rules
+// (sub, dom, resource, action, effect) granting or denying sub in domain dom, to be
+// evaluated with IAMMatcher. Actions and resources may contain "*" and "?" wildcards.
+// Only Effect, Action and Resource are supported: statements with NotAction,
+// NotResource, Principal or Condition are rejected.
+func ImportIAMPolicy(sub, dom string, doc []byte) ([][]string, error) {
+	var raw struct {
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(doc, &raw); err != nil {
+		return nil, fmt.Errorf("tulip.ImportIAMPolicy: %w", err)
+	}
+	var stmts []iamStatement
+	if err := json.Unmarshal(raw.Statement, &stmts); err != nil {
+		// a single statement may be given as an object
+		var one iamStatement
+		if err := json.Unmarshal(raw.Statement, &one); err != nil {
+			return nil, fmt.Errorf("tulip.ImportIAMPolicy: invalid Statement: %w", err)
+		}
+		stmts = []iamStatement{one}
+	}
+	rules := Policies{}
+	for i, st := range stmts {
+		name := st.Sid
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		for _, f := range []struct {
+			name  string
+			value json.RawMessage
+		}{
+			{"NotAction", st.NotAction},
+			{"NotResource", st.NotResource},
+			{"Principal", st.Principal},
+			{"Condition", st.Condition},
+		} {
+			if f.value != nil {
+				return nil, fmt.Errorf("tulip.ImportIAMPolicy: statement %s: %s is not supported", name, f.name)
+			}
+		}
+		var effect string
+		switch st.Effect {
+		case "Allow":
+			effect = EffectAllow
+		case "Deny":
+			effect = EffectDeny
+		default:
+			return nil, fmt.Errorf("tulip.ImportIAMPolicy: statement %s: invalid Effect %q", name, st.Effect)
+		}
+		if len(st.Action) == 0 || len(st.Resource) == 0 {
+			return nil, fmt.Errorf("tulip.ImportIAMPolicy: statement %s: Action and Resource are required", name)
+		}
+		for _, res := range st.Resource {
+			for _, act := range st.Action {
+				rules.Insert([]string{sub, dom, res, act, effect})
+			}
+		}
+	}
+	return rules, nil
+}
+
+// globMatch reports whether s matches pattern, where "*" matches any sequence of
+// characters and "?" any single character.
+func globMatch(pattern, s string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == s
+	}
+	// backtracking over the last star is enough as stars match any sequence
+	p, i, star, mark := 0, 0, -1, 0
+	for i < len(s) {
+		switch {
+		// a star in the pattern is a wildcard even if s has one at the same place
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// IAMMatcher evaluates requests (sub, dom, obj, act) against rules
+// (sub, dom, resource, action, effect) such as those made by ImportIAMPolicy, where sub
+// is the subject or one of its roles in dom. Resources and actions may contain
+// wildcards. As with IAM, access requires a matching allow rule and no matching deny
+// rule. A rule without effect allows.
+func IAMMatcher(m *Manager, request ...string) bool {
+	sub, dom, obj, act := request[0], request[1], request[2], request[3]
+	subjects := []string{sub}
+	for _, g := range m.FilterGroups(sub, "", dom) {
+		subjects = append(subjects, g[1])
+	}
+	var allowedBy Policies
+	for _, s := range subjects {
+		for _, rule := range m.Filter(s, dom) {
+			if !globMatch(rule[2], obj) || !globMatch(rule[3], act) {
+				continue
+			}
+			if rule[4] == EffectDeny {
+				return false
+			}
+			allowedBy = append(allowedBy, rule)
+		}
+	}
+	for _, rule := range allowedBy {
+		m.RecordUsage("p", rule)
+	}
+	return len(allowedBy) > 0
+}
@@ -0,0 +1,56 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"s3:GetObject", "s3:GetObject", true},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:*Object", "s3:PutObject", true},
+		{"s3:*Object", "s3:PutObjectAcl", false},
+		{"arn:aws:s3:::bucket/*/a?c", "arn:aws:s3:::bucket/x/y/abc", true},
+		{"*", "", true},
+		{"a?", "a", false},
+		{"a*b", "a*xb", true},
+		{"a*b", "a*x", false},
+	} {
+		assert.Equal(t, c.match, globMatch(c.pattern, c.s), "%s %s", c.pattern, c.s)
+	}
+}
+
+func TestImportIAMPolicy(t *testing.T) {
+	rules, err := ImportIAMPolicy("reader", "aws", []byte(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Effect": "Allow", "Action": ["s3:Get*", "s3:List*"], "Resource": "arn:aws:s3:::bucket/*"},
+			{"Sid": "NoSecrets", "Effect": "Deny", "Action": "s3:*", "Resource": "arn:aws:s3:::bucket/secret/*"}
+		]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"reader", "aws", "arn:aws:s3:::bucket/*", "s3:Get*", "allow"},
+		{"reader", "aws", "arn:aws:s3:::bucket/*", "s3:List*", "allow"},
+		{"reader", "aws", "arn:aws:s3:::bucket/secret/*", "s3:*", "deny"},
+	}, rules)
+
+	m := newManager(IAMMatcher, nil)
+	for _, rule := range rules {
+		m.cacheInsert("p", rule, SourceLocal)
+	}
+	m.cacheInsert("g", []string{"alice", "reader", "aws"}, SourceLocal)
+	assert.True(t, m.Enforce("alice", "aws", "arn:aws:s3:::bucket/report.csv", "s3:GetObject"))
+	assert.False(t, m.Enforce("alice", "aws", "arn:aws:s3:::bucket/secret/key", "s3:GetObject"))
+	assert.False(t, m.Enforce("alice", "aws", "arn:aws:s3:::bucket/report.csv", "s3:PutObject"))
+	assert.False(t, m.Enforce("bob", "aws", "arn:aws:s3:::bucket/report.csv", "s3:GetObject"))
+
+	_, err = ImportIAMPolicy("reader", "aws", []byte(`{"Statement": {"Effect": "Allow", "NotAction": "s3:*", "Resource": "*"}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// WithIdempotencyKeys creates a side table, named after the rule table with suffix
+// "_idempotency", recording the keys passed to AddPoliciesWithKey and
+// RemovePoliciesWithKey.
+func WithIdempotencyKeys() Option {
+	return func(m *Manager) {
+		m.idempotency = true
+	}
+}
+
+func idempotencyTableSQL(t string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s_idempotency (
+			key text PRIMARY KEY,
+			op text NOT NULL,
+			result integer NOT NULL DEFAULT 0,
+			created_at timestamptz NOT NULL DEFAULT now()
+		)
+	`, t)
+}
+
+// AddPoliciesWithKey works like AddPolicies but applies the change at most once per
+// key: if key was already used, nothing is written and the number of rules inserted
+// the first time is returned. This lets retried jobs re-issue mutations safely. It
+// requires WithIdempotencyKeys, and returns ErrIdempotencyKeyReused if key was used
+// with RemovePoliciesWithKey.
+func (m *Manager) AddPoliciesWithKey(key string, pRules, gRules [][]string) (inserted int, err error) {
+	inserted, err = m.addRulesOnce([]typedRules{{"p", pRules}, {"g", gRules}}, time.Time{}, key)
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddPoliciesWithKey: %w", err)
+	}
+	return inserted, nil
+}
+
+// RemovePoliciesWithKey works like RemovePolicies but applies the change at most once
+// per key, see AddPoliciesWithKey.
+func (m *Manager) RemovePoliciesWithKey(key string, pRules, gRules [][]string) error {
+	if err := m.removeRulesOnce([]typedRules{{"p", pRules}, {"g", gRules}}, key); err != nil {
+		return fmt.Errorf("tulip.RemovePoliciesWithKey: %w", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys forgets keys recorded more than olderThan ago, after which they
+// can be reused. It returns the number of keys removed.
+func (m *Manager) PurgeIdempotencyKeys(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if m.isClosed() {
+		return 0, fmt.Errorf("tulip.PurgeIdempotencyKeys: %w", ErrClosed)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return 0, fmt.Errorf("tulip.PurgeIdempotencyKeys: %w", err)
+	}
+	tag, err := m.pool.Exec(ctx,
+		fmt.Sprintf("DELETE FROM %s_idempotency WHERE created_at < $1", m.tableName),
+		time.Now().Add(-olderThan),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("tulip.PurgeIdempotencyKeys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// claimKey records key for op in tx. If key was recorded before, it returns the
+// result stored with it and true. Concurrent claims of the same key wait for the
+// first transaction to finish.
+func (m *Manager) claimKey(ctx context.Context, tx pgx.Tx, key, op string) (result int, done bool, err error) {
+	if !m.idempotency {
+		return 0, false, fmt.Errorf("idempotency keys require WithIdempotencyKeys")
+	}
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s_idempotency (key, op) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING
+	`, m.tableName), key, op)
+	if err != nil {
+		return 0, false, err
+	}
+	if tag.RowsAffected() > 0 {
+		return 0, false, nil
+	}
+	var prevOp string
+	err = tx.QueryRow(ctx,
+		fmt.Sprintf("SELECT op, result FROM %s_idempotency WHERE key = $1", m.tableName), key,
+	).Scan(&prevOp, &result)
+	if err != nil {
+		return 0, false, err
+	}
+	if prevOp != op {
+		return 0, false, fmt.Errorf("%w: %q was used to %s", ErrIdempotencyKeyReused, key, prevOp)
+	}
+	return result, true, nil
+}
+
+// storeKeyResult saves the result of the operation key was claimed for
+func (m *Manager) storeKeyResult(ctx context.Context, tx pgx.Tx, key string, result int) error {
+	_, err := tx.Exec(ctx,
+		fmt.Sprintf("UPDATE %s_idempotency SET result = $2 WHERE key = $1", m.tableName), key, result,
+	)
+	return err
+}
@@ -0,0 +1,43 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testIdempotencyKeys(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithIdempotencyKeys(),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	p := [][]string{{"teacher", "uni", "class_a", "teach"}}
+	g := [][]string{{"aaron", "teacher", "uni"}}
+	inserted, err := m.AddPoliciesWithKey("job-1", p, g)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inserted)
+
+	require.NoError(t, m.RemovePolicies(nil, g))
+	// the retry reports the first result without adding the membership back
+	inserted, err = m.AddPoliciesWithKey("job-1", p, g)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inserted)
+	assert.Equal(t, 0, m.GroupingPolicyCount())
+
+	err = m.RemovePoliciesWithKey("job-1", p, nil)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+	require.NoError(t, m.RemovePoliciesWithKey("job-2", p, nil))
+	assert.Equal(t, 0, m.PolicyCount())
+
+	n, err := m.PurgeIdempotencyKeys(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
@@ -0,0 +1,54 @@
+package tulip
+
+import "fmt"
+
+// WithIndexes creates a btree index on each of columns when the table is created, so
+// that server-side lookups such as RemoveFilteredPolicies and QueryPolicies stay fast
+// on large tables. Columns are named as in DefaultColumns, such as "v0" or "p_type",
+// even if they are renamed with WithColumns. Indexes aren't supported with normalized
+// tables.
+func WithIndexes(columns ...string) Option {
+	return func(m *Manager) {
+		m.indexes = append(m.indexes, columns...)
+	}
+}
+
+// column returns the identifier of the column named name in DefaultColumns
+func (c columns) column(name string) (string, bool) {
+	switch name {
+	case DefaultColumns.ID:
+		return c.id, true
+	case DefaultColumns.PType:
+		return c.ptype, true
+	case DefaultColumns.EffectiveFrom:
+		return c.from, true
+	}
+	for i, v := range DefaultColumns.Values {
+		if name == v {
+			return c.v[i], true
+		}
+	}
+	return "", false
+}
+
+// checkIndexes returns an error if an index column given to WithIndexes is unknown
+func (m *Manager) checkIndexes() error {
+	for _, name := range m.indexes {
+		if _, ok := m.cols.column(name); !ok {
+			return fmt.Errorf("unknown index column %q", name)
+		}
+	}
+	return nil
+}
+
+func indexSQL(t string, c columns, names []string) []string {
+	var stmts []string
+	for _, name := range names {
+		col, ok := c.column(name)
+		if !ok {
+			continue
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s_idx ON %s (%s)", t, name, t, col))
+	}
+	return stmts
+}
@@ -0,0 +1,35 @@
+package tulip
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// originParam is the session parameter holding the instance ID of the manager that
+// opened the connection, read by the notification trigger
+const originParam = "tulip.origin"
+
+// WithInstanceID identifies the manager in the notifications of the changes it makes,
+// defaulting to a random ID. A manager skips the notifications of its own changes,
+// which it applied to its cache when making them, and Stats counts notifications by
+// instance ID. When a change fails without telling whether it was committed, as when
+// the connection drops before the commit is acknowledged, the manager reloads its
+// cache instead. IDs must be unique among the managers sharing a table.
+func WithInstanceID(id string) Option {
+	return func(m *Manager) {
+		m.instanceID = id
+	}
+}
+
+// InstanceID returns the instance ID of the manager, see WithInstanceID
+func (m *Manager) InstanceID() string {
+	return m.instanceID
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
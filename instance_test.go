@@ -0,0 +1,35 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceID(t *testing.T) {
+	assert.Len(t, newManager(nil, nil).InstanceID(), 16)
+	assert.NotEqual(t, newManager(nil, nil).InstanceID(), newManager(nil, nil).InstanceID())
+
+	m := newManager(RBACWithDomain, []Option{WithInstanceID("web-1")})
+	assert.Equal(t, "web-1", m.InstanceID())
+	cfg, err := pgx.ParseConfig("postgres://localhost/tulip")
+	require.NoError(t, err)
+	require.NoError(t, m.configureConn(context.Background(), cfg))
+	assert.Equal(t, "web-1", cfg.RuntimeParams[originParam])
+
+	// the manager already applied its own change
+	m.applyNotifications([]policyNotification{
+		{Op: "INSERT", PType: "p", Rule: []string{"alice", "uni", "class_a", "teach"}, Origin: "web-1"},
+		{Op: "INSERT", PType: "p", Rule: []string{"bob", "uni", "class_a", "teach"}, Origin: "web-2"},
+		{Op: "INSERT", PType: "p", Rule: []string{"carol", "uni", "class_a", "teach"}},
+		{Op: "DELETE", PType: "p", Rule: []string{"carol", "uni", "class_a", "teach"}, Origin: "web-2"},
+		{Op: opSync, Token: "abc"},
+	})
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.True(t, m.Enforce("bob", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("carol", "uni", "class_a", "teach"))
+	assert.Equal(t, map[string]int64{"web-1": 1, "web-2": 2, "": 1}, m.Stats().NotificationsByOrigin)
+}
@@ -0,0 +1,76 @@
+package tulip
+
+import "sort"
+
+// IntegrityKind classifies an IntegrityFinding
+type IntegrityKind string
+
+const (
+	// IntegrityEmptyRole is a grouping rule whose role grants nothing in its domain
+	IntegrityEmptyRole IntegrityKind = "empty_role"
+	// IntegrityUnknownSubject is a policy whose subject appears in no grouping rule
+	IntegrityUnknownSubject IntegrityKind = "unknown_subject"
+	// IntegrityDuplicateMembership is a grouping rule assigning a role that the member
+	// already holds through another role
+	IntegrityDuplicateMembership IntegrityKind = "duplicate_membership"
+)
+
+// IntegrityFinding describes a rule that leaves the store inconsistent or untidy
+type IntegrityFinding struct {
+	Kind  IntegrityKind
+	PType string
+	Rule  []string
+	// Related is the grouping rule through which the role of a duplicate membership is
+	// also held
+	Related []string
+}
+
+// CheckIntegrity scans the cached "p" rules (sub, dom, obj, act) and "g" rules
+// (user, role, dom) for:
+//
+//   - grouping rules whose role has no policies, bundle or role of its own in the
+//     domain
+//   - policies whose subject is neither a member nor a role in any grouping rule
+//   - grouping rules duplicating a membership held through another role
+//
+// Findings are sorted by kind, then by rule.
+func (m *Manager) CheckIntegrity() []IntegrityFinding {
+	sets := m.snapshot()
+	p, g := sets["p"], sets["g"]
+	var res []IntegrityFinding
+
+	known := map[string]bool{}
+	for _, rule := range g {
+		known[rule[0]] = true
+		known[rule[1]] = true
+	}
+	for _, rule := range p {
+		if !known[rule[0]] {
+			res = append(res, IntegrityFinding{Kind: IntegrityUnknownSubject, PType: "p", Rule: trimRule(rule)})
+		}
+	}
+
+	for _, rule := range g {
+		sub, role, dom := rule[0], rule[1], rule[2]
+		if len(p.Filter(role, dom)) == 0 && len(g.Filter(role, "", dom)) == 0 &&
+			len(sets[BundlePType].Filter(role)) == 0 {
+			res = append(res, IntegrityFinding{Kind: IntegrityEmptyRole, PType: "g", Rule: trimRule(rule)})
+		}
+		for _, other := range g.Filter(sub, "", dom) {
+			if other[1] != role && g.Find([]string{other[1], role, dom}) != nil {
+				res = append(res, IntegrityFinding{
+					Kind: IntegrityDuplicateMembership, PType: "g", Rule: trimRule(rule), Related: trimRule(other),
+				})
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return compareRules(res[i].Rule, res[j].Rule) < 0
+	})
+	return res
+}
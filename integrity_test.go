@@ -0,0 +1,23 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"staff", "uni", "library", "enter"}, SourceLocal)
+	m.cacheInsert("p", []string{"ghost", "uni", "library", "enter"}, SourceLocal)
+	m.cacheInsert("g", []string{"teacher", "staff", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "staff", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "janitor", "uni"}, SourceLocal)
+
+	assert.Equal(t, []IntegrityFinding{
+		{Kind: IntegrityDuplicateMembership, PType: "g", Rule: []string{"alice", "staff", "uni"}, Related: []string{"alice", "teacher", "uni"}},
+		{Kind: IntegrityEmptyRole, PType: "g", Rule: []string{"bob", "janitor", "uni"}},
+		{Kind: IntegrityUnknownSubject, PType: "p", Rule: []string{"ghost", "uni", "library", "enter"}},
+	}, m.CheckIntegrity())
+}
@@ -0,0 +1,30 @@
+package tulip
+
+// interner deduplicates strings so that equal values share one backing array
+type interner map[string]string
+
+func (in interner) intern(s string) string {
+	if v, ok := in[s]; ok {
+		return v
+	}
+	in[s] = s
+	return s
+}
+
+// internRule replaces each value of rule in place with its interned copy
+func (in interner) internRule(rule []string) []string {
+	for i, s := range rule {
+		rule[i] = in.intern(s)
+	}
+	return rule
+}
+
+// WithStringInterning makes the manager keep a single copy of each distinct rule
+// value. Domains, actions and role names usually repeat across many rules, so this
+// cuts memory use considerably on large policy sets at the cost of a map lookup per
+// value when loading. The intern table is rebuilt on every full load.
+func WithStringInterning() Option {
+	return func(m *Manager) {
+		m.interner = interner{}
+	}
+}
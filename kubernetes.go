@@ -0,0 +1,160 @@
+package tulip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KubernetesClusterDomain is the domain of rules imported from cluster-wide objects
+// such as ClusterRoleBindings
+const KubernetesClusterDomain = "*"
+
+type k8sObject struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Rules []struct {
+		APIGroups       []string `yaml:"apiGroups"`
+		Resources       []string `yaml:"resources"`
+		ResourceNames   []string `yaml:"resourceNames"`
+		NonResourceURLs []string `yaml:"nonResourceURLs"`
+		Verbs           []string `yaml:"verbs"`
+	} `yaml:"rules"`
+	RoleRef struct {
+		Kind string `yaml:"kind"`
+		Name string `yaml:"name"`
+	} `yaml:"roleRef"`
+	Subjects []struct {
+		Kind      string `yaml:"kind"`
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"subjects"`
+	Items []k8sObject `yaml:"items"`
+}
+
+// objects returns the permission grants of a Role or ClusterRole as objects, e.g.
+// "pods", "deployments.apps/web" or "/healthz".
+func (o *k8sObject) objects() (res []struct{ obj, verb string }) {
+	for _, rule := range o.Rules {
+		var objs []string
+		groups := rule.APIGroups
+		if len(groups) == 0 {
+			groups = []string{""}
+		}
+		for _, group := range groups {
+			for _, resource := range rule.Resources {
+				obj := resource
+				if group != "" {
+					obj += "." + group
+				}
+				if len(rule.ResourceNames) == 0 {
+					objs = append(objs, obj)
+				}
+				for _, name := range rule.ResourceNames {
+					objs = append(objs, obj+"/"+name)
+				}
+			}
+		}
+		objs = append(objs, rule.NonResourceURLs...)
+		for _, obj := range objs {
+			for _, verb := range rule.Verbs {
+				res = append(res, struct{ obj, verb string }{obj, verb})
+			}
+		}
+	}
+	return res
+}
+
+// ImportKubernetesRBAC converts Kubernetes Role, ClusterRole, RoleBinding and
+// ClusterRoleBinding manifests read from r, either as a YAML stream or as a List
+// as printed by `kubectl get -o yaml`, into rules for RBACWithDomain with the
+// namespace as domain:
+//
+//   - a Role named reader in namespace dev becomes p rules ("role:reader", "dev",
+//     object, verb), where object is "pods", "deployments.apps" or
+//     "deployments.apps/web" for a named resource
+//   - a ClusterRole named admin becomes the same rules for "clusterrole:admin" in
+//     KubernetesClusterDomain, and in every namespace where a RoleBinding refers to it
+//   - each binding subject becomes a g rule such as ("user:alice", "role:reader",
+//     "dev"), ("group:eng", ...) or ("serviceaccount:dev:ci", ...)
+//
+// Wildcards such as "*" verbs are copied verbatim. Other kinds are ignored. The
+// returned rules are sorted and free of duplicates, ready for AddPolicies.
+func ImportKubernetesRBAC(r io.Reader) (pRules, gRules [][]string, err error) {
+	var objs []k8sObject
+	dec := yaml.NewDecoder(r)
+	for {
+		var o k8sObject
+		if err := dec.Decode(&o); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, fmt.Errorf("tulip.ImportKubernetesRBAC: %w", err)
+		}
+		if o.Kind == "List" {
+			objs = append(objs, o.Items...)
+		} else {
+			objs = append(objs, o)
+		}
+	}
+
+	clusterRoles := map[string]*k8sObject{}
+	for i := range objs {
+		if objs[i].Kind == "ClusterRole" {
+			clusterRoles[objs[i].Metadata.Name] = &objs[i]
+		}
+	}
+	p, g := Policies{}, Policies{}
+	grant := func(o *k8sObject, role, domain string) {
+		for _, ov := range o.objects() {
+			p.Insert([]string{role, domain, ov.obj, ov.verb})
+		}
+	}
+	for i := range objs {
+		o := &objs[i]
+		ns := o.Metadata.Namespace
+		switch o.Kind {
+		case "Role":
+			grant(o, "role:"+o.Metadata.Name, ns)
+		case "ClusterRole":
+			grant(o, "clusterrole:"+o.Metadata.Name, KubernetesClusterDomain)
+		case "RoleBinding", "ClusterRoleBinding":
+			domain := ns
+			if o.Kind == "ClusterRoleBinding" {
+				domain = KubernetesClusterDomain
+			}
+			var role string
+			switch o.RoleRef.Kind {
+			case "Role":
+				role = "role:" + o.RoleRef.Name
+			case "ClusterRole":
+				role = "clusterrole:" + o.RoleRef.Name
+				if cr, ok := clusterRoles[o.RoleRef.Name]; ok && domain != KubernetesClusterDomain {
+					grant(cr, role, domain)
+				}
+			default:
+				return nil, nil, fmt.Errorf("tulip.ImportKubernetesRBAC: %s %q refers to unknown role kind %q", o.Kind, o.Metadata.Name, o.RoleRef.Kind)
+			}
+			for _, s := range o.Subjects {
+				var sub string
+				switch s.Kind {
+				case "User":
+					sub = "user:" + s.Name
+				case "Group":
+					sub = "group:" + s.Name
+				case "ServiceAccount":
+					sub = "serviceaccount:" + s.Namespace + ":" + s.Name
+				default:
+					return nil, nil, fmt.Errorf("tulip.ImportKubernetesRBAC: %s %q has subject of unknown kind %q", o.Kind, o.Metadata.Name, s.Kind)
+				}
+				g.Insert([]string{sub, role, domain})
+			}
+		}
+	}
+	return p, g, nil
+}
@@ -0,0 +1,87 @@
+package tulip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportKubernetesRBAC(t *testing.T) {
+	p, g, err := ImportKubernetesRBAC(strings.NewReader(`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: reader
+  namespace: dev
+rules:
+- apiGroups: [""]
+  resources: [pods]
+  verbs: [get, list]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: read-pods
+  namespace: dev
+subjects:
+- kind: User
+  name: alice
+- kind: ServiceAccount
+  name: ci
+  namespace: dev
+roleRef:
+  kind: Role
+  name: reader
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRole
+  metadata:
+    name: deployer
+  rules:
+  - apiGroups: [apps]
+    resources: [deployments]
+    resourceNames: [web]
+    verbs: [update]
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: deploy-web
+    namespace: prod
+  subjects:
+  - kind: Group
+    name: eng
+  roleRef:
+    kind: ClusterRole
+    name: deployer
+---
+kind: ConfigMap
+metadata:
+  name: ignored
+`))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"clusterrole:deployer", "*", "deployments.apps/web", "update"},
+		{"clusterrole:deployer", "prod", "deployments.apps/web", "update"},
+		{"role:reader", "dev", "pods", "get"},
+		{"role:reader", "dev", "pods", "list"},
+	}, p)
+	assert.Equal(t, [][]string{
+		{"group:eng", "clusterrole:deployer", "prod"},
+		{"serviceaccount:dev:ci", "role:reader", "dev"},
+		{"user:alice", "role:reader", "dev"},
+	}, g)
+
+	_, _, err = ImportKubernetesRBAC(strings.NewReader(`
+kind: RoleBinding
+metadata:
+  name: bad
+roleRef:
+  kind: Unknown
+`))
+	assert.Error(t, err)
+}
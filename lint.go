@@ -0,0 +1,121 @@
+package tulip
+
+import (
+	"sort"
+	"strings"
+)
+
+// LintKind classifies a LintFinding
+type LintKind string
+
+const (
+	// LintDuplicate is a rule stored with the same values under several types
+	LintDuplicate LintKind = "duplicate"
+	// LintWildcardShadowed is a rule granting nothing more than a wildcard rule does
+	LintWildcardShadowed LintKind = "wildcard_shadowed"
+	// LintRoleShadowed is a rule granted to a subject that also holds it through a role
+	LintRoleShadowed LintKind = "role_shadowed"
+	// LintConflict is an allow rule overridden by a deny rule
+	LintConflict LintKind = "conflict"
+)
+
+// LintFinding describes a rule that is likely unnecessary or wrong
+type LintFinding struct {
+	Kind  LintKind
+	PType string
+	Rule  []string
+	// RelatedPType and Related are the rule that duplicates, shadows or conflicts with
+	// Rule
+	RelatedPType string
+	Related      []string
+}
+
+// Lint scans the cached rules for unnecessary or contradicting ones:
+//
+//   - rules with the same values under different types, such as in "p" and "p2"
+//   - "p" rules (sub, dom, obj, act, ...) covered by another rule of the same subject
+//     and domain whose object and action contain "*" wildcards
+//   - "p" rules granted to a subject that holds the same rule through a role in the
+//     domain, as given by "g" rules (sub, role, dom)
+//   - allow rules overridden by a deny rule, with effects as used by IAMMatcher
+//
+// Findings are sorted by kind, then by rule.
+func (m *Manager) Lint() []LintFinding {
+	sets := m.snapshot()
+	var res []LintFinding
+
+	// duplicates across types
+	seen := map[string]string{}
+	var ptypes []string
+	for ptype := range sets {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	for _, ptype := range ptypes {
+		for _, rule := range sets[ptype] {
+			key := strings.Join(rule, "\x00")
+			if other, ok := seen[key]; ok {
+				res = append(res, LintFinding{
+					Kind: LintDuplicate, PType: ptype, Rule: trimRule(rule),
+					RelatedPType: other, Related: trimRule(rule),
+				})
+				continue
+			}
+			seen[key] = ptype
+		}
+	}
+
+	p := sets["p"]
+	effect := func(rule []string) string {
+		if rule[4] == EffectDeny {
+			return EffectDeny
+		}
+		return EffectAllow
+	}
+	covers := func(a, b []string) bool {
+		return globMatch(a[2], b[2]) && globMatch(a[3], b[3])
+	}
+	for _, rule := range p {
+		for _, other := range p.Filter(rule[0], rule[1]) {
+			if stringSliceEqual(rule, other) || !covers(other, rule) {
+				continue
+			}
+			switch {
+			case effect(rule) == EffectAllow && effect(other) == EffectDeny:
+				res = append(res, LintFinding{
+					Kind: LintConflict, PType: "p", Rule: trimRule(rule),
+					RelatedPType: "p", Related: trimRule(other),
+				})
+			case effect(rule) == effect(other) && !covers(rule, other):
+				res = append(res, LintFinding{
+					Kind: LintWildcardShadowed, PType: "p", Rule: trimRule(rule),
+					RelatedPType: "p", Related: trimRule(other),
+				})
+			}
+		}
+	}
+
+	for _, g := range sets["g"] {
+		sub, role, dom := g[0], g[1], g[2]
+		if sub == role {
+			continue
+		}
+		for _, rule := range p.Filter(sub, dom) {
+			viaRole := append([]string{role}, rule[1:]...)
+			if found := p.Find(viaRole); found != nil {
+				res = append(res, LintFinding{
+					Kind: LintRoleShadowed, PType: "p", Rule: trimRule(rule),
+					RelatedPType: "p", Related: trimRule(found),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return compareRules(res[i].Rule, res[j].Rule) < 0
+	})
+	return res
+}
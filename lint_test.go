@@ -0,0 +1,45 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	m := newManager(IAMMatcher, nil)
+	for _, c := range []struct {
+		ptype string
+		rule  []string
+	}{
+		{"p", []string{"alice", "uni", "class_a", "teach"}},
+		{"p2", []string{"alice", "uni", "class_a", "teach"}},
+		{"p", []string{"alice", "uni", "class_*", "teach"}},
+		{"p", []string{"bob", "uni", "class_a", "grade"}},
+		{"p", []string{"teacher", "uni", "class_a", "grade"}},
+		{"g", []string{"bob", "teacher", "uni"}},
+		{"p", []string{"carol", "uni", "doc", "read", "allow"}},
+		{"p", []string{"carol", "uni", "*", "read", "deny"}},
+	} {
+		m.cacheInsert(c.ptype, c.rule, SourceLocal)
+	}
+
+	assert.Equal(t, []LintFinding{
+		{
+			Kind: LintConflict, PType: "p", Rule: []string{"carol", "uni", "doc", "read", "allow"},
+			RelatedPType: "p", Related: []string{"carol", "uni", "*", "read", "deny"},
+		},
+		{
+			Kind: LintDuplicate, PType: "p2", Rule: []string{"alice", "uni", "class_a", "teach"},
+			RelatedPType: "p", Related: []string{"alice", "uni", "class_a", "teach"},
+		},
+		{
+			Kind: LintRoleShadowed, PType: "p", Rule: []string{"bob", "uni", "class_a", "grade"},
+			RelatedPType: "p", Related: []string{"teacher", "uni", "class_a", "grade"},
+		},
+		{
+			Kind: LintWildcardShadowed, PType: "p", Rule: []string{"alice", "uni", "class_a", "teach"},
+			RelatedPType: "p", Related: []string{"alice", "uni", "class_*", "teach"},
+		},
+	}, m.Lint())
+}
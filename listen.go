@@ -2,22 +2,25 @@ package tulip
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"go.uber.org/zap"
 )
 
-func (m *Manager) createTrigger() error {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
-		b := &pgx.Batch{}
-		b.Queue(fmt.Sprintf("DROP TRIGGER IF EXISTS notify_%s ON %s", m.tableName, m.tableName))
-		b.Queue(fmt.Sprintf(`
-			create or replace function tg_notify_%s ()
+// TriggerSQL returns the statements that install the notification trigger for table
+// tableName. Run them with a privileged role (e.g. from a migration) when the manager
+// is started with WithSkipTriggerCreate.
+func TriggerSQL(tableName string) []string {
+	return newManager(nil, []Option{WithTableName(tableName)}).notifyTriggerSQL()
+}
+
+func triggerSQL(tableName, channel string, c columns) []string {
+	return []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS notify_%s ON %s", tableName, tableName),
+		fmt.Sprintf(`
+			create or replace function tg_notify_%[1]s ()
 			returns trigger
 			language plpgsql
 			as $$
@@ -26,18 +29,22 @@ func (m *Manager) createTrigger() error {
 				begin
 					IF (TG_OP = 'DELETE') THEN
 						PERFORM (
-							with payload(op, p_type, rule) as
+							with payload(v, op, p_type, rule, ts, effective_from, origin) as
 							(
-								select TG_OP, OLD.p_type, ARRAY[OLD.v0, OLD.v1, OLD.v2, OLD.v3, OLD.v4, OLD.v5]
+								select %[6]d, TG_OP, OLD.%[2]s, ARRAY[%[3]s],
+									extract(epoch from clock_timestamp()), OLD.%[4]s,
+									current_setting('%[7]s', true)
 							)
 							select pg_notify(channel, row_to_json(payload)::text)
 							from payload
 						);
 					ELSIF (TG_OP = 'INSERT') THEN
 						PERFORM (
-							with payload(op, p_type, rule) as
+							with payload(v, op, p_type, rule, ts, effective_from, origin) as
 							(
-								select TG_OP, NEW.p_type, ARRAY[NEW.v0, NEW.v1, NEW.v2, NEW.v3, NEW.v4, NEW.v5]
+								select %[6]d, TG_OP, NEW.%[2]s, ARRAY[%[5]s],
+									extract(epoch from clock_timestamp()), NEW.%[4]s,
+									current_setting('%[7]s', true)
 							)
 							select pg_notify(channel, row_to_json(payload)::text)
 							from payload
@@ -46,100 +53,385 @@ func (m *Manager) createTrigger() error {
 					RETURN NULL;
 				end;
 			$$
-		`, m.tableName))
-		b.Queue(fmt.Sprintf(`
+		`, tableName, c.ptype, c.values("OLD."), c.from, c.values("NEW."), notificationVersion, originParam),
+		fmt.Sprintf(`
 			CREATE TRIGGER notify_%s
 			AFTER INSERT OR DELETE
 			ON %s
 			FOR EACH ROW
-			EXECUTE PROCEDURE tg_notify_%s('%s_rules')
-		`, m.tableName, m.tableName, m.tableName, m.tableName))
-		br := tx.SendBatch(context.Background(), b)
-		defer br.Close()
-		for i := 0; i < b.Len(); i++ {
-			_, err := br.Exec()
-			if err != nil {
-				return err
-			}
-		}
-		return br.Close()
-	})
+			EXECUTE PROCEDURE tg_notify_%s('%s')
+		`, tableName, tableName, tableName, channel),
+	}
 }
 
+// channelName returns the notification channel for table tableName
+func channelName(tableName string) string {
+	return tableName + "_rules"
+}
+
+// channel returns the notification channel of the manager's table. Channels are
+// shared by the whole database, so the schema is part of the name if there is one.
+func (m *Manager) channel() string {
+	if m.schema != "" {
+		return channelName(m.schema + "_" + m.tableName)
+	}
+	return channelName(m.tableName)
+}
+
+// notificationVersion is the version of the notification payload. Fields are only ever
+// added to the payload; a new version may also add ops, which listeners that don't
+// know them handle by reloading all policies. Payloads without a version predate
+// versioning and are read as version 0.
+const notificationVersion = 3
+
+// opReload marks a payload the listener couldn't read or decode, which makes it
+// reload all policies rather than lose the change
+const opReload = "RELOAD"
+
 type policyNotification struct {
-	Op    string   `json:"op"`
-	PType string   `json:"p_type"`
-	Rule  []string `json:"rule"`
+	// Version is the version of the payload, see notificationVersion
+	Version int      `json:"v,omitempty"`
+	Op      string   `json:"op"`
+	PType   string   `json:"p_type,omitempty"`
+	Rule    []string `json:"rule,omitempty"`
+	Token   string   `json:"token,omitempty"`
+	// TS is the time the change was made, in seconds since the Unix epoch
+	TS float64 `json:"ts,omitempty"`
+	// EffectiveFrom is the time a scheduled rule takes effect
+	EffectiveFrom *time.Time `json:"effective_from,omitempty"`
+	// ExpiresAt is the time a rule stops applying, nil if it doesn't, see opExpiry
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Origin is the instance ID of the manager that made the change, empty for
+	// changes made by other means, see WithInstanceID
+	Origin string `json:"origin,omitempty"`
+}
+
+const (
+	// minListenBackoff and maxListenBackoff bound the delay between attempts to
+	// re-establish the notification connection
+	minListenBackoff = time.Second
+	maxListenBackoff = time.Minute
+)
+
+// notifier is implemented by storages reporting changes as notifications, which carry
+// more than a StorageChange: sync markers, expiry changes and the instance that made
+// the change. The manager listens to those rather than calling Watch.
+type notifier interface {
+	// listen is Watch for notifications, stopping at the first error of f
+	listen(ctx context.Context, ready func(), f func(policyNotification) error) error
 }
 
-func (m *Manager) listen() {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+// watch keeps watching the storage for changes until the manager is closed. When
+// watching fails it retries with exponential backoff. Each attempt reloads all
+// policies once: a failed one so that the cache keeps up while changes are missed, a
+// successful one to pick up the changes missed meanwhile.
+func (m *Manager) watch() {
+	backoff := minListenBackoff
+	for attempt := 0; ; attempt++ {
+		connected, err := m.watchOnce(attempt > 0)
+		if m.isClosed() {
+			return
+		}
+		if err == nil {
+			// the storage can't be watched
+			m.stats.mutex.Lock()
+			m.stats.listening = false
+			m.stats.mutex.Unlock()
+			return
+		}
+		if connected {
+			backoff = minListenBackoff
+		} else if attempt > 0 {
+			// keep the cache fresh while the storage isn't watched. A successful
+			// reconnect reloads instead, see watchOnce.
+			ctx, cancel := m.closingContext(m.timeouts.query)
+			if _, _, err := m.loadPolicies(ctx); err != nil && m.logger != nil {
+				m.logger.Error("fallback policy load failed", zap.Error(err))
+			}
+			cancel()
+		}
+		m.recordListenError(err)
+		if m.logger != nil {
+			m.logger.Error("notification listener failed, retrying",
+				zap.Error(err),
+				zap.Duration("backoff", backoff),
+			)
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+// watchOnce watches the storage until watching fails or the manager is closed.
+// connected tells whether the storage started reporting changes. After a reconnect all
+// policies are reloaded to pick up changes missed while disconnected.
+func (m *Manager) watchOnce(reconnect bool) (connected bool, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	var err error
-	m.nConn, err = pgx.ConnectConfig(ctx, m.pool.Config().ConnConfig)
-	if err != nil {
-		panic(err)
+	go func() {
+		select {
+		case <-m.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ready := func() {
+		connected = true
+		m.recordListenError(nil)
+		m.listeningOnce.Do(func() { close(m.listening) })
+		if reconnect {
+			loadCtx, cancel := m.closingContext(m.timeouts.query)
+			if _, _, err := m.loadPolicies(loadCtx); err != nil && m.logger != nil {
+				m.logger.Error("error reloading policies after reconnect", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+	if n, ok := m.storage.(notifier); ok {
+		err = m.receive(ctx, n, ready)
+	} else {
+		err = m.storage.Watch(ctx, ready, m.applyChange)
+	}
+	return connected, err
+}
+
+// WithListenerKeepalive sets how long the notification connection may stay idle before
+// it is pinged. A connection that doesn't answer within the same interval is replaced.
+// Defaults to DefaultKeepalive, zero disables pinging.
+func WithListenerKeepalive(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.keepalive = interval
+	}
+}
+
+// stormReloadDelay is how long after a notification storm is detected policies are
+// reloaded, see WithNotificationStormThreshold
+const stormReloadDelay = time.Second
+
+// WithNotificationStormThreshold makes the listener stop applying notifications one by
+// one once more than n arrive within a second, as taking the cache lock for each batch
+// starves Enforce. Notifications are then dropped and all policies are reloaded once,
+// a second after the storm was detected, after which notifications are applied again.
+// Zero, the default, applies every notification.
+func WithNotificationStormThreshold(n int) Option {
+	return func(m *Manager) {
+		m.stormThreshold = n
+	}
+}
+
+// stormDetector counts notifications received within the current second
+type stormDetector struct {
+	threshold   int
+	windowStart time.Time
+	count       int
+}
+
+// add counts n notifications received at now and tells whether they make a storm
+func (d *stormDetector) add(n int, now time.Time) bool {
+	if d.threshold <= 0 {
+		return false
 	}
-	_, err = m.nConn.Exec(ctx, fmt.Sprintf("listen %s_rules", m.tableName))
-	if err != nil {
-		panic(err)
+	if now.Sub(d.windowStart) >= time.Second {
+		d.windowStart, d.count = now, 0
 	}
+	d.count += n
+	return d.count > d.threshold
+}
+
+// receive listens for the notifications of n until listening fails or the manager is
+// closed. Notifications already queued are applied together, under a single lock.
+func (m *Manager) receive(ctx context.Context, n notifier, ready func()) error {
+	ctx, stop := context.WithCancel(ctx)
+	readerDone := make(chan struct{})
+	// the reader must be done before the connection is closed
+	defer func() {
+		stop()
+		<-readerDone
+	}()
 	ch := make(chan policyNotification, 16)
+	errCh := make(chan error, 1)
+	storm := stormDetector{threshold: m.stormThreshold}
+	// reload is set while notifications are dropped, tokens holds the sync markers
+	// dropped meanwhile, resolved once policies are reloaded
+	var reload <-chan time.Time
+	var tokens []string
 	go func() {
-		for {
-			notification, err := m.nConn.WaitForNotification(context.Background())
-			if err != nil {
-				if err == io.ErrUnexpectedEOF && m.nConn.IsClosed() {
-					return
+		defer close(readerDone)
+		errCh <- n.listen(ctx, ready, func(obj policyNotification) error {
+			select {
+			case ch <- obj:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	for {
+		select {
+		case <-m.done:
+			return nil
+		case err := <-errCh:
+			return err
+		case obj := <-ch:
+			// apply whatever else is already queued under the same lock
+			batch := []policyNotification{obj}
+		drain:
+			for len(batch) < cap(ch) {
+				select {
+				case obj := <-ch:
+					batch = append(batch, obj)
+				default:
+					break drain
 				}
-				if m.logger != nil {
-					m.logger.Error("error waiting for notification",
-						zap.Error(err),
-					)
+			}
+			if reload == nil {
+				if obj, ok := unknownNotification(batch); ok {
+					if m.logger != nil {
+						m.logger.Warn("unknown notification, reloading policies",
+							zap.Int("version", obj.Version),
+							zap.String("op", obj.Op),
+						)
+					}
+					reload = time.After(0)
+				} else if storm.add(len(batch), time.Now()) {
+					if m.logger != nil {
+						m.logger.Warn("notification storm, dropping notifications until policies are reloaded",
+							zap.Int("threshold", m.stormThreshold),
+						)
+					}
+					reload = time.After(stormReloadDelay)
+				} else {
+					m.applyNotifications(batch)
+					continue
 				}
 			}
-			obj := policyNotification{}
-			err = json.Unmarshal([]byte(notification.Payload), &obj)
+			for _, obj := range batch {
+				if obj.Op == opSync {
+					tokens = append(tokens, obj.Token)
+				}
+			}
+		case <-reload:
+			loadCtx, cancel := m.closingContext(m.timeouts.query)
+			_, _, err := m.loadPolicies(loadCtx)
+			cancel()
 			if err != nil {
 				if m.logger != nil {
-					m.logger.Error("error unmarshaling json",
-						zap.Error(err),
-					)
+					m.logger.Error("error reloading policies", zap.Error(err))
 				}
+				reload = time.After(stormReloadDelay)
+				continue
+			}
+			reload = nil
+			storm = stormDetector{threshold: m.stormThreshold}
+			for _, token := range tokens {
+				m.resolveSync(token)
 			}
-			ch <- obj
+			tokens = nil
 		}
-	}()
+	}
+}
+
+// unknownNotification returns the first notification of batch the listener doesn't
+// know how to apply, such as one of an op added by a newer payload version
+func unknownNotification(batch []policyNotification) (policyNotification, bool) {
+	for _, obj := range batch {
+		switch obj.Op {
+		case "INSERT", "DELETE", opSync, opExpiry:
+		default:
+			return obj, true
+		}
+	}
+	return policyNotification{}, false
+}
+
+// waitForNotification returns the payload of the next notification received on conn.
+// Whenever none arrives within the keepalive interval it pings the server, so that a
+// connection silently dropped by a NAT or a failover is detected.
+func (m *Manager) waitForNotification(ctx context.Context, conn *pgx.Conn) (string, error) {
+	if m.keepalive <= 0 {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return "", err
+		}
+		return notification.Payload, nil
+	}
 	for {
-		select {
-		case <-m.done:
-			return
-		case obj := <-ch:
-			if m.logger != nil {
-				m.logger.Debug("receive pg notification",
-					zap.String("op", obj.Op),
-					zap.String("ptype", obj.PType),
-					zap.Strings("rule", obj.Rule),
-				)
+		waitCtx, cancel := context.WithTimeout(ctx, m.keepalive)
+		notification, err := conn.WaitForNotification(waitCtx)
+		idle := waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if err == nil {
+			return notification.Payload, nil
+		}
+		if !idle {
+			return "", err
+		}
+		// the deadline only interrupts the read, the connection is still usable
+		pingCtx, cancel := context.WithTimeout(ctx, m.keepalive)
+		err = conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("keepalive ping: %w", err)
+		}
+	}
+}
+
+func (m *Manager) applyNotifications(batch []policyNotification) {
+	start := time.Now()
+	for _, obj := range batch {
+		if obj.TS > 0 {
+			m.observeNotificationLag(start.Sub(time.Unix(0, int64(obj.TS*1e9))))
+		}
+		if m.logger != nil {
+			m.logger.Debug("receive pg notification",
+				zap.String("op", obj.Op),
+				zap.String("ptype", obj.PType),
+				zap.Strings("rule", obj.Rule),
+			)
+		}
+	}
+	m.recordOrigins(batch)
+	report := SyncReport{Source: SyncNotification, Notifications: len(batch)}
+	m.mutex.Lock()
+	for _, obj := range batch {
+		if obj.Origin == m.instanceID {
+			// applied to the cache when it was made
+			continue
+		}
+		switch obj.Op {
+		case "INSERT":
+			if obj.EffectiveFrom != nil && obj.EffectiveFrom.After(start) {
+				m.schedule(obj.PType, obj.Rule, *obj.EffectiveFrom)
+			} else if m.cacheInsert(obj.PType, obj.Rule, SourceRemote) {
+				report.Added++
 			}
-			m.mutex.Lock()
-			switch obj.Op {
-			case "INSERT":
-				switch obj.PType {
-				case "p":
-					m.p.Insert(obj.Rule)
-				case "g":
-					m.g.Insert(obj.Rule)
-				}
-			case "DELETE":
-				switch obj.PType {
-				case "p":
-					m.p.Remove(obj.Rule)
-				case "g":
-					m.g.Remove(obj.Rule)
-				}
+		case "DELETE":
+			if m.cacheRemove(obj.PType, obj.Rule, SourceRemote) {
+				report.Removed++
+			}
+		case opExpiry:
+			added, removed := m.applyExpiry(obj.PType, obj.Rule, obj.ExpiresAt)
+			if added {
+				report.Added++
 			}
-			m.mutex.Unlock()
+			if removed {
+				report.Removed++
+			}
+		}
+	}
+	report.PolicyCount, report.GroupingPolicyCount = m.p.Len(), m.g.Len()
+	m.mutex.Unlock()
+	for _, obj := range batch {
+		if obj.Op == opSync {
+			m.resolveSync(obj.Token)
 		}
 	}
+	report.Duration = time.Since(start)
+	m.syncComplete(report)
 }
@@ -0,0 +1,79 @@
+package tulip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestStormDetector(t *testing.T) {
+	now := time.Now()
+	d := stormDetector{threshold: 10}
+	assert.False(t, d.add(6, now))
+	assert.False(t, d.add(4, now.Add(500*time.Millisecond)))
+	assert.True(t, d.add(1, now.Add(900*time.Millisecond)))
+	assert.False(t, d.add(10, now.Add(time.Second)))
+
+	d = stormDetector{}
+	assert.False(t, d.add(1000, now))
+}
+
+func testNotificationStorm(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithoutPeriodicSync(),
+	)
+	writer, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer writer.Close()
+	reader, err := NewManager(context.Background(), connStr, RBACWithDomain, append(opts, WithNotificationStormThreshold(5))...)
+	require.NoError(t, err)
+	defer reader.Close()
+	<-reader.listening
+
+	var rules [][]string
+	for i := 0; i < 50; i++ {
+		rules = append(rules, []string{fmt.Sprintf("user%d", i), "teacher", "uni"})
+	}
+	_, err = writer.AddPolicies(nil, rules)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, reader.WaitForSync(ctx))
+	assert.Equal(t, 50, reader.GroupingPolicyCount())
+}
+
+func TestNotificationVersions(t *testing.T) {
+	for _, payload := range []string{
+		// version 0, before payloads were versioned
+		`{"op":"INSERT","p_type":"g","rule":["alice","teacher","uni"],"ts":1700000000.5}`,
+		`{"v":1,"op":"INSERT","p_type":"g","rule":["alice","teacher","uni"],"ts":1700000000.5}`,
+		// a newer version adding fields
+		`{"v":2,"op":"INSERT","p_type":"g","rule":["alice","teacher","uni"],"ts":1700000000.5,"origin":"x"}`,
+	} {
+		obj := policyNotification{}
+		require.NoError(t, json.Unmarshal([]byte(payload), &obj), payload)
+		assert.Equal(t, "INSERT", obj.Op)
+		assert.Equal(t, []string{"alice", "teacher", "uni"}, obj.Rule)
+		_, unknown := unknownNotification([]policyNotification{obj})
+		assert.False(t, unknown, payload)
+	}
+
+	obj, unknown := unknownNotification([]policyNotification{
+		{Op: "INSERT"},
+		{Version: 2, Op: "TRUNCATE"},
+		{Op: opSync},
+	})
+	assert.True(t, unknown)
+	assert.Equal(t, "TRUNCATE", obj.Op)
+
+	_, unknown = unknownNotification([]policyNotification{{Op: opReload}})
+	assert.True(t, unknown)
+}
@@ -0,0 +1,182 @@
+package tulip
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// DefaultLeaderInterval is how often a manager tries to become the maintenance leader
+// and the leader checks that it still is, see WithLeaderInterval
+const DefaultLeaderInterval = 10 * time.Second
+
+// MaintenanceTask is a periodic job that must only run on one of the managers sharing a
+// table, such as purging old idempotency keys
+type MaintenanceTask func(ctx context.Context, m *Manager) error
+
+type maintenanceTask struct {
+	name     string
+	interval time.Duration
+	run      MaintenanceTask
+	next     time.Time
+}
+
+// leader elects one manager among those sharing a table to run the maintenance tasks
+type leader struct {
+	interval time.Duration
+	tasks    []*maintenanceTask
+	elected  int32
+}
+
+// WithMaintenance runs task every interval on exactly one of the managers sharing the
+// table, the maintenance leader. The leader is elected by holding a Postgres advisory
+// lock on a dedicated connection; when it is closed or loses its connection the lock is
+// released and another manager takes over within the leader interval, see
+// WithLeaderInterval. Tasks run one at a time, each with a context that is done after
+// its interval or when the manager is closed. Failed tasks are logged and retried at
+// the next interval. An interval of zero or less runs task at every leader interval.
+func WithMaintenance(name string, interval time.Duration, task MaintenanceTask) Option {
+	return func(m *Manager) {
+		if m.leader == nil {
+			m.leader = &leader{}
+		}
+		m.leader.tasks = append(m.leader.tasks, &maintenanceTask{name: name, interval: interval, run: task})
+	}
+}
+
+// WithLeaderInterval sets how often a manager tries to become the maintenance leader,
+// which bounds how long maintenance stops when the leader goes away. It defaults to
+// DefaultLeaderInterval, which is also used for intervals of zero or less.
+func WithLeaderInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.leaderInterval = interval
+	}
+}
+
+// setDefault fills in the intervals of l once all options are applied
+func (l *leader) setDefault(interval time.Duration) {
+	l.interval = interval
+	if l.interval <= 0 {
+		l.interval = DefaultLeaderInterval
+	}
+	for _, task := range l.tasks {
+		if task.interval <= 0 {
+			task.interval = l.interval
+		}
+	}
+}
+
+// PurgeIdempotencyKeysTask returns a maintenance task forgetting the idempotency keys
+// recorded more than olderThan ago, see PurgeIdempotencyKeys
+func PurgeIdempotencyKeysTask(olderThan time.Duration) MaintenanceTask {
+	return func(ctx context.Context, m *Manager) error {
+		_, err := m.PurgeIdempotencyKeys(ctx, olderThan)
+		return err
+	}
+}
+
+// IsLeader tells whether the manager is currently the maintenance leader. It is always
+// false without WithMaintenance.
+func (m *Manager) IsLeader() bool {
+	return m.leader != nil && atomic.LoadInt32(&m.leader.elected) == 1
+}
+
+// startMaintenance starts campaigning for leadership if there are maintenance tasks
+func (m *Manager) startMaintenance() {
+	if m.leader != nil {
+		m.goBackground(m.campaign)
+	}
+}
+
+// campaign tries to become the leader every leader interval until the manager is
+// closed
+func (m *Manager) campaign() {
+	for {
+		if err := m.lead(); err != nil && !m.isClosed() && m.logger != nil {
+			m.logger.Error("maintenance leadership failed", zap.Error(err))
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(m.leader.interval):
+		}
+	}
+}
+
+// lead opens a connection and, if it gets hold of the leader lock, runs the
+// maintenance tasks until the connection fails or the manager is closed
+func (m *Manager) lead() error {
+	ctx, cancel := m.closingContext(m.timeouts.listen)
+	defer cancel()
+	cfg := m.pool.Config().ConnConfig
+	if err := m.configureConn(ctx, cfg); err != nil {
+		return err
+	}
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	// closing the connection releases the lock
+	defer conn.Close(context.Background())
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", m.leaderLockKey()).Scan(&acquired); err != nil {
+		return err
+	}
+	if !acquired {
+		return nil
+	}
+	atomic.StoreInt32(&m.leader.elected, 1)
+	defer atomic.StoreInt32(&m.leader.elected, 0)
+	if m.logger != nil {
+		m.logger.Info("elected maintenance leader", zap.String("table_name", m.tableName))
+	}
+	ticker := time.NewTicker(m.leader.interval)
+	defer ticker.Stop()
+	for {
+		m.runDueTasks(time.Now())
+		select {
+		case <-m.done:
+			return nil
+		case <-ticker.C:
+		}
+		// the lock is held for as long as the connection is alive
+		pingCtx, cancel := m.closingContext(m.timeouts.listen)
+		err := conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// leaderLockKey is the advisory lock held by the maintenance leader
+func (m *Manager) leaderLockKey() int64 {
+	return advisoryLockKey("leader:" + m.qualifiedTableName())
+}
+
+// runDueTasks runs the maintenance tasks whose time has come. Tasks first run right
+// after the manager is first elected.
+func (m *Manager) runDueTasks(now time.Time) {
+	for _, task := range m.leader.tasks {
+		if m.isClosed() {
+			return
+		}
+		if now.Before(task.next) {
+			continue
+		}
+		task.next = now.Add(task.interval)
+		ctx, cancel := m.closingContext(task.interval)
+		err := task.run(ctx, m)
+		cancel()
+		if m.logger != nil {
+			if err != nil {
+				m.logger.Error("maintenance task failed", zap.String("task", task.name), zap.Error(err))
+			} else {
+				m.logger.Debug("maintenance task done", zap.String("task", task.name))
+			}
+		}
+	}
+}
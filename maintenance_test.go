@@ -0,0 +1,82 @@
+package tulip
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRunDueTasks(t *testing.T) {
+	var hourly, daily int
+	m := newManager(nil, []Option{
+		WithLeaderInterval(time.Second),
+		WithMaintenance("hourly", time.Hour, func(ctx context.Context, m *Manager) error {
+			hourly++
+			return nil
+		}),
+		WithMaintenance("daily", 24*time.Hour, func(ctx context.Context, m *Manager) error {
+			daily++
+			return errors.New("boom")
+		}),
+		WithMaintenance("often", 0, func(ctx context.Context, m *Manager) error {
+			return nil
+		}),
+	})
+	assert.Equal(t, time.Second, m.leader.interval)
+	assert.Equal(t, time.Second, m.leader.tasks[2].interval)
+	assert.Equal(t, DefaultLeaderInterval, newManager(nil, []Option{
+		WithMaintenance("hourly", time.Hour, nil),
+		WithLeaderInterval(-time.Second),
+	}).leader.interval)
+	assert.False(t, m.IsLeader())
+
+	now := time.Now()
+	m.runDueTasks(now)
+	m.runDueTasks(now.Add(time.Minute))
+	assert.Equal(t, 1, hourly)
+	assert.Equal(t, 1, daily)
+	m.runDueTasks(now.Add(time.Hour))
+	assert.Equal(t, 2, hourly)
+	assert.Equal(t, 1, daily)
+}
+
+func testMaintenanceLeader(t *testing.T, connStr string, opts []Option) {
+	var runs int32
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithMaintenance("count", time.Hour, func(ctx context.Context, m *Manager) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}),
+		WithLeaderInterval(50*time.Millisecond),
+	)
+	a, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer b.Close()
+
+	retryUntil(t, 50*time.Millisecond, 20, func() bool {
+		return a.IsLeader() || b.IsLeader()
+	}, func() string { return "waiting for a leader" })
+	time.Sleep(200 * time.Millisecond)
+	assert.NotEqual(t, a.IsLeader(), b.IsLeader())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	leader, follower := a, b
+	if b.IsLeader() {
+		leader, follower = b, a
+	}
+	require.NoError(t, leader.Close())
+	retryUntil(t, 50*time.Millisecond, 20, func() bool {
+		return follower.IsLeader() && atomic.LoadInt32(&runs) == 2
+	}, func() string { return "waiting for failover" })
+}
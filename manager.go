@@ -2,10 +2,15 @@ package tulip
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgtype"
@@ -20,72 +25,249 @@ const (
 	DefaultDatabaseName = "tulip"
 	DefaultTimeout      = time.Second * 10
 	DefaultSyncPeriod   = time.Second * 60
+	DefaultKeepalive    = time.Second * 15
 )
 
 // Manager manages access control policies.
 type Manager struct {
-	pool            *pgxpool.Pool
-	tableName       string
-	dbName          string
-	skipDBCreate    bool
-	timeout         time.Duration
-	syncInterval    time.Duration
-	skipTableCreate bool
-	matcher         Matcher
-	p               Policies
-	g               Policies
-	mutex           sync.Mutex
-	nConn           *pgx.Conn
-	done            chan bool
-	ticker          *time.Ticker
-	logger          *zap.Logger
+	pool               *pgxpool.Pool
+	storage            Storage
+	readPool           *pgxpool.Pool
+	replicaConn        interface{}
+	tableName          string
+	schema             string
+	columns            Columns
+	cols               columns
+	dbName             string
+	skipDBCreate       bool
+	timeout            time.Duration
+	timeouts           timeouts
+	retryPolicy        *RetryPolicy
+	instanceID         string
+	leader             *leader
+	leaderInterval     time.Duration
+	warm               *warmStart
+	startup            StartupPolicy
+	ready              int32
+	syncInterval       time.Duration
+	skipTableCreate    bool
+	pollingOnly        bool
+	sqlOnly            bool
+	skipTriggerCreate  bool
+	normalized         bool
+	idempotency        bool
+	snapshots          bool
+	eventLog           bool
+	validation         *ValidationConfig
+	indexes            []string
+	clock              func() time.Time
+	matcher            Matcher
+	p                  Policies
+	g                  Policies
+	extra              map[string]*Policies
+	mutex              sync.RWMutex
+	done               chan bool
+	wg                 sync.WaitGroup
+	listening          chan struct{}
+	listeningOnce      sync.Once
+	keepalive          time.Duration
+	stormThreshold     int
+	syncMutex          sync.Mutex
+	syncWaiters        map[string]chan struct{}
+	eventBufferSize    int
+	events             chan PolicyEvent
+	eventsSubscribed   int32
+	eventsClosed       bool
+	stats              stats
+	metrics            MetricsCollector
+	stalenessThreshold time.Duration
+	readThrough        time.Duration
+	onStale            StalenessFunc
+	maxPolicies        int
+	interner           interner
+	prefixIndex        *prefixIndex
+	syncHook           func(SyncReport)
+	matchers           map[string]Matcher
+	requestMatcher     RequestMatcher
+	namespaces         map[string]map[string][]string
+	fields             map[string][]string
+	sources            []PolicySource
+	domainSep          string
+	objectSep          string
+	impliedBy          map[string][]string
+	actionType         string
+	usage              *usageLog
+	enforceStats       *enforceStats
+	middlewares        []EnforceMiddleware
+	attrs              *attributeCache
+	pending            []pendingRule
+	activation         *time.Timer
+	groupExpiry        bool
+	expiring           []expiringRule
+	expiry             *time.Timer
+	closed             int32
+	readOnly           bool
+	ticker             *time.Ticker
+	logger             *zap.Logger
+	correlationID      func(ctx context.Context) string
+	tlsConfig          *tls.Config
+	runtimeParams      map[string]string
+	passwordFunc       PasswordFunc
+	idFunc             IDFunc
+	codec              Codec
+	pseudonymSalt      []byte
+	webhook            *webhook
+	stmts              statements
+	stmtCacheMode      StatementCacheMode
+	stmtCacheCapacity  int
+	stmtCacheSet       bool
+
+	// ctxP and ctxG hold request-time rules of a view made by contextual
+	ctxP Policies
+	ctxG Policies
+	// groupMemo holds the results of FilterGroups in a view made by memoized
+	groupMemo map[string]Policies
+	// origin is the manager a view was made from, whose cached rules it shares
+	origin *Manager
 }
 
 type Option func(m *Manager)
 
+// PasswordFunc returns the password to use for a new database connection
+type PasswordFunc func(ctx context.Context) (string, error)
+
 // NewManager creates a new manager with connection conn which must either be a PostgreSQL
 // connection string or an instance of *pgx.ConnConfig from package github.com/jackc/pgx/v4.
-func NewManager(conn interface{}, matcher Matcher, opts ...Option) (*Manager, error) {
-	m := &Manager{
-		dbName:       DefaultDatabaseName,
-		tableName:    DefaultTableName,
-		timeout:      DefaultTimeout,
-		syncInterval: DefaultSyncPeriod,
-		matcher:      matcher,
-		done:         make(chan bool),
+// Cancelling ctx aborts startup: connecting, creating the database and schema, and the
+// initial policy load. It doesn't affect the manager once created.
+func NewManager(ctx context.Context, conn interface{}, matcher Matcher, opts ...Option) (*Manager, error) {
+	m := newManager(matcher, opts)
+	if m.pollingOnly && m.syncInterval <= 0 {
+		return nil, fmt.Errorf("tulip.NewManager: polling sync requires a positive interval, got %v", m.syncInterval)
 	}
-	for _, opt := range opts {
-		opt(m)
+	if m.schema != "" && !plainIdentRe.MatchString(m.schema) {
+		return nil, fmt.Errorf("tulip.NewManager: %w: %q", ErrInvalidSchemaName, m.schema)
+	}
+	if m.eventLog && m.normalized {
+		return nil, fmt.Errorf("tulip.NewManager: %w: event log with normalized tables", ErrUnsupported)
+	}
+	if len(m.indexes) > 0 && m.normalized {
+		return nil, fmt.Errorf("tulip.NewManager: %w: indexes with normalized tables", ErrUnsupported)
+	}
+	if err := m.checkIndexes(); err != nil {
+		return nil, fmt.Errorf("tulip.NewManager: %w", err)
+	}
+	if m.validation != nil && m.validation.StrictTrigger && m.normalized {
+		return nil, fmt.Errorf("tulip.NewManager: %w: strict trigger with normalized tables", ErrUnsupported)
+	}
+	if m.groupExpiry && (m.normalized || m.sqlOnly) {
+		return nil, fmt.Errorf("tulip.NewManager: %w: group expiry with normalized tables or SQL enforcement", ErrUnsupported)
 	}
 	var err error
 	if m.skipDBCreate {
-		m.pool, err = connectDatabase(m.dbName, conn)
+		m.pool, err = connectDatabase(ctx, m.dbName, conn, m.configureConn)
 		if err != nil {
-			return nil, fmt.Errorf("tulip.NewManager: %v", err)
+			return nil, fmt.Errorf("tulip.NewManager: %w", err)
 		}
 	} else {
-		m.pool, err = createDatabase(m.dbName, conn)
+		m.pool, err = createDatabase(ctx, m.dbName, conn, m.configureConn)
 		if err != nil {
-			return nil, fmt.Errorf("tulip.NewManager: %v", err)
+			return nil, fmt.Errorf("tulip.NewManager: %w", err)
 		}
 	}
-	if !m.skipTableCreate {
-		if err := m.createTable(); err != nil {
-			return nil, fmt.Errorf("tulip.NewManager: %v", err)
+	if m.replicaConn != nil {
+		m.readPool, err = connectDatabase(ctx, m.dbName, m.replicaConn, m.configureConn)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("tulip.NewManager: connecting to read replica: %w", err)
 		}
 	}
-	if err = m.createTrigger(); err != nil {
-		return nil, fmt.Errorf("tulip.NewManager: %v", err)
+	if err = m.createSchema(ctx); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("tulip.NewManager: %w", err)
+	}
+	m.startWebhook()
+	if m.sqlOnly {
+		m.setReady()
+		m.startMaintenance()
+		return m, nil
 	}
-	go m.listen()
-	if err = m.LoadPolicies(); err != nil {
-		return nil, fmt.Errorf("tulip.NewManager: %v", err)
+	if err = m.start(ctx); err != nil {
+		return nil, fmt.Errorf("tulip.NewManager: %w", err)
 	}
-	m.ticker = time.NewTicker(m.syncInterval)
-	go m.periodicallyRefreshPolicies()
+	m.startMaintenance()
 	return m, nil
 }
 
+// start loads the policies of the storage and keeps the cache in sync with it in the
+// background. It closes the manager if the policies can't be loaded.
+func (m *Manager) start(ctx context.Context) error {
+	warm := m.warmUp(ctx)
+	if !m.pollingOnly {
+		m.goBackground(m.watch)
+	}
+	if warm || m.startup != 0 {
+		m.goBackground(m.initialLoad)
+	} else {
+		loadCtx, cancel := context.WithTimeout(ctx, m.timeouts.query)
+		_, _, err := m.loadPolicies(loadCtx)
+		cancel()
+		if err != nil {
+			// stops the watcher started above
+			m.Close()
+			return err
+		}
+	}
+	if m.syncInterval > 0 {
+		m.ticker = time.NewTicker(m.syncInterval)
+		m.goBackground(m.periodicallyRefreshPolicies)
+	}
+	if m.onStale != nil || m.metrics != nil {
+		m.goBackground(m.monitorStaleness)
+	}
+	return nil
+}
+
+func newManager(matcher Matcher, opts []Option) *Manager {
+	m := &Manager{
+		dbName:          DefaultDatabaseName,
+		tableName:       DefaultTableName,
+		timeout:         DefaultTimeout,
+		syncInterval:    DefaultSyncPeriod,
+		keepalive:       DefaultKeepalive,
+		matcher:         matcher,
+		idFunc:          PolicyID,
+		done:            make(chan bool),
+		listening:       make(chan struct{}),
+		extra:           map[string]*Policies{},
+		syncWaiters:     map[string]chan struct{}{},
+		eventBufferSize: DefaultEventBufferSize,
+	}
+	m.storage = &postgresStorage{m: m}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.timeouts.setDefault(m.timeout)
+	if m.leader != nil {
+		m.leader.setDefault(m.leaderInterval)
+	}
+	if m.instanceID == "" {
+		m.instanceID = newInstanceID()
+	}
+	if m.enforceStats != nil {
+		m.enforceStats.subIndex = m.fieldIndex("sub")
+		m.enforceStats.domIndex = m.fieldIndex("dom")
+	}
+	m.events = make(chan PolicyEvent, m.eventBufferSize)
+	if m.normalized {
+		m.cols = newColumns(DefaultColumns)
+	} else {
+		m.cols = newColumns(m.columns)
+	}
+	m.stmts = newStatements(m)
+	return m
+}
+
 // WithTableName can be used to pass custom table name for Tulip rules
 func WithTableName(tableName string) Option {
 	return func(m *Manager) {
@@ -101,6 +283,14 @@ func WithSkipTableCreate() Option {
 	}
 }
 
+// WithSkipTriggerCreate skips creating the notification trigger and its function while
+// still listening for notifications. The trigger must be installed beforehand, see TriggerSQL.
+func WithSkipTriggerCreate() Option {
+	return func(m *Manager) {
+		m.skipTriggerCreate = true
+	}
+}
+
 // WithTableName can be used to pass custom database name for Tulip rules
 func WithDatabase(dbname string) Option {
 	return func(m *Manager) {
@@ -114,20 +304,128 @@ func WithSkipDatabaseCreate() Option {
 	}
 }
 
-// WithTimeout specifies a Postgres connection timeout for the manager
+// WithTimeout specifies the timeout of the manager's database operations, defaulting
+// to DefaultTimeout. WithDDLTimeout, WithQueryTimeout, WithMutationTimeout and
+// WithListenTimeout override it for some of them.
 func WithTimeout(timeout time.Duration) Option {
 	return func(m *Manager) {
 		m.timeout = timeout
 	}
 }
 
-// WithSyncInterval specifies a different sync interval for the manager
+// timeouts holds the timeouts of each kind of database operation
+type timeouts struct {
+	ddl      time.Duration
+	query    time.Duration
+	mutation time.Duration
+	listen   time.Duration
+}
+
+// setDefault sets the timeouts that weren't given to d
+func (t *timeouts) setDefault(d time.Duration) {
+	for _, v := range []*time.Duration{&t.ddl, &t.query, &t.mutation, &t.listen} {
+		if *v <= 0 {
+			*v = d
+		}
+	}
+}
+
+// WithDDLTimeout specifies the timeout of creating the tables and triggers on startup
+func WithDDLTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.timeouts.ddl = timeout
+	}
+}
+
+// WithQueryTimeout specifies the timeout of reads, including the initial and the
+// periodic loads of all policies, which may need more time than other operations on
+// large tables, and the queries made by WithReadThrough and WithSQLEnforcement.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.timeouts.query = timeout
+	}
+}
+
+// WithMutationTimeout specifies the timeout of writes such as AddPolicies and
+// RemovePolicies. A short timeout keeps writes made while serving requests from
+// holding them up.
+func WithMutationTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.timeouts.mutation = timeout
+	}
+}
+
+// WithListenTimeout specifies the timeout of opening the notification connection and
+// starting to listen on it
+func WithListenTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.timeouts.listen = timeout
+	}
+}
+
+// WithSyncInterval specifies a different sync interval for the manager. An interval of
+// zero or less disables periodic sync, see WithoutPeriodicSync.
 func WithSyncInterval(interval time.Duration) Option {
 	return func(m *Manager) {
 		m.syncInterval = interval
 	}
 }
 
+// WithoutPeriodicSync disables the periodic full reload of policies, leaving the cache
+// to be kept up-to-date by notifications alone. Changes missed while the notification
+// connection is down are still picked up, as the listener reloads all policies while
+// it reconnects.
+func WithoutPeriodicSync() Option {
+	return WithSyncInterval(0)
+}
+
+// WithPollingSync disables LISTEN/NOTIFY entirely: no trigger is created and no
+// dedicated notification connection is opened. Policies are instead reloaded every
+// interval. Use this behind a transaction-pooling proxy such as pgbouncer where
+// LISTEN is not supported.
+func WithPollingSync(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.pollingOnly = true
+		m.syncInterval = interval
+	}
+}
+
+// WithReadOnly rejects all mutations with ErrReadOnly. The manager still loads and
+// follows policies written by others.
+func WithReadOnly() Option {
+	return func(m *Manager) {
+		m.readOnly = true
+	}
+}
+
+// WithMaxPolicies limits the number of rules the manager keeps in memory. Loading a
+// table with more than n rules fails with ErrTooManyPolicies, keeping the previously
+// loaded rules, and rules notified beyond the limit are dropped. Either way Health
+// reports an error until a load succeeds.
+func WithMaxPolicies(n int) Option {
+	return func(m *Manager) {
+		m.maxPolicies = n
+	}
+}
+
+// WithIDFunc specifies how rule ids are computed. Every writer of the table, including
+// other managers, must use the same IDFunc or duplicate rules will go undetected.
+func WithIDFunc(f IDFunc) Option {
+	return func(m *Manager) {
+		m.idFunc = f
+	}
+}
+
+// WithReadReplica routes full loads and QueryPolicies to a read replica, while
+// mutations and LISTEN stay on the primary. conn takes the same forms as the conn
+// argument of NewManager. Loads from a lagging replica can briefly revert changes
+// already applied from notifications, until the next load.
+func WithReadReplica(conn interface{}) Option {
+	return func(m *Manager) {
+		m.replicaConn = conn
+	}
+}
+
 // WithZapLogger specifies a logger for the manager
 func WithZapLogger(logger *zap.Logger) Option {
 	return func(m *Manager) {
@@ -135,14 +433,128 @@ func WithZapLogger(logger *zap.Logger) Option {
 	}
 }
 
+// WithTLSConfig specifies a TLS config used by every connection the manager opens,
+// including the dedicated notification connection.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(m *Manager) {
+		m.tlsConfig = cfg
+	}
+}
+
+// WithStatementTimeout sets the statement_timeout session parameter on every connection
+func WithStatementTimeout(timeout time.Duration) Option {
+	return WithRuntimeParams(map[string]string{
+		"statement_timeout": strconv.FormatInt(timeout.Milliseconds(), 10),
+	})
+}
+
+// WithApplicationName sets the application_name session parameter on every connection
+func WithApplicationName(name string) Option {
+	return WithRuntimeParams(map[string]string{
+		"application_name": name,
+	})
+}
+
+// WithRuntimeParams specifies run-time parameters to set as session defaults on every
+// connection. Params given here take precedence over those in the connection string.
+func WithRuntimeParams(params map[string]string) Option {
+	return func(m *Manager) {
+		if m.runtimeParams == nil {
+			m.runtimeParams = map[string]string{}
+		}
+		for k, v := range params {
+			m.runtimeParams[k] = v
+		}
+	}
+}
+
+// WithPasswordFunc specifies a function that supplies the password each time a new
+// connection is opened. Use it with short-lived credentials such as RDS IAM auth
+// tokens or passwords rotated by Vault.
+func WithPasswordFunc(f PasswordFunc) Option {
+	return func(m *Manager) {
+		m.passwordFunc = f
+	}
+}
+
+// configureConn applies connection level options to cfg
+func (m *Manager) configureConn(ctx context.Context, cfg *pgx.ConnConfig) error {
+	if m.stmtCacheSet {
+		cfg.BuildStatementCache = m.statementCache()
+	}
+	if m.tlsConfig != nil {
+		cfg.TLSConfig = m.tlsConfigFor(cfg.Host)
+		for _, fb := range cfg.Fallbacks {
+			fb.TLSConfig = m.tlsConfigFor(fb.Host)
+		}
+	}
+	if len(m.runtimeParams) > 0 {
+		if cfg.RuntimeParams == nil {
+			cfg.RuntimeParams = map[string]string{}
+		}
+		for k, v := range m.runtimeParams {
+			cfg.RuntimeParams[k] = v
+		}
+	}
+	if m.schema != "" {
+		if cfg.RuntimeParams == nil {
+			cfg.RuntimeParams = map[string]string{}
+		}
+		cfg.RuntimeParams["search_path"] = m.schema
+	}
+	// the parameter is only read by the notification trigger, proxies used with
+	// polling sync may reject it
+	if m.instanceID != "" && !m.pollingOnly {
+		if cfg.RuntimeParams == nil {
+			cfg.RuntimeParams = map[string]string{}
+		}
+		cfg.RuntimeParams[originParam] = m.instanceID
+	}
+	if m.passwordFunc != nil {
+		password, err := m.passwordFunc(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting password: %w", err)
+		}
+		cfg.Password = password
+	}
+	return nil
+}
+
+// tlsConfigFor returns the configured TLS config, defaulting ServerName to host so
+// that certificate verification works against each host the driver may try.
+func (m *Manager) tlsConfigFor(host string) *tls.Config {
+	if m.tlsConfig.ServerName != "" {
+		return m.tlsConfig
+	}
+	cfg := m.tlsConfig.Clone()
+	cfg.ServerName = host
+	return cfg
+}
+
 func (m *Manager) PolicyCount() int {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
 	return m.p.Len()
 }
 
 func (m *Manager) GroupingPolicyCount() int {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
 	return m.g.Len()
 }
 
+// PolicyTypeCount returns the number of cached policies of type ptype
+func (m *Manager) PolicyTypeCount(ptype string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if p := m.policySet(ptype, false); p != nil {
+		return p.Len()
+	}
+	return 0
+}
+
 func (m *Manager) periodicallyRefreshPolicies() {
 	for {
 		select {
@@ -151,8 +563,8 @@ func (m *Manager) periodicallyRefreshPolicies() {
 		case <-m.ticker.C:
 			if m.logger != nil {
 				m.logger.Debug("policies before refresh",
-					zap.Int("policy_count", len(m.p)),
-					zap.Int("group_count", len(m.g)),
+					zap.Int("policy_count", m.PolicyCount()),
+					zap.Int("group_count", m.GroupingPolicyCount()),
 				)
 			}
 			if err := m.LoadPolicies(); err != nil {
@@ -168,43 +580,182 @@ func (m *Manager) periodicallyRefreshPolicies() {
 
 // LoadPolicies loads policies from database.
 func (m *Manager) LoadPolicies() error {
+	ctx, cancel := m.closingContext(m.timeouts.query)
+	defer cancel()
+	if _, _, err := m.loadPolicies(ctx); err != nil {
+		return fmt.Errorf("tulip.LoadPolicies: %w", err)
+	}
+	return nil
+}
+
+// Refresh reloads all policies from the database right away and reports how many
+// cached rules were added and removed as a result.
+func (m *Manager) Refresh(ctx context.Context) (added, removed int, err error) {
+	added, removed, err = m.loadPolicies(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("tulip.Refresh: %w", err)
+	}
+	return added, removed, nil
+}
+
+func (m *Manager) loadPolicies(ctx context.Context) (added, removed int, err error) {
+	if m.isClosed() {
+		return 0, 0, ErrClosed
+	}
+	start := time.Now()
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	var pType, v0, v1, v2, v3, v4, v5 pgtype.Text
-	m.p = m.p[:0]
-	m.g = m.g[:0]
-	_, err := m.pool.QueryFunc(
-		ctx,
-		fmt.Sprintf(`SELECT "p_type", "v0", "v1", "v2", "v3", "v4", "v5" FROM %s`, m.tableName),
-		nil,
-		[]interface{}{&pType, &v0, &v1, &v2, &v3, &v4, &v5},
-		func(pgx.QueryFuncRow) error {
-			switch pType.String {
-			case "p":
-				m.p = append(m.p, []string{v0.String, v1.String, v2.String, v3.String, v4.String, v5.String})
-			case "g":
-				m.g = append(m.g, []string{v0.String, v1.String, v2.String, v3.String, v4.String, v5.String})
-			}
+	var p, g Policies
+	var pending []pendingRule
+	var expiring []expiringRule
+	var extra map[string]*Policies
+	var in interner
+	n := 0
+	add := func(r StoredRule) error {
+		n++
+		if m.maxPolicies > 0 && n > m.maxPolicies {
+			return fmt.Errorf("%w: table has more than %d rules", ErrTooManyPolicies, m.maxPolicies)
+		}
+		rule := r.Rule
+		if in != nil {
+			in.internRule(rule)
+		}
+		if !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(start) {
 			return nil
-		},
-	)
+		}
+		if r.EffectiveFrom.After(start) {
+			pending = append(pending, pendingRule{r.PType, rule, r.EffectiveFrom})
+			return nil
+		}
+		if !r.ExpiresAt.IsZero() {
+			expiring = append(expiring, expiringRule{r.PType, rule, r.ExpiresAt})
+		}
+		switch r.PType {
+		case "p":
+			p = append(p, rule)
+		case "g":
+			g = append(g, rule)
+		default:
+			set, ok := extra[r.PType]
+			if !ok {
+				set = &Policies{}
+				extra[r.PType] = set
+			}
+			*set = append(*set, rule)
+		}
+		return nil
+	}
+	err = m.retry(ctx, func() error {
+		p, g, pending, expiring, extra, n = nil, nil, nil, nil, map[string]*Policies{}, 0
+		if m.interner != nil {
+			in = interner{}
+		}
+		return m.storage.Load(ctx, func(r StoredRule) error {
+			r.Rule = padRule(r.Rule)
+			return add(r)
+		})
+	})
 	if err != nil {
-		return err
+		m.recordLoadError(err)
+		if logger := m.log(ctx); logger != nil {
+			logger.Debug("error loading policies", zap.Error(err))
+		}
+		return 0, 0, err
+	}
+	sort.Sort(p)
+	sort.Sort(g)
+	for _, set := range extra {
+		sort.Sort(*set)
+	}
+	added, removed = m.replaceCache(p, g, extra)
+	m.replacePending(pending)
+	m.replaceExpiring(expiring)
+	if in != nil {
+		m.interner = in
 	}
-	sort.Sort(m.p)
-	sort.Sort(m.g)
-	if m.logger != nil {
-		m.logger.Debug("loaded policies",
+	m.recordSync()
+	m.setReady()
+	if logger := m.log(ctx); logger != nil {
+		logger.Debug("loaded policies",
 			zap.Int("policy_count", len(m.p)),
 			zap.Int("group_count", len(m.g)),
+			zap.Int("added", added),
+			zap.Int("removed", removed),
 		)
 	}
-	return nil
+	report := SyncReport{
+		Source:              SyncLoad,
+		PolicyCount:         len(m.p),
+		GroupingPolicyCount: len(m.g),
+		Added:               added,
+		Removed:             removed,
+		Duration:            time.Since(start),
+	}
+	var warm []byte
+	var warmSeq uint64
+	if warm = m.encodeWarmStart(); warm != nil {
+		warmSeq = m.warm.seq
+	}
+	// run the hook without holding the lock so it may use the manager
+	m.mutex.Unlock()
+	m.syncComplete(report)
+	m.saveWarmStart(ctx, warm, warmSeq)
+	m.mutex.Lock()
+	return added, removed, nil
+}
+
+// loadRows calls f with every rule of the table
+func (m *Manager) loadRows(ctx context.Context, f func(StoredRule) error) error {
+	var pType, v0, v1, v2, v3, v4, v5 pgtype.Text
+	var effectiveFrom, expiresAt pgtype.Timestamptz
+	scans := []interface{}{&pType, &v0, &v1, &v2, &v3, &v4, &v5, &effectiveFrom}
+	if m.groupExpiry {
+		scans = append(scans, &expiresAt)
+	}
+	_, err := m.readerPool().QueryFunc(
+		ctx,
+		m.stmts.load,
+		nil,
+		scans,
+		func(pgx.QueryFuncRow) error {
+			r := StoredRule{
+				PType: pType.String,
+				Rule:  []string{v0.String, v1.String, v2.String, v3.String, v4.String, v5.String},
+			}
+			if err := m.decodeValues(r.Rule); err != nil {
+				return err
+			}
+			if effectiveFrom.Status == pgtype.Present {
+				r.EffectiveFrom = effectiveFrom.Time
+			}
+			if expiresAt.Status == pgtype.Present {
+				r.ExpiresAt = expiresAt.Time
+			}
+			return f(r)
+		},
+	)
+	return err
 }
 
-func policyID(ptype string, rule []string) string {
+// IDFunc computes the primary key of a rule
+type IDFunc func(ptype string, rule []string) string
+
+// PolicyID is the default IDFunc. It returns the hex encoded meow checksum of ptype
+// and rule joined with commas, ignoring rule values from the first empty one onward.
+func PolicyID(ptype string, rule []string) string {
+	data := policyIDData(ptype, rule)
+	sum := meow.Checksum(0, data)
+	return fmt.Sprintf("%x", sum)
+}
+
+// SHA256PolicyID is an IDFunc that hashes the same data as PolicyID with SHA-256
+// instead of meow, which is not a cryptographic hash.
+func SHA256PolicyID(ptype string, rule []string) string {
+	sum := sha256.Sum256(policyIDData(ptype, rule))
+	return hex.EncodeToString(sum[:])
+}
+
+func policyIDData(ptype string, rule []string) []byte {
 	end := len(rule)
 	for i, s := range rule {
 		if s == "" {
@@ -212,29 +763,41 @@ func policyID(ptype string, rule []string) string {
 			break
 		}
 	}
-	data := strings.Join(append([]string{ptype}, rule[:end]...), ",")
-	sum := meow.Checksum(0, []byte(data))
-	return fmt.Sprintf("%x", sum)
+	return []byte(strings.Join(append([]string{ptype}, rule[:end]...), ","))
 }
 
-func policyArgs(ptype string, rule []string) []interface{} {
+// checkRule returns ErrEmptyValue if one of the stored values of rule is empty
+func checkRule(ptype string, rule []string) error {
+	for i := 0; i < len(rule) && i < ruleWidth; i++ {
+		if rule[i] == "" {
+			return fmt.Errorf("%w: ptype was %q, rule was %v", ErrEmptyValue, ptype, rule)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) policyArgs(ptype string, rule []string) ([]interface{}, error) {
 	row := make([]interface{}, 8)
 	row[0] = pgtype.Text{
-		String: policyID(ptype, rule),
+		String: m.idFunc(ptype, rule),
 		Status: pgtype.Present,
 	}
 	row[1] = pgtype.Text{
 		String: ptype,
 		Status: pgtype.Present,
 	}
+	if err := checkRule(ptype, rule); err != nil {
+		return nil, err
+	}
 	l := len(rule)
+	values, err := m.encodeValues(rule)
+	if err != nil {
+		return nil, err
+	}
 	for i := 0; i < 6; i++ {
 		if i < l {
-			if rule[i] == "" {
-				panic(fmt.Errorf("can't insert policy with empty value: ptype was %q, rule was %v", ptype, rule))
-			}
 			row[2+i] = pgtype.Text{
-				String: rule[i],
+				String: values[i],
 				Status: pgtype.Present,
 			}
 		} else {
@@ -243,139 +806,311 @@ func policyArgs(ptype string, rule []string) []interface{} {
 			}
 		}
 	}
-	return row
+	return row, nil
 }
 
-func (m *Manager) insertPolicyStmt() string {
-	return fmt.Sprintf(`
-		INSERT INTO %s (id, p_type, v0, v1, v2, v3, v4, v5)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT ON CONSTRAINT %s_pkey DO NOTHING
-	`, m.tableName, m.tableName)
+// readerPool returns the pool to read policies from
+func (m *Manager) readerPool() *pgxpool.Pool {
+	if m.readPool != nil {
+		return m.readPool
+	}
+	return m.pool
 }
 
-// AddPolicy adds a policy rule to the storage.
-func (m *Manager) AddPolicy(ptype string, rule []string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	_, err := m.pool.Exec(ctx,
-		m.insertPolicyStmt(),
-		policyArgs(ptype, rule)...,
-	)
-	return err
+func (m *Manager) isClosed() bool {
+	return atomic.LoadInt32(&m.closed) == 1
 }
 
-// AddPolicies adds policy rules to the storage.
-func (m *Manager) AddPolicies(pRules, gRules [][]string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
-		b := &pgx.Batch{}
-		for _, rule := range pRules {
-			b.Queue(m.insertPolicyStmt(), policyArgs("p", rule)...)
-		}
-		for _, rule := range gRules {
-			b.Queue(m.insertPolicyStmt(), policyArgs("g", rule)...)
-		}
-		br := tx.SendBatch(context.Background(), b)
-		defer br.Close()
-		for range append(pRules, gRules...) {
-			_, err := br.Exec()
-			if err != nil {
-				return err
+// checkWritable returns an error if the manager can't accept mutations
+func (m *Manager) checkWritable() error {
+	if m.isClosed() {
+		return ErrClosed
+	}
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// AddPolicy adds a policy rule to the storage. It reports whether the rule was
+// inserted, which is false without error if the rule was already stored.
+func (m *Manager) AddPolicy(ptype string, rule []string) (inserted bool, err error) {
+	n, err := m.addRules([]typedRules{{ptype, [][]string{rule}}}, time.Time{})
+	if err != nil {
+		return false, fmt.Errorf("tulip.AddPolicy: %w", err)
+	}
+	return n > 0, nil
+}
+
+// CreatePolicy is AddPolicy for callers treating duplicates as conflicts: it returns
+// ErrRuleExists if the rule is already stored.
+func (m *Manager) CreatePolicy(ptype string, rule []string) error {
+	inserted, err := m.AddPolicy(ptype, rule)
+	if err != nil {
+		return fmt.Errorf("tulip.CreatePolicy: %w", err)
+	}
+	if !inserted {
+		return fmt.Errorf("tulip.CreatePolicy: %w", ErrRuleExists)
+	}
+	return nil
+}
+
+// AddPolicies adds policy rules to the storage. It returns the number of rules
+// inserted, rules that are already stored are skipped and not counted.
+func (m *Manager) AddPolicies(pRules, gRules [][]string) (inserted int, err error) {
+	inserted, err = m.addRules([]typedRules{{"p", pRules}, {"g", gRules}}, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddPolicies: %w", err)
+	}
+	return inserted, nil
+}
+
+// AddTypedPolicies adds rules of type ptype, such as "p2", to the storage. It returns the
+// number of rules inserted.
+func (m *Manager) AddTypedPolicies(ptype string, rules [][]string) (inserted int, err error) {
+	inserted, err = m.addRules([]typedRules{{ptype, rules}}, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddTypedPolicies: %w", err)
+	}
+	return inserted, nil
+}
+
+// typedRules is a list of rules sharing the same type
+type typedRules struct {
+	ptype string
+	rules [][]string
+}
+
+// addRules stores rules in a single transaction. Unless from is zero, they only take
+// effect at that time.
+func (m *Manager) addRules(sets []typedRules, from time.Time) (inserted int, err error) {
+	return m.addRulesOnce(sets, from, "")
+}
+
+// addRulesOnce is addRules applying the change at most once per idempotency key,
+// unless key is empty.
+func (m *Manager) addRulesOnce(sets []typedRules, from time.Time, key string) (inserted int, err error) {
+	if err := m.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := m.validateSets(sets); err != nil {
+		return 0, err
+	}
+	sets = m.pseudonymizeSets(sets)
+	inserted, added, done, err := m.insertStored(sets, from, key)
+	if err != nil {
+		return 0, err
+	}
+	if done {
+		// the cache was updated by the call that applied the change, or reloaded if
+		// its outcome was unknown
+		return inserted, nil
+	}
+	m.mutex.Lock()
+	i := 0
+	for _, set := range sets {
+		for _, rule := range set.rules {
+			// a rule already stored keeps its row, scheduled or not. The storage only
+			// reports how many rules were inserted, so its scheduled rules are kept.
+			kept := added != nil && !added[i] || added == nil && m.scheduled(set.ptype, rule)
+			i++
+			switch {
+			case kept:
+				m.unexpire(set.ptype, rule)
+			case from.After(time.Now()):
+				m.schedule(set.ptype, rule, from)
+			default:
+				m.cacheInsert(set.ptype, rule, SourceLocal)
 			}
 		}
-		return br.Close()
-	})
+	}
+	m.mutex.Unlock()
+	return inserted, nil
 }
 
-// RemovePolicy removes a policy rule from the storage.
+// RemovePolicy removes a policy rule from the storage. It returns ErrRuleNotFound if
+// the rule isn't stored.
 func (m *Manager) RemovePolicy(ptype string, rule []string) error {
-	id := policyID(ptype, rule)
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	_, err := m.pool.Exec(ctx,
-		fmt.Sprintf("DELETE FROM %s WHERE id = $1", m.tableName),
-		id,
-	)
-	return err
+	if err := m.checkWritable(); err != nil {
+		return fmt.Errorf("tulip.RemovePolicy: %w", err)
+	}
+	rule = m.pseudonymizeRule(ptype, rule)
+	removed, _, err := m.deleteStored([]typedRules{{ptype, [][]string{rule}}}, "")
+	if err != nil {
+		return fmt.Errorf("tulip.RemovePolicy: %w", err)
+	}
+	m.mutex.Lock()
+	m.cacheRemove(ptype, rule, SourceLocal)
+	m.mutex.Unlock()
+	if removed == 0 {
+		return fmt.Errorf("tulip.RemovePolicy: %w", ErrRuleNotFound)
+	}
+	return nil
 }
 
-// RemovePolicies removes policy rules from the storage.
+// RemovePolicies removes policy rules from the storage. Rules that aren't stored are
+// skipped.
 func (m *Manager) RemovePolicies(pRules, gRules [][]string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
-		b := &pgx.Batch{}
-		for _, rule := range pRules {
-			id := policyID("p", rule)
-			b.Queue(fmt.Sprintf("DELETE FROM %s WHERE id = $1", m.tableName), id)
-		}
-		for _, rule := range gRules {
-			id := policyID("g", rule)
-			b.Queue(fmt.Sprintf("DELETE FROM %s WHERE id = $1", m.tableName), id)
-		}
-		br := tx.SendBatch(context.Background(), b)
-		defer br.Close()
-		for range append(pRules, gRules...) {
-			_, err := br.Exec()
-			if err != nil {
-				return err
-			}
+	if err := m.removeRules([]typedRules{{"p", pRules}, {"g", gRules}}); err != nil {
+		return fmt.Errorf("tulip.RemovePolicies: %w", err)
+	}
+	return nil
+}
+
+// RemoveTypedPolicies removes rules of type ptype, such as "p2", from the storage.
+func (m *Manager) RemoveTypedPolicies(ptype string, rules [][]string) error {
+	if err := m.removeRules([]typedRules{{ptype, rules}}); err != nil {
+		return fmt.Errorf("tulip.RemoveTypedPolicies: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) removeRules(sets []typedRules) error {
+	return m.removeRulesOnce(sets, "")
+}
+
+// removeRulesOnce is removeRules applying the change at most once per idempotency
+// key, unless key is empty.
+func (m *Manager) removeRulesOnce(sets []typedRules, key string) error {
+	if err := m.checkWritable(); err != nil {
+		return err
+	}
+	sets = m.pseudonymizeSets(sets)
+	_, done, err := m.deleteStored(sets, key)
+	if err != nil || done {
+		return err
+	}
+	m.mutex.Lock()
+	for _, set := range sets {
+		for _, rule := range set.rules {
+			m.cacheRemove(set.ptype, rule, SourceLocal)
 		}
-		return br.Close()
-	})
+	}
+	m.mutex.Unlock()
+	return nil
 }
 
+// RemoveFilteredPolicies removes all policies matching pPattern and all grouping
+// policies matching gPattern from the storage. Empty values in a pattern match
+// anything, a nil pattern matches nothing. Matching is done by the database so rules
+// not yet in the cache are removed as well.
 func (m *Manager) RemoveFilteredPolicies(pPattern, gPattern []string) error {
-	var pRules, gRules [][]string
-	if pPattern != nil {
-		pRules = m.Filter(pPattern...)
+	if err := m.checkWritable(); err != nil {
+		return fmt.Errorf("tulip.RemoveFilteredPolicies: %w", err)
 	}
-	if gPattern != nil {
-		gRules = m.FilterGroups(gPattern...)
+	if err := m.checkPostgres(); err != nil {
+		return fmt.Errorf("tulip.RemoveFilteredPolicies: %w", err)
 	}
-	return m.RemovePolicies(pRules, gRules)
+	pPattern, gPattern = m.pseudonymizeRule("p", pPattern), m.pseudonymizeRule("g", gPattern)
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	var removed [2]Policies
+	err := m.retryChange(ctx, func() error {
+		return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+			for i, f := range []struct {
+				ptype   string
+				pattern []string
+			}{
+				{"p", pPattern},
+				{"g", gPattern},
+			} {
+				removed[i] = nil
+				if f.pattern == nil {
+					continue
+				}
+				pattern, err := m.encodeValues(f.pattern)
+				if err != nil {
+					return err
+				}
+				where, args, err := m.cols.filterClause(f.ptype, pattern)
+				if err != nil {
+					return err
+				}
+				var v0, v1, v2, v3, v4, v5 pgtype.Text
+				_, err = tx.QueryFunc(ctx,
+					fmt.Sprintf(`DELETE FROM %s WHERE %s RETURNING %s`, m.tableName, where, m.cols.values("")),
+					args,
+					[]interface{}{&v0, &v1, &v2, &v3, &v4, &v5},
+					func(pgx.QueryFuncRow) error {
+						rule := []string{v0.String, v1.String, v2.String, v3.String, v4.String, v5.String}
+						if err := m.decodeValues(rule); err != nil {
+							return err
+						}
+						removed[i] = append(removed[i], rule)
+						return nil
+					},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("tulip.RemoveFilteredPolicies: %w", err)
+	}
+	m.mutex.Lock()
+	for _, rule := range removed[0] {
+		m.cacheRemove("p", rule, SourceLocal)
+	}
+	for _, rule := range removed[1] {
+		m.cacheRemove("g", rule, SourceLocal)
+	}
+	m.mutex.Unlock()
+	return nil
 }
 
-// Close closes all connections and stops all goroutines
+// Close closes all connections and stops all goroutines, waiting for the listener and
+// the periodic sync to exit. It is safe to call from any goroutine and more than once,
+// calls after the first return right away. It must not be called from callbacks run
+// by those goroutines, such as the one given to WithSyncHook.
 func (m *Manager) Close() error {
-	m.ticker.Stop()
-	if m.done != nil {
-		// send done signal to both go routines
-		m.done <- true
-		m.done <- true
-		m.done = nil
+	if !atomic.CompareAndSwapInt32(&m.closed, 0, 1) {
+		return nil
 	}
+	if m.ticker != nil {
+		m.ticker.Stop()
+	}
+	// signal all go routines to stop and wait for them
+	close(m.done)
+	m.wg.Wait()
+	m.mutex.Lock()
+	m.closeEvents()
+	if m.activation != nil {
+		m.activation.Stop()
+	}
+	if m.expiry != nil {
+		m.expiry.Stop()
+	}
+	m.mutex.Unlock()
 	if m.pool != nil {
 		m.pool.Close()
-		m.pool = nil
 	}
-	if m.nConn != nil {
-		if err := m.nConn.Close(context.Background()); err != nil {
-			return err
-		}
-		m.nConn = nil
+	if m.readPool != nil {
+		m.readPool.Close()
 	}
 	return nil
 }
 
-func (m *Manager) createTable() error {
-	if m.logger != nil {
-		m.logger.Info("creating table", zap.String("table_name", m.tableName))
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-	_, err := m.pool.Exec(ctx, fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id text PRIMARY KEY,
-			p_type text,
-			v0 text,
-			v1 text,
-			v2 text,
-			v3 text,
-			v4 text,
-			v5 text
-		)
-	`, m.tableName))
-	return err
+// closingContext returns a context with timeout that is also cancelled by Close
+func (m *Manager) closingContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	go func() {
+		select {
+		case <-m.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// goBackground runs f in a goroutine that Close waits for
+func (m *Manager) goBackground(f func()) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		f()
+	}()
 }
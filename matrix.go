@@ -0,0 +1,120 @@
+package tulip
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MatrixCell is an action a subject may perform on an object, along with the rule
+// granting it
+type MatrixCell struct {
+	Subject string `json:"subject"`
+	Object  string `json:"object"`
+	Action  string `json:"action"`
+	// Via is the role or bundle the permission is held through, empty if it is granted
+	// to the subject directly
+	Via   string   `json:"via,omitempty"`
+	PType string   `json:"ptype"`
+	Rule  []string `json:"rule"`
+}
+
+// PermissionsMatrix lists the effective permissions of every subject of a domain
+type PermissionsMatrix struct {
+	Domain string       `json:"domain"`
+	Cells  []MatrixCell `json:"cells"`
+}
+
+// PermissionsMatrix computes the effective permissions in domain of every subject
+// holding a role in it or granted anything in it, as evaluated by RBACWithDomain,
+// for access reviews. There is one cell per subject, object and action, granted
+// preferably by a direct rule. Objects and actions are listed as granted, i.e. object
+// hierarchies and action implications are not expanded.
+func (m *Manager) PermissionsMatrix(domain string) *PermissionsMatrix {
+	doms := m.domainAncestors(domain)
+	subjects := map[string]bool{}
+	for _, d := range doms {
+		for _, g := range m.FilterGroups("", "", d) {
+			subjects[g[0]] = true
+		}
+		for _, p := range m.Filter("", d) {
+			subjects[p[0]] = true
+		}
+	}
+
+	res := &PermissionsMatrix{Domain: domain, Cells: []MatrixCell{}}
+	for sub := range subjects {
+		seen := map[string]bool{}
+		add := func(cell MatrixCell) {
+			key := cell.Object + "\x00" + cell.Action
+			if !seen[key] {
+				seen[key] = true
+				cell.Rule = trimRule(cell.Rule)
+				res.Cells = append(res.Cells, cell)
+			}
+		}
+		// grant adds the permissions of holder, the subject itself or one of its roles,
+		// including those of the bundles assigned to a role
+		grant := func(holder, via string) {
+			for _, d := range doms {
+				for _, p := range m.Filter(holder, d) {
+					add(MatrixCell{Subject: sub, Object: p[2], Action: p[3], Via: via, PType: "p", Rule: p})
+				}
+			}
+			bundles := []string{holder}
+			if via != "" {
+				for _, d := range doms {
+					for _, g := range m.FilterGroups(holder, "", d) {
+						bundles = append(bundles, g[1])
+					}
+				}
+			}
+			for _, name := range bundles {
+				for _, b := range m.FilterType(BundlePType, name) {
+					add(MatrixCell{Subject: sub, Object: b[1], Action: b[2], Via: name, PType: BundlePType, Rule: b})
+				}
+			}
+		}
+		grant(sub, "")
+		for _, d := range doms {
+			for _, g := range m.FilterGroups(sub, "", d) {
+				grant(g[1], g[1])
+			}
+		}
+	}
+	sort.Slice(res.Cells, func(i, j int) bool {
+		a, b := res.Cells[i], res.Cells[j]
+		if a.Subject != b.Subject {
+			return a.Subject < b.Subject
+		}
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		return a.Action < b.Action
+	})
+	return res
+}
+
+// WriteCSV writes the matrix as CSV with a header row, one row per cell. Rules are
+// written as their values joined with ", ".
+func (pm *PermissionsMatrix) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"domain", "subject", "object", "action", "via", "ptype", "rule"}); err != nil {
+		return err
+	}
+	for _, c := range pm.Cells {
+		row := []string{pm.Domain, c.Subject, c.Object, c.Action, c.Via, c.PType, strings.Join(c.Rule, ", ")}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the matrix as JSON
+func (pm *PermissionsMatrix) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(pm)
+}
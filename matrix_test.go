@@ -0,0 +1,41 @@
+package tulip
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionsMatrix(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"alice", "lab", "bench", "use"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"teacher", "viewer", "uni"}, SourceLocal)
+	m.cacheInsert(BundlePType, []string{"viewer", "grades", "read"}, SourceLocal)
+
+	pm := m.PermissionsMatrix("uni")
+	assert.Equal(t, []MatrixCell{
+		{Subject: "alice", Object: "class_a", Action: "teach", PType: "p", Rule: []string{"alice", "uni", "class_a", "teach"}},
+		{Subject: "alice", Object: "grades", Action: "read", Via: "viewer", PType: BundlePType, Rule: []string{"viewer", "grades", "read"}},
+		{Subject: "bob", Object: "class_a", Action: "teach", Via: "teacher", PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}},
+		{Subject: "bob", Object: "grades", Action: "read", Via: "viewer", PType: BundlePType, Rule: []string{"viewer", "grades", "read"}},
+		{Subject: "teacher", Object: "class_a", Action: "teach", PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}},
+		{Subject: "teacher", Object: "grades", Action: "read", Via: "viewer", PType: BundlePType, Rule: []string{"viewer", "grades", "read"}},
+	}, pm.Cells)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, m.PermissionsMatrix("lab").WriteCSV(buf))
+	assert.Equal(t, "domain,subject,object,action,via,ptype,rule\nlab,alice,bench,use,,p,\"alice, lab, bench, use\"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, pm.WriteJSON(buf))
+	decoded := &PermissionsMatrix{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), decoded))
+	assert.Equal(t, pm, decoded)
+}
@@ -0,0 +1,87 @@
+package tulip
+
+import "time"
+
+// Names of the metrics reported to a MetricsCollector
+const (
+	// MetricNotificationLagSeconds is a distribution of the delay between a change being
+	// made in the database and its notification being received
+	MetricNotificationLagSeconds = "tulip_notification_lag_seconds"
+	// MetricSecondsSinceLastSync is a gauge of the time elapsed since policies were last
+	// fully loaded
+	MetricSecondsSinceLastSync = "tulip_seconds_since_last_sync"
+	// MetricEnforceSeconds is a distribution of the time taken to evaluate a request,
+	// labeled with "matcher": "default" for Enforce, "view" for Enforcers made by
+	// WithMatcher and the matcher name for EnforceWith
+	MetricEnforceSeconds = "tulip_enforce_seconds"
+	// MetricMatchPhaseSeconds is a distribution of the time RBACWithDomain spends in
+	// each phase of a request, labeled with "phase": "exact" for the lookup of a
+	// policy granted to the subject itself, "groups" for the lookup of its roles and
+	// "filter" for the lookup of the policies granted to them
+	MetricMatchPhaseSeconds = "tulip_match_phase_seconds"
+	// MetricReconcileDriftRules is a gauge of the number of rules a Reconciler found to
+	// differ from its repo at the last sync, labeled with "op": "insert" for missing
+	// rules and "remove" for extra rules
+	MetricReconcileDriftRules = "tulip_reconcile_drift_rules"
+	// MetricEnforceTotal is a counter of evaluated requests, labeled with "domain" and
+	// "decision": "allow" or "deny". It is only collected with WithEnforceStats.
+	MetricEnforceTotal = "tulip_enforce_total"
+)
+
+// Labels qualify a metric sample
+type Labels map[string]string
+
+// MetricsCollector receives the manager's measurements, e.g. to forward them to
+// Prometheus or StatsD. name is one of the Metric constants. Implementations must be
+// safe for concurrent use and must not modify labels.
+type MetricsCollector interface {
+	// Observe adds value to the distribution name
+	Observe(name string, value float64, labels Labels)
+	// Set sets the gauge name to value
+	Set(name string, value float64, labels Labels)
+	// Inc increments the counter name
+	Inc(name string, labels Labels)
+}
+
+// WithMetricsCollector specifies a collector receiving the manager's measurements
+func WithMetricsCollector(c MetricsCollector) Option {
+	return func(m *Manager) {
+		m.metrics = c
+	}
+}
+
+func (m *Manager) metricObserve(name string, value float64, labels Labels) {
+	if m.metrics != nil {
+		m.metrics.Observe(name, value, labels)
+	}
+}
+
+func (m *Manager) metricSet(name string, value float64, labels Labels) {
+	if m.metrics != nil {
+		m.metrics.Set(name, value, labels)
+	}
+}
+
+// labels of MetricMatchPhaseSeconds, allocated once as they are used on every request
+var (
+	exactPhaseLabels  = Labels{"phase": "exact"}
+	groupsPhaseLabels = Labels{"phase": "groups"}
+	filterPhaseLabels = Labels{"phase": "filter"}
+)
+
+// timing returns the current time if measurements are collected, to be given to
+// observeSince, and the zero time otherwise so that requests don't pay for it.
+func (m *Manager) timing() time.Time {
+	if m.metrics == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observeSince adds the time elapsed since start to the distribution name, unless
+// start is zero.
+func (m *Manager) observeSince(name string, start time.Time, labels Labels) {
+	if !start.IsZero() {
+		m.metrics.Observe(name, time.Since(start).Seconds(), labels)
+	}
+}
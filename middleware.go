@@ -0,0 +1,42 @@
+package tulip
+
+import "context"
+
+// EnforceFunc decides whether request is granted
+type EnforceFunc func(ctx context.Context, request []string) bool
+
+// EnforceMiddleware wraps the evaluation of requests, see WithEnforceMiddleware
+type EnforceMiddleware func(next EnforceFunc) EnforceFunc
+
+// WithEnforceMiddleware wraps the evaluation of the requests of Enforce and the other
+// enforcement functions, such as EnforceAll, EnforceWith, EnforceRequest or EnforceAt,
+// with mw, for cross-cutting concerns such as caching decisions, feature flags or a
+// kill switch, without changing the matcher. mw may answer on its own, call next with
+// request or with a modified copy. Requests are passed as given, before
+// pseudonymization, and the decision returned by the outermost middleware is the one
+// logged, audited and counted. Middlewares run in the order given, the first one
+// outermost.
+//
+// Only requests evaluated by a matcher go through mw. Lookups of other rule types,
+// such as Check for relation tuples, EnforceWithUsage for quotas and HasFeature for
+// feature flags, don't.
+func WithEnforceMiddleware(mw EnforceMiddleware) Option {
+	return func(m *Manager) {
+		m.middlewares = append(m.middlewares, mw)
+	}
+}
+
+// evaluate decides request with matcher through the middlewares. pseudonymized is
+// request as returned by pseudonymizeRequest.
+func (m *Manager) evaluate(ctx context.Context, matcher Matcher, request, pseudonymized []string) bool {
+	if len(m.middlewares) == 0 {
+		return m.decide(ctx, matcher, pseudonymized)
+	}
+	next := func(ctx context.Context, request []string) bool {
+		return m.decide(ctx, matcher, m.pseudonymizeRequest(request))
+	}
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		next = m.middlewares[i](next)
+	}
+	return next(ctx, request)
+}
@@ -0,0 +1,78 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnforceMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) EnforceMiddleware {
+		return func(next EnforceFunc) EnforceFunc {
+			return func(ctx context.Context, request []string) bool {
+				calls = append(calls, name)
+				return next(ctx, request)
+			}
+		}
+	}
+	killed := false
+	killSwitch := func(next EnforceFunc) EnforceFunc {
+		return func(ctx context.Context, request []string) bool {
+			if killed {
+				return false
+			}
+			return next(ctx, request)
+		}
+	}
+	// lets "root" act as any subject
+	impersonate := func(next EnforceFunc) EnforceFunc {
+		return func(ctx context.Context, request []string) bool {
+			if request[0] == "root" {
+				request = append([]string{"alice"}, request[1:]...)
+			}
+			return next(ctx, request)
+		}
+	}
+	m := newManager(RBACWithDomain, []Option{
+		WithEnforceMiddleware(trace("outer")),
+		WithEnforceMiddleware(killSwitch),
+		WithEnforceMiddleware(impersonate),
+		WithEnforceMiddleware(trace("inner")),
+		WithEnforceStats(10),
+		WithNamedMatcher("rbac", RBACWithDomain),
+	})
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.True(t, m.Enforce("root", "uni", "class_a", "teach"))
+	assert.False(t, m.WithMatcher(RBACWithDomain).Enforce("bob", "uni", "class_a", "teach"))
+
+	killed = true
+	calls = nil
+	assert.False(t, m.EnforceAll([][]string{{"alice", "uni", "class_a", "teach"}}))
+	assert.Equal(t, []string{"outer"}, calls)
+	assert.Equal(t, EnforceCount{Allowed: 1, Denied: 1}, m.Stats().EnforceBySubject["alice"])
+
+	// every enforcement function goes through the middlewares
+	ok, err := m.EnforceWith("rbac", "alice", "uni", "class_a", "teach")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, m.EnforceRequest(Request{Subject: "alice", Domain: "uni", Object: "class_a", Action: "teach"}))
+	assert.False(t, m.EnforceWithContext([]string{"bob", "uni", "class_a", "teach"}, nil, [][]string{{"bob", "teacher", "uni"}}))
+	assert.False(t, m.EnforceAt(time.Now(), "alice", "uni", "class_a", "teach"))
+
+	killed = false
+	ok, err = m.EnforceWith("rbac", "root", "uni", "class_a", "teach")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, m.EnforceRequest(Request{Subject: "root", Domain: "uni", Object: "class_a", Action: "teach"}))
+	assert.True(t, m.EnforceWithContext([]string{"bob", "uni", "class_a", "teach"}, nil, [][]string{{"bob", "teacher", "uni"}}))
+	assert.True(t, m.EnforceAt(time.Now(), "alice", "uni", "class_a", "teach"))
+	assert.Equal(t, EnforceCount{Allowed: 2, Denied: 4}, m.Stats().EnforceBySubject["alice"])
+}
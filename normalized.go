@@ -0,0 +1,185 @@
+package tulip
+
+import "fmt"
+
+// WithNormalizedSchema stores policies in relational tables instead of a single
+// generic table, so that they can be constrained and joined like any other data.
+// Given table name t, the layout is:
+//
+//	t_subject    (id, name)                             users and roles that are members
+//	t_role       (id, name)                             roles and other grantees
+//	t_grant      (id, role_id, domain, object, action)  "p" rules
+//	t_membership (id, subject_id, role_id, domain)      "g" rules
+//
+// Grants and memberships reference subjects and roles through foreign keys. A view
+// named t presents them as rules in the generic layout, and INSTEAD OF triggers on the
+// view write through to the tables, so the manager itself works unchanged. Only "p"
+// rules of the form (sub, dom, obj, act) and "g" rules of the form (user, role, dom),
+// as used with RBACWithDomain, are supported.
+func WithNormalizedSchema() Option {
+	return func(m *Manager) {
+		m.normalized = true
+	}
+}
+
+func normalizedTableSQL(t string) []string {
+	return []string{
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_subject (
+				id bigserial PRIMARY KEY,
+				name text NOT NULL UNIQUE
+			)
+		`, t),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_role (
+				id bigserial PRIMARY KEY,
+				name text NOT NULL UNIQUE
+			)
+		`, t),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_grant (
+				id text PRIMARY KEY,
+				role_id bigint NOT NULL REFERENCES %s_role (id),
+				domain text NOT NULL,
+				object text NOT NULL,
+				action text NOT NULL,
+				UNIQUE (role_id, domain, object, action)
+			)
+		`, t, t),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_membership (
+				id text PRIMARY KEY,
+				subject_id bigint NOT NULL REFERENCES %s_subject (id),
+				role_id bigint NOT NULL REFERENCES %s_role (id),
+				domain text NOT NULL,
+				UNIQUE (subject_id, role_id, domain)
+			)
+		`, t, t, t),
+		fmt.Sprintf(`
+			CREATE OR REPLACE VIEW %s AS
+				SELECT gr.id, 'p'::text AS p_type, r.name AS v0, gr.domain AS v1, gr.object AS v2,
+					gr.action AS v3, NULL::text AS v4, NULL::text AS v5, NULL::timestamptz AS effective_from
+				FROM %s_grant gr JOIN %s_role r ON r.id = gr.role_id
+				UNION ALL
+				SELECT ms.id, 'g'::text, s.name, r.name, ms.domain, NULL::text, NULL::text, NULL::text,
+					NULL::timestamptz
+				FROM %s_membership ms
+				JOIN %s_subject s ON s.id = ms.subject_id
+				JOIN %s_role r ON r.id = ms.role_id
+		`, t, t, t, t, t, t),
+		fmt.Sprintf(`
+			create or replace function tg_write_%s ()
+			returns trigger
+			language plpgsql
+			as $$
+				declare
+					sid bigint;
+					rid bigint;
+				begin
+					IF (TG_OP = 'DELETE') THEN
+						IF (OLD.p_type = 'p') THEN
+							DELETE FROM %s_grant WHERE id = OLD.id;
+						ELSE
+							DELETE FROM %s_membership WHERE id = OLD.id;
+						END IF;
+						IF NOT FOUND THEN
+							RETURN NULL;
+						END IF;
+						RETURN OLD;
+					END IF;
+					IF (NEW.v4 IS NOT NULL OR NEW.v5 IS NOT NULL) THEN
+						RAISE EXCEPTION 'tulip: %% rule has too many values for the normalized schema', NEW.p_type;
+					END IF;
+					IF (NEW.effective_from IS NOT NULL) THEN
+						RAISE EXCEPTION 'tulip: scheduled rules are not supported by the normalized schema';
+					END IF;
+					IF (NEW.p_type = 'p') THEN
+						INSERT INTO %s_role (name) VALUES (NEW.v0) ON CONFLICT (name) DO NOTHING;
+						SELECT id INTO rid FROM %s_role WHERE name = NEW.v0;
+						INSERT INTO %s_grant (id, role_id, domain, object, action)
+						VALUES (NEW.id, rid, NEW.v1, NEW.v2, NEW.v3) ON CONFLICT DO NOTHING;
+					ELSIF (NEW.p_type = 'g') THEN
+						INSERT INTO %s_subject (name) VALUES (NEW.v0) ON CONFLICT (name) DO NOTHING;
+						SELECT id INTO sid FROM %s_subject WHERE name = NEW.v0;
+						INSERT INTO %s_role (name) VALUES (NEW.v1) ON CONFLICT (name) DO NOTHING;
+						SELECT id INTO rid FROM %s_role WHERE name = NEW.v1;
+						INSERT INTO %s_membership (id, subject_id, role_id, domain)
+						VALUES (NEW.id, sid, rid, NEW.v2) ON CONFLICT DO NOTHING;
+					ELSE
+						RAISE EXCEPTION 'tulip: policy type %% is not supported by the normalized schema', NEW.p_type;
+					END IF;
+					IF NOT FOUND THEN
+						RETURN NULL;
+					END IF;
+					RETURN NEW;
+				end;
+			$$
+		`, t, t, t, t, t, t, t, t, t, t, t),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS write_%s ON %s", t, t),
+		fmt.Sprintf(`
+			CREATE TRIGGER write_%s
+			INSTEAD OF INSERT OR DELETE
+			ON %s
+			FOR EACH ROW
+			EXECUTE PROCEDURE tg_write_%s()
+		`, t, t, t),
+	}
+}
+
+// normalizedTriggerSQL returns the statements that install notification triggers on the
+// grant and membership tables. Notifications carry the same payload as the ones sent
+// by TriggerSQL.
+func normalizedTriggerSQL(t, channel string) []string {
+	var stmts []string
+	for _, tbl := range []struct {
+		suffix string
+		ptype  string
+		rule   string
+	}{
+		{"grant", "p", fmt.Sprintf(
+			"(SELECT name FROM %s_role WHERE id = rec.role_id), rec.domain, rec.object, rec.action, NULL, NULL", t,
+		)},
+		{"membership", "g", fmt.Sprintf(
+			"(SELECT name FROM %s_subject WHERE id = rec.subject_id), (SELECT name FROM %s_role WHERE id = rec.role_id), rec.domain, NULL, NULL, NULL", t, t,
+		)},
+	} {
+		name := t + "_" + tbl.suffix
+		stmts = append(stmts,
+			fmt.Sprintf("DROP TRIGGER IF EXISTS notify_%s ON %s", name, name),
+			fmt.Sprintf(`
+				create or replace function tg_notify_%s ()
+				returns trigger
+				language plpgsql
+				as $$
+					declare
+						channel text := TG_ARGV[0];
+						rec record;
+					begin
+						IF (TG_OP = 'DELETE') THEN
+							rec := OLD;
+						ELSE
+							rec := NEW;
+						END IF;
+						PERFORM pg_notify(channel, json_build_object(
+							'v', %d,
+							'op', TG_OP,
+							'p_type', '%s',
+							'rule', ARRAY[%s],
+							'ts', extract(epoch from clock_timestamp()),
+							'origin', current_setting('%s', true)
+						)::text);
+						RETURN NULL;
+					end;
+				$$
+			`, name, notificationVersion, tbl.ptype, tbl.rule, originParam),
+			fmt.Sprintf(`
+				CREATE TRIGGER notify_%s
+				AFTER INSERT OR DELETE
+				ON %s
+				FOR EACH ROW
+				EXECUTE PROCEDURE tg_notify_%s('%s')
+			`, name, name, name, channel),
+		)
+	}
+	return stmts
+}
@@ -0,0 +1,110 @@
+package tulip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClaimMapper translates the claims of a verified OIDC ID token into an Identity. Claim
+// names may be dotted paths into nested objects, such as "realm_access.roles".
+type ClaimMapper struct {
+	// SubjectClaim names the claim holding the subject, "sub" if empty
+	SubjectClaim string
+	// GroupClaims name claims holding group or role names, as a list or a single string
+	GroupClaims []string
+	// TenantClaim names the claim holding the domain. If empty or absent from the token
+	// DefaultDomain is used.
+	TenantClaim   string
+	DefaultDomain string
+	// GroupRoles maps claimed group names to roles. If nil, group names are used as
+	// roles as they are, otherwise unmapped groups are ignored.
+	GroupRoles map[string][]string
+}
+
+// Identity is a subject with the grouping rules derived from its token
+type Identity struct {
+	Subject string
+	Domain  string
+	// Groupings are transient grouping rules (subject, role, domain) to be passed to
+	// EnforceWithContext
+	Groupings [][]string
+}
+
+// claim returns the value at a dotted path in claims
+func claim(claims map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	var v interface{} = claims
+	for _, part := range parts {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// claimStrings returns a string or list of strings claim as a slice
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		var res []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Map returns the identity described by claims, as decoded from a verified ID token
+func (c *ClaimMapper) Map(claims map[string]interface{}) (Identity, error) {
+	subClaim := c.SubjectClaim
+	if subClaim == "" {
+		subClaim = "sub"
+	}
+	v, _ := claim(claims, subClaim)
+	sub, _ := v.(string)
+	if sub == "" {
+		return Identity{}, fmt.Errorf("tulip.ClaimMapper.Map: %w: %s", ErrMissingClaim, subClaim)
+	}
+	id := Identity{Subject: sub, Domain: c.DefaultDomain}
+	if c.TenantClaim != "" {
+		if v, ok := claim(claims, c.TenantClaim); ok {
+			if s, ok := v.(string); ok && s != "" {
+				id.Domain = s
+			}
+		}
+	}
+	roles := Policies{}
+	for _, name := range c.GroupClaims {
+		v, _ := claim(claims, name)
+		for _, group := range claimStrings(v) {
+			if c.GroupRoles == nil {
+				roles.Insert([]string{sub, group, id.Domain})
+				continue
+			}
+			for _, role := range c.GroupRoles[group] {
+				roles.Insert([]string{sub, role, id.Domain})
+			}
+		}
+	}
+	id.Groupings = roles
+	return id, nil
+}
+
+// EnforceIdentity evaluates the request with the groupings of id in addition to the
+// stored rules. The request should use id.Subject and id.Domain, e.g.
+//
+//	m.EnforceIdentity(id, id.Subject, id.Domain, "class_a", "teach")
+func (m *Manager) EnforceIdentity(id Identity, request ...string) bool {
+	return m.EnforceWithContext(request, nil, id.Groupings)
+}
@@ -0,0 +1,46 @@
+package tulip
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimMapper(t *testing.T) {
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"sub": "alice",
+		"tenant": "uni",
+		"groups": ["staff", "eng"],
+		"realm_access": {"roles": "lecturer"}
+	}`), &claims))
+
+	c := &ClaimMapper{
+		GroupClaims: []string{"groups", "realm_access.roles"},
+		TenantClaim: "tenant",
+		GroupRoles: map[string][]string{
+			"lecturer": {"teacher"},
+			"staff":    {"employee"},
+		},
+	}
+	id, err := c.Map(claims)
+	require.NoError(t, err)
+	assert.Equal(t, Identity{
+		Subject: "alice",
+		Domain:  "uni",
+		Groupings: [][]string{
+			{"alice", "employee", "uni"},
+			{"alice", "teacher", "uni"},
+		},
+	}, id)
+
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	assert.True(t, m.EnforceIdentity(id, id.Subject, id.Domain, "class_a", "teach"))
+	assert.False(t, m.Enforce(id.Subject, id.Domain, "class_a", "teach"))
+
+	_, err = (&ClaimMapper{}).Map(map[string]interface{}{"email": "a@b.c"})
+	assert.ErrorIs(t, err, ErrMissingClaim)
+}
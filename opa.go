@@ -0,0 +1,117 @@
+package tulip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+)
+
+// OPAData returns the cached rules as OPA base data, keyed by policy type with trailing
+// empty values trimmed from each rule:
+//
+//	{"p": [["alice", "uni", "class_a", "teach"]], "g": [["bob", "teacher", "uni"]]}
+//
+// Rego policies can then match requests against data.<root>.p and data.<root>.g.
+func (m *Manager) OPAData() map[string][][]string {
+	res := map[string][][]string{}
+	for ptype, rules := range m.snapshot() {
+		out := make([][]string, len(rules))
+		for i, rule := range rules {
+			out[i] = trimRule(rule)
+		}
+		res[ptype] = out
+	}
+	return res
+}
+
+// opaBundle renders the cached rules as an OPA bundle rooted at root and returns it
+// along with its revision.
+func (m *Manager) opaBundle(root string) ([]byte, string, error) {
+	data, err := json.Marshal(m.OPAData())
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	revision := hex.EncodeToString(sum[:16])
+	manifest, err := json.Marshal(map[string]interface{}{
+		"revision": revision,
+		"roots":    []string{root},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range []struct {
+		name string
+		body []byte
+	}{
+		{"/.manifest", manifest},
+		{path.Join("/", root, "data.json"), data},
+	} {
+		hdr := &tar.Header{
+			Name:     f.name,
+			Mode:     0644,
+			Size:     int64(len(f.body)),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, "", err
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), revision, nil
+}
+
+// WriteOPABundle writes the cached rules to w as a gzipped OPA bundle, with the data
+// from OPAData placed under root (e.g. "tulip" for data.tulip).
+func (m *Manager) WriteOPABundle(w io.Writer, root string) error {
+	b, _, err := m.opaBundle(root)
+	if err != nil {
+		return fmt.Errorf("tulip.WriteOPABundle: %w", err)
+	}
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("tulip.WriteOPABundle: %w", err)
+	}
+	return nil
+}
+
+// OPABundleHandler returns a handler serving the bundle written by WriteOPABundle, for
+// use as an OPA bundle service. The bundle revision is sent as ETag so that polling
+// OPA instances only download it again after policies have changed.
+func (m *Manager) OPABundleHandler(root string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, revision, err := m.opaBundle(root)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		etag := `"` + revision + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(b)
+	})
+}
@@ -0,0 +1,61 @@
+package tulip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOPABundle(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	assert.Equal(t, map[string][][]string{
+		"p": {{"teacher", "uni", "class_a", "teach"}},
+		"g": {{"alice", "teacher", "uni"}},
+	}, m.OPAData())
+
+	srv := httptest.NewServer(m.OPABundleHandler("tulip"))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	gr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		files[hdr.Name], err = io.ReadAll(tr)
+		require.NoError(t, err)
+	}
+	var manifest struct {
+		Revision string   `json:"revision"`
+		Roots    []string `json:"roots"`
+	}
+	require.NoError(t, json.Unmarshal(files["/.manifest"], &manifest))
+	assert.Equal(t, []string{"tulip"}, manifest.Roots)
+	assert.Equal(t, `"`+manifest.Revision+`"`, resp.Header.Get("ETag"))
+	assert.Contains(t, string(files["/tulip/data.json"]), `["alice","teacher","uni"]`)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp2, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp2.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp2.StatusCode)
+}
@@ -0,0 +1,180 @@
+package tulip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// errUnreadableNotification is returned by the Watch of postgresStorage when a
+// notification can't be read, as the change it reported would otherwise be lost
+var errUnreadableNotification = errors.New("unreadable notification")
+
+// postgresStorage is the Storage of managers created with NewManager, keeping rules in
+// the manager's table
+type postgresStorage struct {
+	m *Manager
+}
+
+func (s *postgresStorage) Load(ctx context.Context, f func(StoredRule) error) error {
+	return s.m.loadRows(ctx, f)
+}
+
+func (s *postgresStorage) Insert(ctx context.Context, rules []StoredRule) (int, error) {
+	inserted, _, _, err := s.insertOnce(ctx, rules, "")
+	return inserted, err
+}
+
+func (s *postgresStorage) Delete(ctx context.Context, rules []StoredRule) (int, error) {
+	deleted, _, err := s.deleteOnce(ctx, rules, "")
+	return deleted, err
+}
+
+// Watch reports the inserts and deletes notified on the channel of the table. The
+// manager listens to the notifications themselves, see notifier.
+func (s *postgresStorage) Watch(ctx context.Context, ready func(), f func(StorageChange)) error {
+	return s.listen(ctx, ready, func(obj policyNotification) error {
+		c := StorageChange{StoredRule: StoredRule{PType: obj.PType, Rule: trimRule(obj.Rule)}}
+		switch obj.Op {
+		case "INSERT":
+		case "DELETE":
+			c.Deleted = true
+		case opReload:
+			return errUnreadableNotification
+		default:
+			return nil
+		}
+		if obj.EffectiveFrom != nil {
+			c.EffectiveFrom = *obj.EffectiveFrom
+		}
+		f(c)
+		return nil
+	})
+}
+
+// insertOnce inserts the rows of rules in a single transaction. added tells which
+// rules were inserted, in order, and done whether the change was already applied
+// under idempotency key.
+func (s *postgresStorage) insertOnce(ctx context.Context, rules []StoredRule, key string) (inserted int, added []bool, done bool, err error) {
+	m := s.m
+	b := &pgx.Batch{}
+	for _, r := range rules {
+		args, err := m.policyArgs(r.PType, r.Rule)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		effectiveFrom := pgtype.Timestamptz{Status: pgtype.Null}
+		if !r.EffectiveFrom.IsZero() {
+			effectiveFrom = pgtype.Timestamptz{Time: r.EffectiveFrom, Status: pgtype.Present}
+		}
+		b.Queue(m.stmts.insert, append(args, effectiveFrom)...)
+	}
+	err = m.retryChange(ctx, func() error {
+		return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+			inserted, added = 0, make([]bool, b.Len())
+			if key != "" {
+				if inserted, done, err = m.claimKey(ctx, tx, key, "add"); err != nil || done {
+					return err
+				}
+			}
+			br := tx.SendBatch(context.Background(), b)
+			defer br.Close()
+			for i := 0; i < b.Len(); i++ {
+				tag, err := br.Exec()
+				if err != nil {
+					return err
+				}
+				added[i] = tag.RowsAffected() > 0
+				inserted += int(tag.RowsAffected())
+			}
+			if err := br.Close(); err != nil {
+				return err
+			}
+			if key != "" {
+				return m.storeKeyResult(ctx, tx, key, inserted)
+			}
+			return nil
+		})
+	})
+	return inserted, added, done, err
+}
+
+// deleteOnce deletes the rows of rules in a single transaction. done tells whether
+// the change was already applied under idempotency key.
+func (s *postgresStorage) deleteOnce(ctx context.Context, rules []StoredRule, key string) (deleted int, done bool, err error) {
+	m := s.m
+	ids := make([]string, len(rules))
+	for i, r := range rules {
+		ids[i] = m.idFunc(r.PType, r.Rule)
+	}
+	if len(ids) == 0 {
+		return 0, false, nil
+	}
+	stmt, arg := m.stmts.removeMany, interface{}(ids)
+	if len(ids) == 1 {
+		stmt, arg = m.stmts.remove, ids[0]
+	}
+	err = m.retryChange(ctx, func() error {
+		return m.pool.BeginFunc(ctx, func(tx pgx.Tx) (err error) {
+			if key != "" {
+				if _, done, err = m.claimKey(ctx, tx, key, "remove"); err != nil || done {
+					return err
+				}
+			}
+			tag, err := tx.Exec(ctx, stmt, arg)
+			deleted = int(tag.RowsAffected())
+			return err
+		})
+	})
+	return deleted, done, err
+}
+
+// listen listens for notifications on a new connection, calling ready once LISTEN
+// succeeded and f with every notification received, until the connection fails, ctx
+// is done or f fails. Notifications that can't be read are reported as opReload.
+func (s *postgresStorage) listen(ctx context.Context, ready func(), f func(policyNotification) error) error {
+	m := s.m
+	connCtx, cancel := context.WithTimeout(ctx, m.timeouts.listen)
+	defer cancel()
+	cfg := m.pool.Config().ConnConfig
+	if err := m.configureConn(connCtx, cfg); err != nil {
+		return err
+	}
+	conn, err := pgx.ConnectConfig(connCtx, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err = conn.Exec(connCtx, "listen "+m.channel()); err != nil {
+		return err
+	}
+	ready()
+	for {
+		payload, err := m.waitForNotification(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("waiting for notification: %w", err)
+		}
+		obj := policyNotification{}
+		if err := json.Unmarshal([]byte(payload), &obj); err != nil {
+			if m.logger != nil {
+				m.logger.Error("error unmarshaling json",
+					zap.Error(err),
+				)
+			}
+			obj = policyNotification{Op: opReload}
+		} else if err := m.decodeValues(obj.Rule); err != nil {
+			if m.logger != nil {
+				m.logger.Error("error decoding notification", zap.Error(err))
+			}
+			obj = policyNotification{Op: opReload}
+		}
+		if err := f(obj); err != nil {
+			return err
+		}
+	}
+}
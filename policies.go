@@ -60,10 +60,12 @@ func stringSliceEqual(a, b []string) bool {
 	return true
 }
 
-func (p *Policies) Insert(rule []string) {
+// Insert inserts rule at its sorted position and reports whether it was inserted,
+// which is false if an equal rule is already present.
+func (p *Policies) Insert(rule []string) bool {
 	i := p.search(rule)
 	if i < p.Len() && stringSliceEqual((*p)[i], rule) {
-		return
+		return false
 	}
 	sl := make([]string, len(rule))
 	copy(sl, rule)
@@ -73,13 +75,17 @@ func (p *Policies) Insert(rule []string) {
 		*p = append((*p)[:i+1], (*p)[i:]...)
 		(*p)[i] = sl
 	}
+	return true
 }
 
-func (p *Policies) Remove(rule []string) {
+// Remove removes rule and reports whether it was present.
+func (p *Policies) Remove(rule []string) bool {
 	i := p.search(rule)
 	if i < p.Len() && stringSliceEqual((*p)[i], rule) {
 		*p = append((*p)[:i], (*p)[i+1:]...)
+		return true
 	}
+	return false
 }
 
 func (p Policies) Find(rule []string) []string {
@@ -137,3 +143,94 @@ func (p Policies) Filter(rule ...string) Policies {
 
 	return res
 }
+
+// compareRules compares a and b value by value, a shorter rule sorting first when
+// one is a prefix of the other.
+func compareRules(a, b []string) int {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] < b[k] {
+			return -1
+		} else if a[k] > b[k] {
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// diffPolicies returns the rules of sorted policies b missing from sorted policies a,
+// and those of a missing from b.
+func diffPolicies(a, b Policies) (added, removed Policies) {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch c := compareRules(a[i], b[j]); {
+		case c < 0:
+			removed = append(removed, a[i])
+			i++
+		case c > 0:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	removed = append(removed, a[i:]...)
+	added = append(added, b[j:]...)
+	return added, removed
+}
+
+// Clone returns a deep copy of p
+func (p Policies) Clone() Policies {
+	if p == nil {
+		return nil
+	}
+	res := make(Policies, len(p))
+	for i, rule := range p {
+		res[i] = append([]string(nil), rule...)
+	}
+	return res
+}
+
+// sorted returns a sorted copy of p, sharing its rules
+func (p Policies) sorted() Policies {
+	res := append(Policies(nil), p...)
+	sort.Slice(res, func(i, j int) bool {
+		return compareRules(res[i], res[j]) < 0
+	})
+	return res
+}
+
+// Dedup sorts p in place and returns it without duplicate rules
+func (p Policies) Dedup() Policies {
+	sort.Slice(p, func(i, j int) bool {
+		return compareRules(p[i], p[j]) < 0
+	})
+	n := 0
+	for i, rule := range p {
+		if i == 0 || !stringSliceEqual(rule, p[n-1]) {
+			p[n] = rule
+			n++
+		}
+	}
+	return p[:n]
+}
+
+// Equal tells whether p and other hold the same rules, in any order
+func (p Policies) Equal(other Policies) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	a, b := p.sorted(), other.sorted()
+	for i := range a {
+		if !stringSliceEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns the rules of other missing from p, and those of p missing from other.
+// Neither needs to be sorted, results are sorted.
+func (p Policies) Diff(other Policies) (added, removed Policies) {
+	return diffPolicies(p.sorted().Dedup(), other.sorted().Dedup())
+}
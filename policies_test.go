@@ -29,7 +29,7 @@ func TestPolicies(t *testing.T) {
 	assert.Nil(t, p.Find([]string{"a", "e"}))
 	assert.NotNil(t, p.Find([]string{"c", "e"}))
 
-	p.Remove([]string{"b", "o"})
+	assert.True(t, p.Remove([]string{"b", "o"}))
 	assert.Equal(t, Policies([][]string{
 		{"a", "d"},
 		{"a", "f"},
@@ -38,9 +38,10 @@ func TestPolicies(t *testing.T) {
 		{"c", "u"},
 	}), p)
 
-	p.Insert([]string{"a", "f"})
-	p.Insert([]string{"a", "e"})
-	p.Insert([]string{"c", "y"})
+	assert.False(t, p.Insert([]string{"a", "f"}))
+	assert.True(t, p.Insert([]string{"a", "e"}))
+	assert.True(t, p.Insert([]string{"c", "y"}))
+	assert.False(t, p.Remove([]string{"b", "z"}))
 	assert.Equal(t, Policies([][]string{
 		{"a", "d"},
 		{"a", "e"},
@@ -94,3 +95,36 @@ func TestPolicies(t *testing.T) {
 		{"b", "n", "j"},
 	}), p.Filter("", "n", "j"))
 }
+
+func TestDiffPolicies(t *testing.T) {
+	a := Policies{{"a", "b"}, {"a", "c"}, {"b", "a"}, {"c", "d"}}
+	b := Policies{{"a", "c"}, {"a", "d"}, {"c", "d"}, {"d", "e"}}
+	added, removed := diffPolicies(a, b)
+	assert.Equal(t, Policies{{"a", "d"}, {"d", "e"}}, added)
+	assert.Equal(t, Policies{{"a", "b"}, {"b", "a"}}, removed)
+
+	added, removed = diffPolicies(nil, b)
+	assert.Equal(t, b, added)
+	assert.Nil(t, removed)
+}
+
+func TestPoliciesSetOperations(t *testing.T) {
+	a := Policies{{"b", "o"}, {"a", "d"}, {"b", "o"}}
+	b := Policies{{"c", "e"}, {"a", "d"}}
+
+	clone := a.Clone()
+	clone[0][0] = "z"
+	assert.Equal(t, "b", a[0][0])
+	assert.Nil(t, Policies(nil).Clone())
+
+	assert.True(t, Policies{{"a"}, {"b", "c"}}.Equal(Policies{{"b", "c"}, {"a"}}))
+	assert.False(t, a.Equal(b))
+	assert.False(t, Policies{{"a"}, {"a"}}.Equal(Policies{{"a"}, {"b"}}))
+
+	added, removed := a.Diff(b)
+	assert.Equal(t, Policies{{"c", "e"}}, added)
+	assert.Equal(t, Policies{{"b", "o"}}, removed)
+	assert.Equal(t, [][]string{{"b", "o"}, {"a", "d"}, {"b", "o"}}, [][]string(a))
+
+	assert.Equal(t, Policies{{"a", "d"}, {"b", "o"}}, a.Dedup())
+}
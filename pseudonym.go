@@ -0,0 +1,112 @@
+package tulip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// pseudonymPrefix marks the values replaced by WithPseudonymizedSubjects
+const pseudonymPrefix = "psn:"
+
+// subjectPositions lists the values of each rule type that name a subject, a role
+// or a bundle, which share a namespace since roles and bundles are assigned to
+// subjects and roles.
+var subjectPositions = map[string][]int{
+	"p":         {0},
+	"g":         {0, 1},
+	BundlePType: {0},
+	QuotaPType:  {0},
+}
+
+// WithPseudonymizedSubjects makes the manager store subjects as keyed hashes of their
+// name, so that personal identifiers never appear in plaintext in the table. Roles and
+// bundles are hashed as well: that is the first value of "p", BundlePType and
+// QuotaPType rules and the first two values of "g" rules. The subject of a request is hashed the same way
+// by Enforce and the other enforcement functions, so decisions are unchanged.
+//
+// Mutations take plain values, values that are already hashes are kept as is. The
+// cache holds hashes, so lookups such as Filter, FilterGroups and QueryPolicies
+// return hashes and must be given hashes, see Pseudonym. The RBAC helpers such as
+// HasRole hash their arguments. salt must be kept secret and stable: changing it
+// orphans every stored rule.
+func WithPseudonymizedSubjects(salt []byte) Option {
+	return func(m *Manager) {
+		m.pseudonymSalt = salt
+	}
+}
+
+// Pseudonym returns the value stored in place of subject, a user, role or bundle
+// name. It returns subject unchanged without WithPseudonymizedSubjects, and when it is
+// already a pseudonym, such as a value read from the cache. The subjects of requests
+// are hashed regardless, so that nobody is granted the access of another user by
+// presenting their pseudonym.
+func (m *Manager) Pseudonym(subject string) string {
+	if strings.HasPrefix(subject, pseudonymPrefix) {
+		return subject
+	}
+	return m.hashSubject(subject)
+}
+
+// hashSubject returns the keyed hash of subject, even if it looks like a pseudonym
+func (m *Manager) hashSubject(subject string) string {
+	if m.pseudonymSalt == nil || subject == "" {
+		return subject
+	}
+	mac := hmac.New(sha256.New, m.pseudonymSalt)
+	mac.Write([]byte(subject))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// pseudonymizeRule returns rule with its subject values replaced by their pseudonym.
+// rule isn't modified.
+func (m *Manager) pseudonymizeRule(ptype string, rule []string) []string {
+	if m.pseudonymSalt == nil {
+		return rule
+	}
+	positions := subjectPositions[ptype]
+	if len(positions) == 0 {
+		return rule
+	}
+	res := append([]string(nil), rule...)
+	for _, i := range positions {
+		if i < len(res) {
+			res[i] = m.Pseudonym(res[i])
+		}
+	}
+	return res
+}
+
+func (m *Manager) pseudonymizeRules(ptype string, rules [][]string) [][]string {
+	if m.pseudonymSalt == nil {
+		return rules
+	}
+	res := make([][]string, len(rules))
+	for i, rule := range rules {
+		res[i] = m.pseudonymizeRule(ptype, rule)
+	}
+	return res
+}
+
+func (m *Manager) pseudonymizeSets(sets []typedRules) []typedRules {
+	if m.pseudonymSalt == nil {
+		return sets
+	}
+	res := make([]typedRules, len(sets))
+	for i, set := range sets {
+		res[i] = typedRules{set.ptype, m.pseudonymizeRules(set.ptype, set.rules)}
+	}
+	return res
+}
+
+// pseudonymizeRequest returns request with its subject replaced by its hash, see
+// hashSubject
+func (m *Manager) pseudonymizeRequest(request []string) []string {
+	if m.pseudonymSalt == nil || len(request) == 0 {
+		return request
+	}
+	res := append([]string(nil), request...)
+	res[0] = m.hashSubject(res[0])
+	return res
+}
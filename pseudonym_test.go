@@ -0,0 +1,72 @@
+package tulip
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPseudonymizedSubjects(t *testing.T) {
+	m := NewStaticEnforcer(
+		Policies{{"teacher", "uni", "class_a", "teach"}, {"bob", "uni", "class_b", "read"}},
+		Policies{{"alice", "teacher", "uni"}},
+		RBACWithDomain, WithPseudonymizedSubjects([]byte("salt")),
+	)
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.True(t, m.Enforce("bob", "uni", "class_b", "read"))
+	assert.False(t, m.Enforce("bob", "uni", "class_a", "teach"))
+	assert.True(t, m.EnforceRequest(Request{Subject: "alice", Domain: "uni", Object: "class_a", Action: "teach"}))
+	assert.True(t, m.EnforceWithContext([]string{"bob", "uni", "class_a", "teach"}, nil, [][]string{{"bob", "teacher", "uni"}}))
+
+	alice := m.Pseudonym("alice")
+	assert.True(t, strings.HasPrefix(alice, pseudonymPrefix))
+	assert.Equal(t, alice, m.Pseudonym(alice))
+	// presenting the pseudonym of alice doesn't grant her access
+	assert.False(t, m.Enforce(alice, "uni", "class_a", "teach"))
+	assert.False(t, m.EnforceRequest(Request{Subject: alice, Domain: "uni", Object: "class_a", Action: "teach"}))
+	assert.False(t, m.WithMatcher(Delegated(RBACWithDomain)).Enforce("bob", alice, "uni", "class_b", "read"))
+	assert.True(t, m.WithMatcher(Delegated(RBACWithDomain)).Enforce("bob", "bob", "uni", "class_b", "read"))
+	assert.NotEqual(t, alice, newManager(nil, []Option{WithPseudonymizedSubjects([]byte("other"))}).Pseudonym("alice"))
+	assert.Empty(t, m.FilterGroups("alice"))
+	assert.Len(t, m.FilterGroups(alice), 1)
+	assert.True(t, m.HasRole("alice", "teacher", "uni"))
+	assert.Equal(t, []string{alice}, m.UsersForRoleInDomain("teacher", "uni"))
+
+	assert.Equal(t, "alice", newManager(nil, nil).Pseudonym("alice"))
+}
+
+func testPseudonymizedSubjects(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithPseudonymizedSubjects([]byte("salt")),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+
+	var count int
+	require.NoError(t, m.pool.QueryRow(context.Background(),
+		"SELECT count(*) FROM "+m.tableName+" WHERE v0 IN ('aaron', 'teacher') OR v1 = 'teacher'",
+	).Scan(&count))
+	assert.Equal(t, 0, count)
+
+	other, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer other.Close()
+	assert.True(t, other.Enforce("aaron", "uni", "class_a", "teach"))
+
+	require.NoError(t, m.RemovePolicies(nil, [][]string{{"aaron", "teacher", "uni"}}))
+	assert.False(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+}
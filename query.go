@@ -0,0 +1,79 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// QueryPolicies returns policies matching filter, like Filter, but reads them from the
+// database instead of the cache so the result reflects exactly what is committed. With
+// WithReadReplica the query runs on the replica.
+func (m *Manager) QueryPolicies(ctx context.Context, filter ...string) (Policies, error) {
+	rules, err := m.queryRules(ctx, "p", filter)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.QueryPolicies: %w", err)
+	}
+	return rules, nil
+}
+
+// QueryGroupingPolicies returns grouping policies matching filter, like FilterGroups,
+// but reads them from the database instead of the cache.
+func (m *Manager) QueryGroupingPolicies(ctx context.Context, filter ...string) (Policies, error) {
+	rules, err := m.queryRules(ctx, "g", filter)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.QueryGroupingPolicies: %w", err)
+	}
+	return rules, nil
+}
+
+// QueryTypedPolicies returns rules of type ptype matching filter, reading them from the
+// database.
+func (m *Manager) QueryTypedPolicies(ctx context.Context, ptype string, filter ...string) (Policies, error) {
+	rules, err := m.queryRules(ctx, ptype, filter)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.QueryTypedPolicies: %w", err)
+	}
+	return rules, nil
+}
+
+func (m *Manager) queryRules(ctx context.Context, ptype string, filter []string) (Policies, error) {
+	if m.isClosed() {
+		return nil, ErrClosed
+	}
+	if err := m.checkPostgres(); err != nil {
+		return nil, err
+	}
+	filter, err := m.encodeValues(filter)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := m.cols.filterClause(ptype, filter)
+	if err != nil {
+		return nil, err
+	}
+	var v0, v1, v2, v3, v4, v5 pgtype.Text
+	var result Policies
+	_, err = m.readerPool().QueryFunc(
+		ctx,
+		fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, m.cols.values(""), m.tableName, where),
+		args,
+		[]interface{}{&v0, &v1, &v2, &v3, &v4, &v5},
+		func(pgx.QueryFuncRow) error {
+			rule := []string{v0.String, v1.String, v2.String, v3.String, v4.String, v5.String}
+			if err := m.decodeValues(rule); err != nil {
+				return err
+			}
+			result = append(result, rule)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(result)
+	return result, nil
+}
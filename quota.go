@@ -0,0 +1,87 @@
+package tulip
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// QuotaPType is the policy type quotas are stored under
+const QuotaPType = "q"
+
+// Quota is a numeric limit on a resource, such as 5 "projects" or 100 "requests" per
+// "day"
+type Quota struct {
+	Limit int64
+	// Period over which usage is counted, such as "day", empty for a limit on the
+	// current amount. It is up to the caller to count usage accordingly.
+	Period string
+}
+
+// AddQuota limits the usage of resource by subject, a user or a role, in domain, as a
+// rule of type QuotaPType of the form (subject, domain, resource, limit, period). It
+// returns false if the same quota is already stored. Changing a quota means removing
+// the previous one with RemoveQuota.
+func (m *Manager) AddQuota(subject, domain, resource string, q Quota) (bool, error) {
+	inserted, err := m.addRules([]typedRules{{QuotaPType, [][]string{quotaRule(subject, domain, resource, q)}}}, time.Time{})
+	if err != nil {
+		return false, fmt.Errorf("tulip.AddQuota: %w", err)
+	}
+	return inserted > 0, nil
+}
+
+// RemoveQuota removes a quota added with AddQuota. It returns ErrRuleNotFound if there
+// is no such quota.
+func (m *Manager) RemoveQuota(subject, domain, resource string, q Quota) error {
+	if err := m.RemovePolicy(QuotaPType, quotaRule(subject, domain, resource, q)); err != nil {
+		return fmt.Errorf("tulip.RemoveQuota: %w", err)
+	}
+	return nil
+}
+
+func quotaRule(subject, domain, resource string, q Quota) []string {
+	rule := []string{subject, domain, resource, strconv.FormatInt(q.Limit, 10)}
+	if q.Period != "" {
+		rule = append(rule, q.Period)
+	}
+	return rule
+}
+
+// QuotaFor returns the quota of sub on resource in domain: the highest limit among
+// those of sub and of the roles it is directly assigned in domain. ok is false if no
+// quota applies. Rules whose limit isn't an integer are ignored.
+func (m *Manager) QuotaFor(sub, domain, resource string) (q Quota, ok bool) {
+	return m.quotaFor(m.Pseudonym(sub), domain, resource)
+}
+
+// quotaFor is QuotaFor for a pseudonymized sub
+func (m *Manager) quotaFor(sub, domain, resource string) (q Quota, ok bool) {
+	subjects := []string{sub}
+	for _, g := range m.FilterGroups(sub, "", domain) {
+		subjects = append(subjects, g[1])
+	}
+	for _, s := range subjects {
+		for _, rule := range m.FilterType(QuotaPType, s, domain, resource) {
+			limit, err := strconv.ParseInt(rule[3], 10, 64)
+			if err != nil {
+				continue
+			}
+			if !ok || limit > q.Limit {
+				q, ok = Quota{Limit: limit, Period: rule[4]}, true
+			}
+		}
+	}
+	return q, ok
+}
+
+// EnforceWithUsage evaluates a capacity request (sub, domain, resource) given the
+// current usage of the resource by sub, counted over the quota's period. It grants the
+// request if a quota applies, see QuotaFor, and usage is below its limit, i.e. one
+// more unit may be consumed. Requests without quota are denied.
+func (m *Manager) EnforceWithUsage(request []string, currentUsage int64) bool {
+	if len(request) < 3 {
+		return false
+	}
+	q, ok := m.quotaFor(m.hashSubject(request[0]), request[1], request[2])
+	return ok && currentUsage < q.Limit
+}
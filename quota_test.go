@@ -0,0 +1,43 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+
+	inserted, err := m.AddQuota("plan:free", "acme", "projects", Quota{Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, inserted)
+	_, err = m.AddQuota("plan:pro", "acme", "projects", Quota{Limit: 5})
+	require.NoError(t, err)
+	_, err = m.AddQuota("alice", "acme", "requests", Quota{Limit: 100, Period: "day"})
+	require.NoError(t, err)
+	_, err = m.AddPolicies(nil, [][]string{{"alice", "plan:free", "acme"}, {"alice", "plan:pro", "acme"}})
+	require.NoError(t, err)
+
+	q, ok := m.QuotaFor("alice", "acme", "projects")
+	assert.True(t, ok)
+	assert.Equal(t, Quota{Limit: 5}, q, "the highest limit applies")
+	q, ok = m.QuotaFor("alice", "acme", "requests")
+	assert.True(t, ok)
+	assert.Equal(t, Quota{Limit: 100, Period: "day"}, q)
+	_, ok = m.QuotaFor("bob", "acme", "projects")
+	assert.False(t, ok)
+
+	assert.True(t, m.EnforceWithUsage([]string{"alice", "acme", "projects"}, 4))
+	assert.False(t, m.EnforceWithUsage([]string{"alice", "acme", "projects"}, 5))
+	assert.False(t, m.EnforceWithUsage([]string{"bob", "acme", "projects"}, 0))
+	assert.False(t, m.EnforceWithUsage([]string{"alice", "acme"}, 0))
+
+	require.NoError(t, m.RemoveQuota("plan:pro", "acme", "projects", Quota{Limit: 5}))
+	assert.False(t, m.EnforceWithUsage([]string{"alice", "acme", "projects"}, 4))
+	assert.ErrorIs(t, m.RemoveQuota("plan:pro", "acme", "projects", Quota{Limit: 5}), ErrRuleNotFound)
+}
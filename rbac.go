@@ -0,0 +1,149 @@
+package tulip
+
+import (
+	"fmt"
+	"time"
+)
+
+// AddRoleForUserInDomain assigns role to user in domain. It returns false if the user
+// already has the role.
+func (m *Manager) AddRoleForUserInDomain(user, role, domain string) (bool, error) {
+	inserted, err := m.AddPolicy("g", []string{user, role, domain})
+	if err != nil {
+		return false, fmt.Errorf("tulip.AddRoleForUserInDomain: %w", err)
+	}
+	return inserted, nil
+}
+
+// RemoveRoleForUserInDomain takes role away from user in domain. It returns
+// ErrRuleNotFound if the user doesn't have the role.
+func (m *Manager) RemoveRoleForUserInDomain(user, role, domain string) error {
+	if err := m.RemovePolicy("g", []string{user, role, domain}); err != nil {
+		return fmt.Errorf("tulip.RemoveRoleForUserInDomain: %w", err)
+	}
+	return nil
+}
+
+// RoleAssignment assigns Role to User in Domain
+type RoleAssignment struct {
+	User   string
+	Role   string
+	Domain string
+}
+
+func assignmentRules(assignments []RoleAssignment) [][]string {
+	rules := make([][]string, len(assignments))
+	for i, a := range assignments {
+		rules[i] = []string{a.User, a.Role, a.Domain}
+	}
+	return rules
+}
+
+// AddRolesForUsers makes all of assignments at once, e.g. to onboard a whole team. The
+// grouping rules are inserted in a single transaction, so other managers are notified
+// of them together. It returns the number of assignments that weren't already made.
+func (m *Manager) AddRolesForUsers(assignments []RoleAssignment) (int, error) {
+	inserted, err := m.addRules([]typedRules{{"g", assignmentRules(assignments)}}, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddRolesForUsers: %w", err)
+	}
+	return inserted, nil
+}
+
+// RemoveRolesForUsers undoes assignments in a single transaction. Assignments that
+// aren't made are skipped.
+func (m *Manager) RemoveRolesForUsers(assignments []RoleAssignment) error {
+	if err := m.removeRules([]typedRules{{"g", assignmentRules(assignments)}}); err != nil {
+		return fmt.Errorf("tulip.RemoveRolesForUsers: %w", err)
+	}
+	return nil
+}
+
+// AddPermissionForRoleInDomain allows role, or a user, to perform action on object in
+// domain. It returns false if the permission is already granted.
+func (m *Manager) AddPermissionForRoleInDomain(role, domain, object, action string) (bool, error) {
+	inserted, err := m.AddPolicy("p", []string{role, domain, object, action})
+	if err != nil {
+		return false, fmt.Errorf("tulip.AddPermissionForRoleInDomain: %w", err)
+	}
+	return inserted, nil
+}
+
+// RemovePermissionForRoleInDomain revokes a permission granted with
+// AddPermissionForRoleInDomain. It returns ErrRuleNotFound if it isn't granted.
+func (m *Manager) RemovePermissionForRoleInDomain(role, domain, object, action string) error {
+	if err := m.RemovePolicy("p", []string{role, domain, object, action}); err != nil {
+		return fmt.Errorf("tulip.RemovePermissionForRoleInDomain: %w", err)
+	}
+	return nil
+}
+
+// HasRole tells whether user is directly assigned role in domain
+func (m *Manager) HasRole(user, role, domain string) bool {
+	return len(m.FilterGroups(m.Pseudonym(user), m.Pseudonym(role), domain)) > 0
+}
+
+// HasRoleLink tells whether user reaches role in domain through any chain of grouping
+// rules, e.g. alice reaches "admin" if she is assigned "lead" and "lead" is assigned
+// "admin". Like Casbin's HasLink, a user reaches itself. With WithDomainHierarchy,
+// assignments made in the ancestors of domain count as well. Each role is visited
+// once, so cycles are harmless.
+func (m *Manager) HasRoleLink(user, role, domain string) bool {
+	user, role = m.Pseudonym(user), m.Pseudonym(role)
+	if user == role {
+		return true
+	}
+	doms := m.domainAncestors(domain)
+	visited := map[string]bool{user: true}
+	queue := []string{user}
+	for len(queue) > 0 {
+		sub := queue[0]
+		queue = queue[1:]
+		for _, d := range doms {
+			for _, g := range m.FilterGroups(sub, "", d) {
+				if g[1] == role {
+					return true
+				}
+				if !visited[g[1]] {
+					visited[g[1]] = true
+					queue = append(queue, g[1])
+				}
+			}
+		}
+	}
+	return false
+}
+
+// RolesForUserInDomain returns the roles directly assigned to user in domain
+func (m *Manager) RolesForUserInDomain(user, domain string) []string {
+	var res []string
+	for _, g := range m.FilterGroups(m.Pseudonym(user), "", domain) {
+		res = append(res, g[1])
+	}
+	return res
+}
+
+// UsersForRoleInDomain returns the users directly assigned role in domain
+func (m *Manager) UsersForRoleInDomain(role, domain string) []string {
+	var res []string
+	for _, g := range m.FilterGroups("", m.Pseudonym(role), domain) {
+		res = append(res, g[0])
+	}
+	return res
+}
+
+// Permission is an action allowed on an object
+type Permission struct {
+	Object string
+	Action string
+}
+
+// PermissionsForRoleInDomain returns the permissions granted to role, or a user, in
+// domain, not including those of its roles
+func (m *Manager) PermissionsForRoleInDomain(role, domain string) []Permission {
+	var res []Permission
+	for _, p := range m.Filter(m.Pseudonym(role), domain) {
+		res = append(res, Permission{Object: p[2], Action: p[3]})
+	}
+	return res
+}
@@ -0,0 +1,88 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRBACHelpers(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "staff", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+
+	assert.True(t, m.HasRole("alice", "teacher", "uni"))
+	assert.False(t, m.HasRole("alice", "teacher", "lab"))
+	assert.Equal(t, []string{"staff", "teacher"}, m.RolesForUserInDomain("alice", "uni"))
+	assert.Equal(t, []string{"alice", "bob"}, m.UsersForRoleInDomain("teacher", "uni"))
+	assert.Equal(t, []Permission{{"class_a", "teach"}}, m.PermissionsForRoleInDomain("teacher", "uni"))
+	assert.Nil(t, m.PermissionsForRoleInDomain("alice", "uni"))
+}
+
+func TestHasRoleLink(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithDomainHierarchy("/")})
+	m.cacheInsert("g", []string{"alice", "lead", "org/team"}, SourceLocal)
+	m.cacheInsert("g", []string{"lead", "staff", "org/team"}, SourceLocal)
+	m.cacheInsert("g", []string{"staff", "admin", "org"}, SourceLocal)
+	m.cacheInsert("g", []string{"admin", "lead", "org"}, SourceLocal)
+
+	assert.True(t, m.HasRoleLink("alice", "lead", "org/team"))
+	assert.True(t, m.HasRoleLink("alice", "admin", "org/team"))
+	assert.True(t, m.HasRoleLink("alice", "alice", "org/team"))
+	assert.False(t, m.HasRoleLink("alice", "admin", "org"))
+	assert.False(t, m.HasRoleLink("alice", "owner", "org/team"))
+	assert.False(t, m.HasRoleLink("bob", "lead", "org/team"))
+}
+
+func TestRolesForUsers(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+	team := []RoleAssignment{
+		{"alice", "teacher", "uni"},
+		{"bob", "teacher", "uni"},
+		{"bob", "staff", "lab"},
+	}
+
+	inserted, err := m.AddRolesForUsers(team)
+	require.NoError(t, err)
+	assert.Equal(t, 3, inserted)
+	inserted, err = m.AddRolesForUsers(team[:2])
+	require.NoError(t, err)
+	assert.Equal(t, 0, inserted)
+	assert.True(t, m.HasRole("bob", "staff", "lab"))
+	assert.Equal(t, 3, m.GroupingPolicyCount())
+
+	require.NoError(t, m.RemoveRolesForUsers(append(team[1:], RoleAssignment{"carol", "teacher", "uni"})))
+	assert.Equal(t, []string{"alice"}, m.UsersForRoleInDomain("teacher", "uni"))
+	assert.Equal(t, 1, m.GroupingPolicyCount())
+}
+
+func testRBACHelpers(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	inserted, err := m.AddPermissionForRoleInDomain("teacher", "uni", "class_a", "teach")
+	require.NoError(t, err)
+	assert.True(t, inserted)
+	inserted, err = m.AddRoleForUserInDomain("alice", "teacher", "uni")
+	require.NoError(t, err)
+	assert.True(t, inserted)
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+
+	require.NoError(t, m.RemoveRoleForUserInDomain("alice", "teacher", "uni"))
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.ErrorIs(t, m.RemoveRoleForUserInDomain("alice", "teacher", "uni"), ErrRuleNotFound)
+	require.NoError(t, m.RemovePermissionForRoleInDomain("teacher", "uni", "class_a", "teach"))
+	assert.Equal(t, 0, m.PolicyCount())
+}
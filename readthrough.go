@@ -0,0 +1,105 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// WithReadThrough makes Enforce read the rules it needs from the database rather than
+// trust the cache once the cache is stale, i.e. the last full load is older than
+// threshold and no notification listener is connected. Requests must start with the
+// subject and the domain, as with RBACWithDomain: the "g" rules of the subject in the
+// domain and the "p" rules of the subject and its roles in the domain are queried, and
+// the matcher evaluates the request against them only. This trades a round trip per
+// request for correctness during sync outages. If the query fails, the cache is used.
+//
+// In polling mode threshold must exceed the sync interval, otherwise every request
+// between two syncs reads through.
+func WithReadThrough(threshold time.Duration) Option {
+	return func(m *Manager) {
+		m.readThrough = threshold
+	}
+}
+
+// cacheStale tells whether the cache can't be trusted as per WithReadThrough
+func (m *Manager) cacheStale() bool {
+	m.stats.mutex.Lock()
+	defer m.stats.mutex.Unlock()
+	return !m.stats.listening && time.Since(m.stats.lastSync) > m.readThrough
+}
+
+// readThroughView returns a view of m holding the rules of sub in dom, and of its
+// roles, as read from the database.
+func (m *Manager) readThroughView(ctx context.Context, sub, dom string) (*Manager, error) {
+	if m.isClosed() {
+		return nil, ErrClosed
+	}
+	if err := m.checkPostgres(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.timeouts.query)
+	defer cancel()
+	doms, err := m.encodeValues(m.domainAncestors(dom))
+	if err != nil {
+		return nil, err
+	}
+	enc, err := m.encodeValues([]string{sub})
+	if err != nil {
+		return nil, err
+	}
+	var ptype, v0, v1, v2, v3, v4, v5 pgtype.Text
+	view := m.view()
+	view.p, view.g = Policies{}, Policies{}
+	c := m.cols
+	_, err = m.readerPool().QueryFunc(
+		ctx,
+		fmt.Sprintf(`
+			SELECT %[2]s, %[3]s FROM %[1]s
+			WHERE (%[4]s IS NULL OR %[4]s <= now()) AND (
+				(%[2]s = 'g' AND %[5]s = $1 AND %[7]s = ANY($2))
+				OR (%[2]s = 'p' AND %[6]s = ANY($2) AND (%[5]s = $1 OR %[5]s IN (
+					SELECT %[6]s FROM %[1]s WHERE %[2]s = 'g' AND %[5]s = $1 AND %[7]s = ANY($2)
+				)))
+			)
+		`, m.tableName, c.ptype, c.values(""), c.from, c.v[0], c.v[1], c.v[2]),
+		[]interface{}{enc[0], doms},
+		[]interface{}{&ptype, &v0, &v1, &v2, &v3, &v4, &v5},
+		func(pgx.QueryFuncRow) error {
+			rule := []string{v0.String, v1.String, v2.String, v3.String, v4.String, v5.String}
+			if err := m.decodeValues(rule); err != nil {
+				return err
+			}
+			if ptype.String == "g" {
+				view.g.Insert(rule)
+			} else {
+				view.p.Insert(rule)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// enforceReadThrough evaluates request with matcher against rules read from the
+// database, and reports false for ok if the cache should be used instead.
+func (m *Manager) enforceReadThrough(ctx context.Context, matcher Matcher, request []string) (allowed, ok bool) {
+	if m.readThrough <= 0 || len(request) < 2 || !m.cacheStale() {
+		return false, false
+	}
+	view, err := m.readThroughView(ctx, request[0], request[1])
+	if err != nil {
+		if logger := m.log(ctx); logger != nil {
+			logger.Warn("read-through lookup failed, using cache", zap.Error(err))
+		}
+		return false, false
+	}
+	return matcher(view, request...), true
+}
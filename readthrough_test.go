@@ -0,0 +1,46 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCacheStale(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithReadThrough(time.Minute)})
+	m.stats.lastSync = time.Now()
+	assert.False(t, m.cacheStale())
+	m.stats.lastSync = time.Now().Add(-time.Hour)
+	assert.True(t, m.cacheStale())
+	m.stats.listening = true
+	assert.False(t, m.cacheStale())
+}
+
+func testReadThrough(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+	)
+	writer, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer writer.Close()
+	// the reader's cache goes stale immediately and is never refreshed
+	reader, err := NewManager(context.Background(), connStr, RBACWithDomain, append(opts,
+		WithPollingSync(time.Hour), WithReadThrough(time.Nanosecond),
+	)...)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = writer.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reader.PolicyCount())
+	assert.True(t, reader.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.False(t, reader.Enforce("aaron", "lab", "class_a", "teach"))
+}
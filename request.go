@@ -0,0 +1,44 @@
+package tulip
+
+import "context"
+
+// Request is a typed alternative to the positional arguments of Enforce, in the order
+// expected by RBACWithDomain
+type Request struct {
+	Subject string
+	Domain  string
+	Object  string
+	Action  string
+	// Attrs carries facts about the request for a RequestMatcher, such as the client
+	// IP or the resource owner
+	Attrs map[string]string
+}
+
+// Strings returns the request as positional arguments for a Matcher
+func (r Request) Strings() []string {
+	return []string{r.Subject, r.Domain, r.Object, r.Action}
+}
+
+// RequestMatcher is a matcher taking a Request, with access to its attributes
+type RequestMatcher func(m *Manager, r Request) bool
+
+// WithRequestMatcher sets the matcher used by EnforceRequest. Without it EnforceRequest
+// passes the request to the manager's matcher as positional arguments, ignoring Attrs.
+func WithRequestMatcher(f RequestMatcher) Option {
+	return func(m *Manager) {
+		m.requestMatcher = f
+	}
+}
+
+// EnforceRequest tells whether r is granted
+func (m *Manager) EnforceRequest(r Request) bool {
+	if m.requestMatcher == nil {
+		return m.enforce(context.Background(), "default", m.matcher, r.Strings())
+	}
+	matcher := func(v *Manager, request ...string) bool {
+		// request is r.Strings() as pseudonymized or modified by middlewares
+		r.Subject, r.Domain, r.Object, r.Action = request[0], request[1], request[2], request[3]
+		return m.requestMatcher(v, r)
+	}
+	return m.enforce(context.Background(), "request", matcher, r.Strings())
+}
@@ -0,0 +1,23 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceRequest(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+	assert.True(t, m.EnforceRequest(Request{Subject: "alice", Domain: "uni", Object: "class_a", Action: "teach"}))
+	assert.False(t, m.EnforceRequest(Request{Subject: "alice", Domain: "uni", Object: "teach", Action: "class_a"}))
+
+	m = newManager(RBACWithDomain, []Option{WithRequestMatcher(func(m *Manager, r Request) bool {
+		return r.Attrs["network"] == "campus" && m.Enforce(r.Strings()...)
+	})})
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+	r := Request{Subject: "alice", Domain: "uni", Object: "class_a", Action: "teach"}
+	assert.False(t, m.EnforceRequest(r))
+	r.Attrs = map[string]string{"network": "campus"}
+	assert.True(t, m.EnforceRequest(r))
+}
@@ -0,0 +1,137 @@
+package tulip
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy configures WithRetry
+type RetryPolicy struct {
+	// MaxAttempts is the number of times an operation is tried, including the first
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, doubled after each retry up to
+	// MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by WithRetry for zero fields
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  50 * time.Millisecond,
+	MaxBackoff:  time.Second,
+}
+
+// WithRetry retries mutations and policy loads failing with a transient database
+// error: a serialization failure or deadlock, a connection that couldn't be used, or
+// a server shutting down or starting up, as during a failover. Retries back off
+// exponentially and stay within the timeout of the operation, see WithTimeout.
+// Inserts skip rules that are already stored and removals skip rules that are gone,
+// so retrying a change that was applied before the connection dropped is harmless,
+// though the number of rules reported as inserted may then be too low.
+func WithRetry(policy RetryPolicy) Option {
+	return func(m *Manager) {
+		if policy.MaxAttempts <= 0 {
+			policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+		}
+		if policy.MinBackoff <= 0 {
+			policy.MinBackoff = DefaultRetryPolicy.MinBackoff
+		}
+		if policy.MaxBackoff < policy.MinBackoff {
+			policy.MaxBackoff = policy.MinBackoff
+		}
+		m.retryPolicy = &policy
+	}
+}
+
+// isTransient tells whether err may go away if the operation is tried again
+func isTransient(err error) bool {
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	// serialization_failure, deadlock_detected, admin_shutdown, crash_shutdown,
+	// cannot_connect_now
+	case "40001", "40P01", "57P01", "57P02", "57P03":
+		return true
+	}
+	// connection exceptions
+	return strings.HasPrefix(pgErr.Code, "08")
+}
+
+// retry calls f until it succeeds, fails with an error that isn't transient, ctx is
+// done or the attempts allowed by WithRetry are used up. Without WithRetry f is
+// called once.
+func (m *Manager) retry(ctx context.Context, f func() error) error {
+	err := f()
+	policy := m.retryPolicy
+	if policy == nil {
+		return err
+	}
+	backoff := policy.MinBackoff
+	for attempt := 1; err != nil && attempt < policy.MaxAttempts && isTransient(err); attempt++ {
+		if logger := m.log(ctx); logger != nil {
+			logger.Warn("transient database error, retrying",
+				zap.Error(err),
+				zap.Int("attempt", attempt),
+				zap.Duration("backoff", backoff),
+			)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+		err = f()
+	}
+	return err
+}
+
+// commitUnknown tells whether err leaves unknown whether the change it failed was
+// committed, as when the connection drops while the commit is acknowledged. The
+// server rejected the change if it returned an error, and never saw it if it is safe
+// to retry.
+func commitUnknown(err error) bool {
+	if err == nil || pgconn.SafeToRetry(err) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr)
+}
+
+// retryChange is retry for a change to the table applied to the cache by the caller.
+// If an attempt failed with its commit unknown, the cache is reloaded: the change may
+// have been committed and the manager skips the notifications of its own changes, see
+// WithInstanceID.
+func (m *Manager) retryChange(ctx context.Context, f func() error) error {
+	unknown := false
+	err := m.retry(ctx, func() error {
+		err := f()
+		if commitUnknown(err) {
+			unknown = true
+		}
+		return err
+	})
+	if unknown {
+		loadCtx, cancel := m.closingContext(m.timeouts.query)
+		defer cancel()
+		if _, _, err := m.loadPolicies(loadCtx); err != nil {
+			if logger := m.log(ctx); logger != nil {
+				logger.Error("error reloading policies after a change with unknown outcome", zap.Error(err))
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package tulip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	for code, transient := range map[string]bool{
+		"40001": true,
+		"40P01": true,
+		"08006": true,
+		"57P01": true,
+		"23505": false,
+		"42P01": false,
+	} {
+		err := fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: code})
+		assert.Equal(t, transient, isTransient(err), code)
+	}
+	assert.False(t, isTransient(errors.New("boom")))
+	assert.False(t, isTransient(context.DeadlineExceeded))
+}
+
+// safeErr is an error failing before anything was sent to the server
+type safeErr struct{}
+
+func (safeErr) Error() string     { return "safe" }
+func (safeErr) SafeToRetry() bool { return true }
+
+func TestCommitUnknown(t *testing.T) {
+	assert.False(t, commitUnknown(nil))
+	assert.False(t, commitUnknown(fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40001"})))
+	assert.False(t, commitUnknown(safeErr{}))
+	assert.True(t, commitUnknown(errors.New("unexpected EOF")))
+	assert.True(t, commitUnknown(context.DeadlineExceeded))
+}
+
+func TestRetry(t *testing.T) {
+	transient := &pgconn.PgError{Code: "40001"}
+	calls := 0
+	failTimes := func(n int, err error) func() error {
+		calls = 0
+		return func() error {
+			calls++
+			if calls <= n {
+				return err
+			}
+			return nil
+		}
+	}
+	ctx := context.Background()
+
+	m := newManager(nil, nil)
+	assert.Equal(t, transient, m.retry(ctx, failTimes(1, transient)))
+	assert.Equal(t, 1, calls)
+
+	m = newManager(nil, []Option{WithRetry(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond})})
+	assert.NoError(t, m.retry(ctx, failTimes(2, transient)))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, transient, m.retry(ctx, failTimes(3, transient)))
+	assert.Equal(t, 3, calls)
+	permanent := &pgconn.PgError{Code: "23505"}
+	assert.Equal(t, permanent, m.retry(ctx, failTimes(1, permanent)))
+	assert.Equal(t, 1, calls)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, transient, m.retry(cancelled, failTimes(1, transient)))
+	assert.Equal(t, 1, calls)
+}
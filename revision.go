@@ -0,0 +1,75 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Revision returns the revision of the stored rules, which is bumped by every
+// transaction changing them, or 0 if they were never changed. It requires
+// WithEventLog.
+func (m *Manager) Revision(ctx context.Context) (int64, error) {
+	if err := m.checkEventLog(); err != nil {
+		return 0, fmt.Errorf("tulip.Revision: %w", err)
+	}
+	var rev int64
+	err := m.readerPool().QueryRow(ctx,
+		fmt.Sprintf("SELECT coalesce(max(rev), 0) FROM %s_log", m.tableName),
+	).Scan(&rev)
+	if err != nil {
+		return 0, fmt.Errorf("tulip.Revision: %w", err)
+	}
+	return rev, nil
+}
+
+// RollbackTo restores the rules stored at revision rev, e.g. to revert a bad bulk
+// import, then reloads the cache. The inverse of every later change is applied in a
+// single transaction, which is itself logged as a new revision: history is never
+// rewritten. It returns ErrRevisionNotFound if rev is negative or greater than the
+// current revision. It requires WithEventLog.
+func (m *Manager) RollbackTo(rev int64) error {
+	if err := m.checkWritable(); err != nil {
+		return fmt.Errorf("tulip.RollbackTo: %w", err)
+	}
+	if err := m.checkEventLog(); err != nil {
+		return fmt.Errorf("tulip.RollbackTo: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	err := m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// keeps other writers out until the rollback commits
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", m.eventLogLockKey()); err != nil {
+			return err
+		}
+		var current int64
+		err := tx.QueryRow(ctx,
+			fmt.Sprintf("SELECT coalesce(max(rev), 0) FROM %s_log", m.tableName),
+		).Scan(&current)
+		if err != nil {
+			return err
+		}
+		if rev < 0 || rev > current {
+			return fmt.Errorf("%w: %d, current revision is %d", ErrRevisionNotFound, rev, current)
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM %s WHERE %s NOT IN (SELECT id FROM (%s) target)
+		`, m.tableName, m.cols.id, rulesAtSQL(m.tableName)), rev); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %[1]s (%[2]s)
+			SELECT id, p_type, v0, v1, v2, v3, v4, v5, effective_from FROM (%[4]s) target
+			WHERE NOT EXISTS (SELECT 1 FROM %[1]s t WHERE t.%[3]s = target.id)
+		`, m.tableName, m.cols.all(), m.cols.id, rulesAtSQL(m.tableName)), rev)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("tulip.RollbackTo: %w", err)
+	}
+	if _, _, err := m.loadPolicies(ctx); err != nil {
+		return fmt.Errorf("tulip.RollbackTo: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testRollback(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithEventLog(),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+	ctx := context.Background()
+
+	rev, err := m.Revision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rev)
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	good, err := m.Revision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), good)
+
+	// a bad import
+	require.NoError(t, m.RemovePolicies(nil, [][]string{{"aaron", "teacher", "uni"}}))
+	_, err = m.AddPolicies([][]string{{"mallory", "uni", "grades", "write"}}, nil)
+	require.NoError(t, err)
+	assert.False(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+
+	require.NoError(t, m.RollbackTo(good))
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("mallory", "uni", "grades", "write"))
+	rev, err = m.Revision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), rev)
+
+	assert.ErrorIs(t, m.RollbackTo(rev+1), ErrRevisionNotFound)
+	require.NoError(t, m.RollbackTo(0))
+	assert.Equal(t, 0, m.PolicyCount()+m.GroupingPolicyCount())
+	require.NoError(t, m.VerifyEventLog(ctx))
+}
@@ -0,0 +1,125 @@
+package tulip
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// pendingRule is a stored rule that takes effect at from
+type pendingRule struct {
+	ptype string
+	rule  []string
+	from  time.Time
+}
+
+// ScheduledPolicy is a stored rule that isn't in effect yet
+type ScheduledPolicy struct {
+	PType         string
+	Rule          []string
+	EffectiveFrom time.Time
+}
+
+// AddScheduledPolicies stores rules of type ptype right away but only has them take
+// effect at from, e.g. to stage access for a planned engagement. Until then they are
+// ignored by Enforce and lookups, after which they become visible without any write.
+// Removing a scheduled rule cancels it. Adding a rule that is already stored, with or
+// without a schedule, leaves it as it is. It returns the number of rules inserted.
+//
+// Scheduled rules are not supported with WithNormalizedSchema.
+func (m *Manager) AddScheduledPolicies(ptype string, rules [][]string, from time.Time) (inserted int, err error) {
+	inserted, err = m.addRules([]typedRules{{ptype, rules}}, from)
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddScheduledPolicies: %w", err)
+	}
+	return inserted, nil
+}
+
+// ScheduledPolicies returns the rules waiting to take effect, soonest first
+func (m *Manager) ScheduledPolicies() []ScheduledPolicy {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	res := make([]ScheduledPolicy, len(m.pending))
+	for i, pr := range m.pending {
+		res[i] = ScheduledPolicy{PType: pr.ptype, Rule: trimRule(pr.rule), EffectiveFrom: pr.from}
+	}
+	return res
+}
+
+// schedule has rule take effect at from, replacing any earlier schedule of the same
+// rule. Caller must hold m.mutex.
+func (m *Manager) schedule(ptype string, rule []string, from time.Time) {
+	if m.sqlOnly {
+		// QueryEnforce already ignores rules that aren't effective yet
+		return
+	}
+	rule = padRule(rule)
+	m.unschedule(ptype, rule)
+	i := sort.Search(len(m.pending), func(i int) bool {
+		return m.pending[i].from.After(from)
+	})
+	m.pending = append(m.pending, pendingRule{})
+	copy(m.pending[i+1:], m.pending[i:])
+	m.pending[i] = pendingRule{ptype, rule, from}
+	m.resetActivation()
+}
+
+// scheduled tells whether rule is waiting to take effect. Caller must hold m.mutex.
+func (m *Manager) scheduled(ptype string, rule []string) bool {
+	rule = padRule(rule)
+	for _, pr := range m.pending {
+		if pr.ptype == ptype && stringSliceEqual(pr.rule, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// unschedule cancels the schedule of rule if any. Caller must hold m.mutex.
+func (m *Manager) unschedule(ptype string, rule []string) {
+	rule = padRule(rule)
+	for i, pr := range m.pending {
+		if pr.ptype == ptype && stringSliceEqual(pr.rule, rule) {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// replacePending replaces all scheduled rules, as found by a full load. Caller must
+// hold m.mutex.
+func (m *Manager) replacePending(pending []pendingRule) {
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].from.Before(pending[j].from)
+	})
+	m.pending = pending
+	m.resetActivation()
+}
+
+// resetActivation arms the timer for the earliest scheduled rule. Caller must hold
+// m.mutex.
+func (m *Manager) resetActivation() {
+	if m.activation != nil {
+		m.activation.Stop()
+		m.activation = nil
+	}
+	if len(m.pending) == 0 || m.isClosed() {
+		return
+	}
+	m.activation = time.AfterFunc(time.Until(m.pending[0].from), m.activateDue)
+}
+
+// activateDue moves the scheduled rules whose time has come into the cache
+func (m *Manager) activateDue() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	n := 0
+	for n < len(m.pending) && !m.pending[n].from.After(now) {
+		pr := m.pending[n]
+		m.cacheInsert(pr.ptype, pr.rule, SourceSchedule)
+		n++
+	}
+	m.pending = m.pending[n:]
+	m.resetActivation()
+}
@@ -0,0 +1,97 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSchedule(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	events := m.Events()
+	now := time.Now()
+	m.mutex.Lock()
+	m.schedule("p", []string{"alice", "uni", "class_b", "teach"}, now.Add(time.Hour))
+	m.schedule("p", []string{"alice", "uni", "class_a", "teach"}, now.Add(20*time.Millisecond))
+	m.schedule("p", []string{"alice", "uni", "class_c", "teach"}, now.Add(30*time.Millisecond))
+	m.mutex.Unlock()
+
+	assert.Equal(t, []ScheduledPolicy{
+		{PType: "p", Rule: []string{"alice", "uni", "class_a", "teach"}, EffectiveFrom: now.Add(20 * time.Millisecond)},
+		{PType: "p", Rule: []string{"alice", "uni", "class_c", "teach"}, EffectiveFrom: now.Add(30 * time.Millisecond)},
+		{PType: "p", Rule: []string{"alice", "uni", "class_b", "teach"}, EffectiveFrom: now.Add(time.Hour)},
+	}, m.ScheduledPolicies())
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach"))
+
+	// removing a scheduled rule cancels it
+	m.mutex.Lock()
+	m.cacheRemove("p", []string{"alice", "uni", "class_c", "teach"}, SourceLocal)
+	m.mutex.Unlock()
+
+	ev := <-events
+	assert.Equal(t, SourceSchedule, ev.Source)
+	assert.Equal(t, []string{"alice", "uni", "class_a", "teach", "", ""}, ev.Rule)
+	time.Sleep(30 * time.Millisecond)
+	m.mutex.Lock()
+	assert.Equal(t, 1, m.p.Len())
+	m.mutex.Unlock()
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("alice", "uni", "class_c", "teach"))
+	assert.Len(t, m.ScheduledPolicies(), 1)
+	m.mutex.Lock()
+	m.activation.Stop()
+	m.mutex.Unlock()
+}
+
+func TestScheduleKept(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+	_, err = m.AddScheduledPolicies("p", [][]string{{"alice", "uni", "class_a", "teach"}}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	n, err := m.AddPolicies([][]string{{"alice", "uni", "class_a", "teach"}, {"bob", "uni", "class_a", "teach"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.True(t, m.Enforce("bob", "uni", "class_a", "teach"))
+	assert.Len(t, m.ScheduledPolicies(), 1)
+}
+
+func testScheduledPolicies(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+	other, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer other.Close()
+
+	n, err := m.AddScheduledPolicies("p", [][]string{{"alice", "uni", "class_a", "teach"}}, time.Now().Add(500*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	// adding it again keeps the stored schedule
+	ok, err := m.AddPolicy("p", []string{"alice", "uni", "class_a", "teach"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	n, err = m.AddPolicies([][]string{{"alice", "uni", "class_a", "teach"}}, nil)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.False(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	retryUntil(t, 50*time.Millisecond, 10, func() bool {
+		return len(other.ScheduledPolicies()) == 1
+	}, func() string { return "waiting for notification" })
+	assert.Equal(t, 0, other.PolicyCount())
+
+	waitForNotification(t, m, 1, 0)
+	waitForNotification(t, other, 1, 0)
+	require.NoError(t, other.LoadPolicies())
+	assert.True(t, other.Enforce("alice", "uni", "class_a", "teach"))
+}
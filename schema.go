@@ -0,0 +1,137 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// SchemaSQL returns the DDL statements NewManager would run with the same options, in
+// order. Teams that manage their schema with a migration tool can vendor these
+// statements and start the manager with WithSkipTableCreate and WithSkipTriggerCreate.
+func SchemaSQL(opts ...Option) []string {
+	return newManager(nil, opts).schemaSQL()
+}
+
+func (m *Manager) schemaSQL() []string {
+	stmts := m.tableStmts()
+	stmts = append(stmts, m.triggerStmts()...)
+	return append(stmts, m.validationStmts()...)
+}
+
+// tableStmts returns the statements creating the tables of the manager
+func (m *Manager) tableStmts() []string {
+	if m.skipTableCreate {
+		return nil
+	}
+	var stmts []string
+	if m.schema != "" {
+		stmts = append(stmts, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", m.schema))
+	}
+	if m.normalized {
+		stmts = append(stmts, normalizedTableSQL(m.tableName)...)
+	} else {
+		stmts = append(stmts,
+			tableSQL(m.tableName, m.cols),
+			// added after the table was first released
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s timestamptz", m.tableName, m.cols.from),
+		)
+		stmts = append(stmts, indexSQL(m.tableName, m.cols, m.indexes)...)
+		if m.groupExpiry {
+			stmts = append(stmts, expiryTableSQL(m.tableName, m.cols)...)
+		}
+	}
+	if m.idempotency {
+		stmts = append(stmts, idempotencyTableSQL(m.tableName))
+	}
+	if m.snapshots {
+		stmts = append(stmts, snapshotTableSQL(m.tableName)...)
+	}
+	if m.eventLog {
+		stmts = append(stmts, eventLogSQL(m.tableName, m.cols, m.eventLogLockKey())...)
+	}
+	return stmts
+}
+
+// triggerStmts returns the statements installing the notification triggers
+func (m *Manager) triggerStmts() []string {
+	if m.pollingOnly || m.skipTriggerCreate {
+		return nil
+	}
+	return m.notifyTriggerSQL()
+}
+
+// validationStmts returns the statements installing the strict validation trigger
+func (m *Manager) validationStmts() []string {
+	if m.validation != nil && m.validation.StrictTrigger && len(m.validation.Arity) > 0 && !m.skipTriggerCreate {
+		return validationTriggerSQL(m.tableName, m.cols, m.validation.Arity)
+	}
+	return nil
+}
+
+// advisoryLockKey derives a Postgres advisory lock key from name
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("tulip:" + name))
+	return int64(h.Sum64())
+}
+
+// createSchema runs the statements of schemaSQL in a single transaction holding an
+// advisory lock on the table name, so that when many instances start at once exactly
+// one of them performs the DDL at a time instead of racing or deadlocking. Notification
+// triggers already recorded in TriggerTableName as up to date are left alone.
+func (m *Manager) createSchema(ctx context.Context) error {
+	tables, triggers, validation := m.tableStmts(), m.triggerStmts(), m.validationStmts()
+	if len(tables)+len(triggers)+len(validation) == 0 {
+		return nil
+	}
+	if logger := m.log(ctx); logger != nil {
+		logger.Info("creating schema", zap.String("table_name", m.tableName))
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.timeouts.ddl)
+	defer cancel()
+	return m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockKey(m.qualifiedTableName())); err != nil {
+			return err
+		}
+		if len(triggers) > 0 {
+			if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockKey(TriggerTableName)); err != nil {
+				return err
+			}
+			upToDate, err := m.triggerUpToDate(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if upToDate {
+				triggers = nil
+			}
+		}
+		for _, stmts := range [][]string{tables, triggers, validation} {
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func tableSQL(tableName string, c columns) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			%s text PRIMARY KEY,
+			%s text,
+			%s text,
+			%s text,
+			%s text,
+			%s text,
+			%s text,
+			%s text,
+			%s timestamptz
+		)
+	`, tableName, c.id, c.ptype, c.v[0], c.v[1], c.v[2], c.v[3], c.v[4], c.v[5], c.from)
+}
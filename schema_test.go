@@ -0,0 +1,87 @@
+package tulip
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaSQL(t *testing.T) {
+	stmts := SchemaSQL(WithTableName("acl"))
+	require.Len(t, stmts, 7)
+	assert.Contains(t, stmts[0], "CREATE TABLE IF NOT EXISTS acl")
+	assert.Contains(t, stmts[1], "ADD COLUMN IF NOT EXISTS effective_from")
+	assert.Contains(t, stmts[3], "function tg_notify_acl")
+	assert.Contains(t, stmts[4], "tg_notify_acl('acl_rules')")
+	assert.Contains(t, stmts[5], "CREATE TABLE IF NOT EXISTS tulip_trigger")
+	assert.Contains(t, stmts[6], "VALUES ('acl', 'acl_rules', 3, '")
+	assert.Contains(t, stmts[6], "ARRAY['acl']::text[]")
+
+	stmts = SchemaSQL(WithTableName("acl"), WithSkipTriggerCreate())
+	require.Len(t, stmts, 2)
+	assert.True(t, strings.Contains(stmts[0], "CREATE TABLE"))
+
+	assert.Len(t, SchemaSQL(WithSkipTableCreate(), WithPollingSync(DefaultSyncPeriod)), 0)
+
+	stmts = SchemaSQL(WithTableName("acl"), WithSkipTriggerCreate(), WithIdempotencyKeys())
+	require.Len(t, stmts, 3)
+	assert.Contains(t, stmts[2], "CREATE TABLE IF NOT EXISTS acl_idempotency")
+
+	stmts = SchemaSQL(WithTableName("acl"), WithColumns(Columns{ID: "rule_id", EffectiveFrom: "ValidFrom"}))
+	require.Len(t, stmts, 7)
+	assert.Contains(t, stmts[0], "rule_id text PRIMARY KEY")
+	assert.Contains(t, stmts[1], `ADD COLUMN IF NOT EXISTS "ValidFrom"`)
+	assert.Contains(t, stmts[3], `NEW."ValidFrom"`)
+	assert.Equal(t, TriggerSQL("acl"), SchemaSQL(WithTableName("acl"), WithSkipTableCreate()))
+
+	stmts = SchemaSQL(WithTableName("acl"), WithSkipTriggerCreate(), WithEventLog())
+	require.Len(t, stmts, 11)
+	assert.Contains(t, stmts[2], "CREATE TABLE IF NOT EXISTS acl_log")
+	assert.Contains(t, stmts[3], "function log_append_acl (op text, r acl)")
+	assert.Contains(t, stmts[6], "ON acl\n")
+	assert.Contains(t, stmts[9], "BEFORE UPDATE OR DELETE OR TRUNCATE")
+	assert.Contains(t, stmts[10], "log_append_acl('INSERT', r)")
+
+	stmts = SchemaSQL(WithTableName("acl"), WithValidation(ValidationConfig{
+		Arity:         map[string]int{"p": 4, "g": 3},
+		StrictTrigger: true,
+	}))
+	require.Len(t, stmts, 10)
+	assert.Contains(t, stmts[7], "CASE NEW.p_type WHEN 'g' THEN 3 WHEN 'p' THEN 4 END")
+	assert.Contains(t, stmts[7], "'rule type % is not allowed'")
+	assert.Contains(t, stmts[9], "BEFORE INSERT OR UPDATE")
+
+	stmts = SchemaSQL(WithTableName("acl"), WithSkipTriggerCreate(),
+		WithColumns(Columns{Values: [ruleWidth]string{"subject"}}), WithIndexes("v0", "v1", "v9"))
+	assert.Equal(t, []string{
+		"CREATE INDEX IF NOT EXISTS acl_v0_idx ON acl (subject)",
+		"CREATE INDEX IF NOT EXISTS acl_v1_idx ON acl (v1)",
+	}, stmts[2:])
+
+	stmts = SchemaSQL(WithTableName("acl"), WithNormalizedSchema())
+	require.Len(t, stmts, 16)
+	assert.Contains(t, stmts[2], "REFERENCES acl_role (id)")
+	assert.Contains(t, stmts[4], "CREATE OR REPLACE VIEW acl AS")
+	assert.Contains(t, stmts[7], "INSTEAD OF INSERT OR DELETE")
+	assert.Contains(t, stmts[10], "tg_notify_acl_grant('acl_rules')")
+	assert.Contains(t, stmts[13], "tg_notify_acl_membership('acl_rules')")
+	assert.Contains(t, stmts[15], "ARRAY['acl_grant', 'acl_membership']::text[]")
+}
+
+func TestTriggerChecksum(t *testing.T) {
+	m := newManager(nil, []Option{WithTableName("acl")})
+	stmts, tables := m.notifyTriggers()
+	assert.Equal(t, []string{"acl"}, tables)
+	assert.Contains(t, m.notifyTriggerSQL()[len(stmts)+1], triggerChecksum(stmts))
+
+	other, _ := newManager(nil, []Option{WithTableName("acl"), WithColumns(Columns{PType: "kind"})}).notifyTriggers()
+	assert.NotEqual(t, triggerChecksum(stmts), triggerChecksum(other))
+}
+
+func TestUnknownIndexColumn(t *testing.T) {
+	_, err := NewManager(context.Background(), "postgres://localhost/tulip", RBACWithDomain, WithIndexes("v0", "v9"))
+	assert.EqualError(t, err, `tulip.NewManager: unknown index column "v9"`)
+}
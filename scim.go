@@ -0,0 +1,364 @@
+package tulip
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	scimUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string     `json:"schemas"`
+	ID       string       `json:"id"`
+	UserName string       `json:"userName"`
+	Active   *bool        `json:"active,omitempty"`
+	Groups   []scimMember `json:"groups,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+}
+
+type scimPatch struct {
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+// scimHandler serves the SCIM endpoints of a single domain
+type scimHandler struct {
+	m      *Manager
+	domain string
+}
+
+// NewSCIMHandler returns a SCIM 2.0 server for provisioning from identity providers
+// such as Okta or Azure AD, to be mounted at the SCIM base URL with http.StripPrefix.
+// It maps provisioning calls to grouping rules of domain:
+//
+//   - a Group is a role, identified by its displayName, whose members are the users
+//     holding it. Creating, replacing and patching a group adds and removes grouping
+//     rules, deleting it removes all of them.
+//   - a User is identified by its userName. Users aren't stored, they exist through
+//     their memberships: deactivating or deleting a user removes all of them.
+//
+// Only the parts of the protocol needed for joiner/mover/leaver flows are implemented,
+// e.g. filtering supports `userName eq "..."` and `displayName eq "..."` only. The
+// handler doesn't authenticate requests, wrap it with the identity provider's bearer
+// token check. With WithPseudonymizedSubjects, users and groups are looked up by their
+// pseudonym and the members and groups listed in responses are pseudonyms.
+func NewSCIMHandler(m *Manager, domain string) http.Handler {
+	return &scimHandler{m: m, domain: domain}
+}
+
+func (h *scimHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.Trim(r.URL.Path, "/")
+	resource, id := p, ""
+	if i := strings.Index(p, "/"); i >= 0 {
+		resource, id = p[:i], p[i+1:]
+	}
+	switch resource {
+	case "Users":
+		h.serveUsers(w, r, id)
+	case "Groups":
+		h.serveGroups(w, r, id)
+	default:
+		scimError(w, http.StatusNotFound, "unknown resource "+resource)
+	}
+}
+
+func (h *scimHandler) user(name string) *scimUser {
+	rules := h.m.FilterGroups(h.m.Pseudonym(name), "", h.domain)
+	if len(rules) == 0 {
+		return nil
+	}
+	active := true
+	u := &scimUser{Schemas: []string{scimUserSchema}, ID: name, UserName: name, Active: &active}
+	for _, rule := range rules {
+		u.Groups = append(u.Groups, scimMember{Value: rule[1], Display: rule[1]})
+	}
+	return u
+}
+
+func (h *scimHandler) group(name string) *scimGroup {
+	g := &scimGroup{Schemas: []string{scimGroupSchema}, ID: name, DisplayName: name, Members: []scimMember{}}
+	for _, rule := range h.m.FilterGroups("", h.m.Pseudonym(name), h.domain) {
+		g.Members = append(g.Members, scimMember{Value: rule[0], Display: rule[0]})
+	}
+	return g
+}
+
+// removeUser removes all memberships of user in the domain
+func (h *scimHandler) removeUser(user string) error {
+	rules := Policies{}
+	for _, rule := range h.m.FilterGroups(h.m.Pseudonym(user), "", h.domain) {
+		rules = append(rules, trimRule(rule))
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return h.m.RemovePolicies(nil, rules)
+}
+
+// setMembers makes users the members of role, or adds them if replace is false
+func (h *scimHandler) setMembers(role string, members []scimMember, replace bool) error {
+	var add, remove [][]string
+	want := map[string]bool{}
+	for _, mb := range members {
+		want[h.m.Pseudonym(mb.Value)] = true
+		add = append(add, []string{mb.Value, role, h.domain})
+	}
+	if replace {
+		for _, rule := range h.m.FilterGroups("", h.m.Pseudonym(role), h.domain) {
+			if !want[rule[0]] {
+				remove = append(remove, trimRule(rule))
+			}
+		}
+	}
+	if len(add) > 0 {
+		if _, err := h.m.AddPolicies(nil, add); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		return h.m.RemovePolicies(nil, remove)
+	}
+	return nil
+}
+
+func (h *scimHandler) removeMembers(role string, users []string) error {
+	var rules [][]string
+	for _, u := range users {
+		if len(h.m.FilterGroups(h.m.Pseudonym(u), h.m.Pseudonym(role), h.domain)) > 0 {
+			rules = append(rules, []string{u, role, h.domain})
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return h.m.RemovePolicies(nil, rules)
+}
+
+var scimFilterRe = regexp.MustCompile(`^(\w+) eq "([^"]*)"$`)
+
+// scimFilterValue returns the value of an `attr eq "value"` filter
+func scimFilterValue(r *http.Request, attr string) (string, bool) {
+	match := scimFilterRe.FindStringSubmatch(r.URL.Query().Get("filter"))
+	if match == nil || match[1] != attr {
+		return "", false
+	}
+	return match[2], true
+}
+
+func (h *scimHandler) serveUsers(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		var res []interface{}
+		if name, ok := scimFilterValue(r, "userName"); ok {
+			if u := h.user(name); u != nil {
+				res = append(res, u)
+			}
+		}
+		scimList(w, res)
+	case id == "" && r.Method == http.MethodPost:
+		u := &scimUser{}
+		if err := json.NewDecoder(r.Body).Decode(u); err != nil || u.UserName == "" {
+			scimError(w, http.StatusBadRequest, "invalid user")
+			return
+		}
+		u.Schemas, u.ID = []string{scimUserSchema}, u.UserName
+		scimWrite(w, http.StatusCreated, u)
+	case id == "":
+		scimError(w, http.StatusMethodNotAllowed, "method not allowed")
+	case r.Method == http.MethodGet:
+		u := h.user(id)
+		if u == nil {
+			scimError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		scimWrite(w, http.StatusOK, u)
+	case r.Method == http.MethodPut:
+		u := &scimUser{}
+		if err := json.NewDecoder(r.Body).Decode(u); err != nil {
+			scimError(w, http.StatusBadRequest, "invalid user")
+			return
+		}
+		if u.Active != nil && !*u.Active {
+			if err := h.removeUser(id); err != nil {
+				scimError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		u.Schemas, u.ID, u.UserName = []string{scimUserSchema}, id, id
+		scimWrite(w, http.StatusOK, u)
+	case r.Method == http.MethodPatch:
+		patch := &scimPatch{}
+		if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+			scimError(w, http.StatusBadRequest, "invalid patch")
+			return
+		}
+		for _, op := range patch.Operations {
+			if !strings.EqualFold(op.Op, "replace") {
+				continue
+			}
+			var deactivate bool
+			if op.Path == "active" {
+				var active bool
+				deactivate = json.Unmarshal(op.Value, &active) == nil && !active
+			} else if op.Path == "" {
+				var v struct {
+					Active *bool `json:"active"`
+				}
+				deactivate = json.Unmarshal(op.Value, &v) == nil && v.Active != nil && !*v.Active
+			}
+			if deactivate {
+				if err := h.removeUser(id); err != nil {
+					scimError(w, http.StatusInternalServerError, err.Error())
+					return
+				}
+			}
+		}
+		u := h.user(id)
+		if u == nil {
+			active := false
+			u = &scimUser{Schemas: []string{scimUserSchema}, ID: id, UserName: id, Active: &active}
+		}
+		scimWrite(w, http.StatusOK, u)
+	case r.Method == http.MethodDelete:
+		if err := h.removeUser(id); err != nil {
+			scimError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		scimError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+var scimMemberPathRe = regexp.MustCompile(`^members\[value eq "([^"]*)"\]$`)
+
+func (h *scimHandler) serveGroups(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		var res []interface{}
+		if name, ok := scimFilterValue(r, "displayName"); ok {
+			if g := h.group(name); len(g.Members) > 0 {
+				res = append(res, g)
+			}
+		}
+		scimList(w, res)
+	case id == "" && r.Method == http.MethodPost, id != "" && r.Method == http.MethodPut:
+		g := &scimGroup{}
+		if err := json.NewDecoder(r.Body).Decode(g); err != nil || (id == "" && g.DisplayName == "") {
+			scimError(w, http.StatusBadRequest, "invalid group")
+			return
+		}
+		if id == "" {
+			id = g.DisplayName
+		}
+		if err := h.setMembers(id, g.Members, true); err != nil {
+			scimError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		scimWrite(w, status, h.group(id))
+	case id == "":
+		scimError(w, http.StatusMethodNotAllowed, "method not allowed")
+	case r.Method == http.MethodGet:
+		scimWrite(w, http.StatusOK, h.group(id))
+	case r.Method == http.MethodPatch:
+		patch := &scimPatch{}
+		if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+			scimError(w, http.StatusBadRequest, "invalid patch")
+			return
+		}
+		for _, op := range patch.Operations {
+			var err error
+			switch {
+			case strings.EqualFold(op.Op, "add") && op.Path == "members",
+				strings.EqualFold(op.Op, "replace") && op.Path == "members":
+				var members []scimMember
+				if err := json.Unmarshal(op.Value, &members); err != nil {
+					scimError(w, http.StatusBadRequest, "invalid members")
+					return
+				}
+				err = h.setMembers(id, members, strings.EqualFold(op.Op, "replace"))
+			case strings.EqualFold(op.Op, "remove"):
+				var users []string
+				if match := scimMemberPathRe.FindStringSubmatch(op.Path); match != nil {
+					users = append(users, match[1])
+				} else if op.Path == "members" {
+					var members []scimMember
+					if err := json.Unmarshal(op.Value, &members); err != nil {
+						scimError(w, http.StatusBadRequest, "invalid members")
+						return
+					}
+					for _, mb := range members {
+						users = append(users, mb.Value)
+					}
+				}
+				err = h.removeMembers(id, users)
+			}
+			if err != nil {
+				scimError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		scimWrite(w, http.StatusOK, h.group(id))
+	case r.Method == http.MethodDelete:
+		if err := h.setMembers(id, nil, true); err != nil {
+			scimError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		scimError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func scimWrite(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func scimList(w http.ResponseWriter, resources []interface{}) {
+	if resources == nil {
+		resources = []interface{}{}
+	}
+	scimWrite(w, http.StatusOK, map[string]interface{}{
+		"schemas":      []string{scimListSchema},
+		"totalResults": len(resources),
+		"startIndex":   1,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+func scimError(w http.ResponseWriter, status int, detail string) {
+	scimWrite(w, status, map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
@@ -0,0 +1,91 @@
+package tulip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testSCIM(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+	h := NewSCIMHandler(m, "corp")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/Groups", `{"displayName": "eng", "members": [{"value": "alice"}, {"value": "bob"}]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, m.FilterGroups("", "eng", "corp"), 2)
+
+	rec = do(http.MethodPatch, "/Groups/eng", `{"Operations": [
+		{"op": "remove", "path": "members[value eq \"bob\"]"},
+		{"op": "add", "path": "members", "value": [{"value": "carol"}]}
+	]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var g scimGroup
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &g))
+	assert.Equal(t, []scimMember{{"alice", "alice"}, {"carol", "carol"}}, g.Members)
+
+	rec = do(http.MethodGet, `/Users?filter=userName+eq+%22alice%22`, "")
+	assert.Contains(t, rec.Body.String(), `"totalResults":1`)
+
+	rec = do(http.MethodPatch, "/Users/alice", `{"Operations": [{"op": "replace", "value": {"active": false}}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, m.FilterGroups("alice", "", "corp"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/Users/alice", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/Groups/eng", "").Code)
+	assert.Equal(t, 0, m.GroupingPolicyCount())
+}
+
+func TestSCIMPseudonymized(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain,
+		WithoutPeriodicSync(), WithPseudonymizedSubjects([]byte("salt")))
+	require.NoError(t, err)
+	defer m.Close()
+	h := NewSCIMHandler(m, "corp")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/Groups", `{"displayName": "eng", "members": [{"value": "alice"}, {"value": "bob"}]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, m.FilterGroups("", m.Pseudonym("eng"), "corp"), 2)
+	assert.NotContains(t, rec.Body.String(), "alice")
+
+	rec = do(http.MethodPut, "/Groups/eng", `{"members": [{"value": "alice"}, {"value": "carol"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var g scimGroup
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &g))
+	assert.ElementsMatch(t, []scimMember{
+		{m.Pseudonym("alice"), m.Pseudonym("alice")},
+		{m.Pseudonym("carol"), m.Pseudonym("carol")},
+	}, g.Members)
+
+	rec = do(http.MethodPatch, "/Groups/eng", `{"Operations": [{"op": "remove", "path": "members[value eq \"carol\"]"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, m.HasRole("carol", "eng", "corp"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/Users/alice", "").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/Users/alice", "").Code)
+	assert.Equal(t, 0, m.GroupingPolicyCount())
+}
@@ -0,0 +1,73 @@
+package tulip
+
+// Change is a proposed addition or removal of a rule
+type Change struct {
+	Op    EventOp
+	PType string
+	Rule  []string
+}
+
+// Decision is the outcome of a simulated request
+type Decision struct {
+	Request []string
+	// Allowed is the decision with the changes applied, Current the decision
+	// with the rules as they are
+	Allowed bool
+	Current bool
+}
+
+// Changed tells whether the simulated changes alter the decision
+func (d Decision) Changed() bool {
+	return d.Allowed != d.Current
+}
+
+// Simulate evaluates requests against the cached rules with changes applied, without
+// touching the database or the cache, to show the effect of changes before making
+// them.
+func (m *Manager) Simulate(changes []Change, requests [][]string) []Decision {
+	view := m.sandbox()
+	for _, c := range changes {
+		p := view.policySet(c.PType, true)
+		switch c.Op {
+		case EventInsert:
+			p.Insert(padRule(c.Rule))
+		case EventRemove:
+			p.Remove(padRule(c.Rule))
+		}
+	}
+	res := make([]Decision, len(requests))
+	for i, req := range requests {
+		res[i] = Decision{
+			Request: req,
+			Allowed: view.matcher(view, req...),
+			Current: m.matcher(m, req...),
+		}
+	}
+	return res
+}
+
+// sandbox returns a view of m holding a copy of the cached rules, which can be
+// changed without affecting m
+func (m *Manager) sandbox() *Manager {
+	view := m.view()
+	sets := m.snapshot()
+	view.extra = map[string]*Policies{}
+	for ptype, rules := range sets {
+		rules := rules
+		switch ptype {
+		case "p":
+			view.p = rules
+		case "g":
+			view.g = rules
+		default:
+			view.extra[ptype] = &rules
+		}
+	}
+	if sets["p"] == nil {
+		view.p = Policies{}
+	}
+	if sets["g"] == nil {
+		view.g = Policies{}
+	}
+	return view
+}
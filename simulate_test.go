@@ -0,0 +1,33 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulate(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+
+	decisions := m.Simulate([]Change{
+		{Op: EventRemove, PType: "g", Rule: []string{"alice", "teacher", "uni"}},
+		{Op: EventInsert, PType: "g", Rule: []string{"bob", "teacher", "uni"}},
+	}, [][]string{
+		{"alice", "uni", "class_a", "teach"},
+		{"bob", "uni", "class_a", "teach"},
+		{"carol", "uni", "class_a", "teach"},
+	})
+	assert.Equal(t, []Decision{
+		{Request: []string{"alice", "uni", "class_a", "teach"}, Allowed: false, Current: true},
+		{Request: []string{"bob", "uni", "class_a", "teach"}, Allowed: true, Current: false},
+		{Request: []string{"carol", "uni", "class_a", "teach"}, Allowed: false, Current: false},
+	}, decisions)
+	assert.True(t, decisions[0].Changed())
+	assert.False(t, decisions[2].Changed())
+
+	// the cache is untouched
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.Equal(t, 1, m.GroupingPolicyCount())
+}
@@ -0,0 +1,174 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// WithSnapshots creates the tables holding the snapshots taken by TagSnapshot, named
+// after the rule table with suffixes "_snapshot" and "_snapshot_rule".
+func WithSnapshots() Option {
+	return func(m *Manager) {
+		m.snapshots = true
+	}
+}
+
+func snapshotTableSQL(t string) []string {
+	return []string{
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_snapshot (
+				name text PRIMARY KEY,
+				rule_count integer NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT now()
+			)
+		`, t),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s_snapshot_rule (
+				name text NOT NULL REFERENCES %s_snapshot (name) ON DELETE CASCADE,
+				id text NOT NULL,
+				p_type text,
+				v0 text,
+				v1 text,
+				v2 text,
+				v3 text,
+				v4 text,
+				v5 text,
+				effective_from timestamptz,
+				PRIMARY KEY (name, id)
+			)
+		`, t, t),
+	}
+}
+
+// Snapshot describes a snapshot taken by TagSnapshot
+type Snapshot struct {
+	Name      string
+	RuleCount int
+	CreatedAt time.Time
+}
+
+// TagSnapshot saves a copy of all stored rules under name, to be restored with
+// RestoreSnapshot. It requires WithSnapshots and returns ErrSnapshotExists if name is
+// taken.
+func (m *Manager) TagSnapshot(name string) error {
+	if err := m.checkWritable(); err != nil {
+		return fmt.Errorf("tulip.TagSnapshot: %w", err)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return fmt.Errorf("tulip.TagSnapshot: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	err := m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %s_snapshot (name, rule_count) SELECT $1, count(*) FROM %s
+			ON CONFLICT (name) DO NOTHING
+		`, m.tableName, m.tableName), name)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: %q", ErrSnapshotExists, name)
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %s_snapshot_rule (name, id, p_type, v0, v1, v2, v3, v4, v5, effective_from)
+			SELECT $1, %s FROM %s
+		`, m.tableName, m.cols.all(), m.tableName), name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("tulip.TagSnapshot: %w", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces the stored rules with those saved under name in a single
+// transaction, then reloads the cache. Only rules that differ from the snapshot are
+// written, so other managers are notified of the actual changes only. It returns
+// ErrSnapshotNotFound if there is no such snapshot.
+func (m *Manager) RestoreSnapshot(name string) error {
+	if err := m.checkWritable(); err != nil {
+		return fmt.Errorf("tulip.RestoreSnapshot: %w", err)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return fmt.Errorf("tulip.RestoreSnapshot: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	err := m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var found bool
+		err := tx.QueryRow(ctx,
+			fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s_snapshot WHERE name = $1)", m.tableName), name,
+		).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: %q", ErrSnapshotNotFound, name)
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM %s WHERE %s NOT IN (SELECT id FROM %s_snapshot_rule WHERE name = $1)
+		`, m.tableName, m.cols.id, m.tableName), name); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %[1]s (%[2]s)
+			SELECT id, p_type, v0, v1, v2, v3, v4, v5, effective_from FROM %[1]s_snapshot_rule s
+			WHERE name = $1 AND NOT EXISTS (SELECT 1 FROM %[1]s t WHERE t.%[3]s = s.id)
+		`, m.tableName, m.cols.all(), m.cols.id), name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("tulip.RestoreSnapshot: %w", err)
+	}
+	if _, _, err := m.loadPolicies(ctx); err != nil {
+		return fmt.Errorf("tulip.RestoreSnapshot: %w", err)
+	}
+	return nil
+}
+
+// Snapshots lists the snapshots taken by TagSnapshot, oldest first
+func (m *Manager) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	if m.isClosed() {
+		return nil, fmt.Errorf("tulip.Snapshots: %w", ErrClosed)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return nil, fmt.Errorf("tulip.Snapshots: %w", err)
+	}
+	var (
+		s   Snapshot
+		res []Snapshot
+	)
+	_, err := m.readerPool().QueryFunc(ctx,
+		fmt.Sprintf("SELECT name, rule_count, created_at FROM %s_snapshot ORDER BY created_at, name", m.tableName),
+		nil,
+		[]interface{}{&s.Name, &s.RuleCount, &s.CreatedAt},
+		func(pgx.QueryFuncRow) error {
+			res = append(res, s)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tulip.Snapshots: %w", err)
+	}
+	return res, nil
+}
+
+// DeleteSnapshot removes the snapshot saved under name
+func (m *Manager) DeleteSnapshot(name string) error {
+	if err := m.checkWritable(); err != nil {
+		return fmt.Errorf("tulip.DeleteSnapshot: %w", err)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return fmt.Errorf("tulip.DeleteSnapshot: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	if _, err := m.pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s_snapshot WHERE name = $1", m.tableName), name); err != nil {
+		return fmt.Errorf("tulip.DeleteSnapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testSnapshots(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithSnapshots(),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	require.NoError(t, m.TagSnapshot("v1"))
+	assert.ErrorIs(t, m.TagSnapshot("v1"), ErrSnapshotExists)
+
+	require.NoError(t, m.RemovePolicies(nil, [][]string{{"aaron", "teacher", "uni"}}))
+	_, err = m.AddPolicies([][]string{{"mallory", "uni", "grades", "write"}}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, m.RestoreSnapshot("v1"))
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("mallory", "uni", "grades", "write"))
+	assert.ErrorIs(t, m.RestoreSnapshot("v0"), ErrSnapshotNotFound)
+
+	snaps, err := m.Snapshots(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	assert.Equal(t, "v1", snaps[0].Name)
+	assert.Equal(t, 2, snaps[0].RuleCount)
+	require.NoError(t, m.DeleteSnapshot("v1"))
+}
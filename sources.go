@@ -0,0 +1,55 @@
+package tulip
+
+import "sort"
+
+// PolicySource provides read-only "p" and "g" rules that are merged into evaluation,
+// see WithPolicySources. A *Manager is a PolicySource, so rules of another table can
+// be layered by using a second manager, typically created with WithReadOnly.
+type PolicySource interface {
+	FindExact(rule ...string) []string
+	Filter(rule ...string) Policies
+	FilterGroups(rule ...string) Policies
+}
+
+// WithPolicySources merges the rules of sources into lookups made by matchers, such as
+// a base "platform" policy set layered under tenant-specific rules. The rules of
+// sources are consulted after the manager's own rules and are never written to its
+// table, and functions listing or counting stored rules don't include them.
+func WithPolicySources(sources ...PolicySource) Option {
+	return func(m *Manager) {
+		m.sources = append(m.sources, sources...)
+	}
+}
+
+// staticSource is a PolicySource over fixed rules
+type staticSource struct {
+	p Policies
+	g Policies
+}
+
+// NewStaticSource returns a PolicySource holding policies p and grouping policies g,
+// such as rules read from a file shipped with the application.
+func NewStaticSource(p, g [][]string) PolicySource {
+	s := &staticSource{}
+	for _, rule := range p {
+		s.p = append(s.p, padRule(rule))
+	}
+	for _, rule := range g {
+		s.g = append(s.g, padRule(rule))
+	}
+	sort.Sort(s.p)
+	sort.Sort(s.g)
+	return s
+}
+
+func (s *staticSource) FindExact(rule ...string) []string {
+	return s.p.Find(rule)
+}
+
+func (s *staticSource) Filter(rule ...string) Policies {
+	return s.p.Filter(rule...)
+}
+
+func (s *staticSource) FilterGroups(rule ...string) Policies {
+	return s.g.Filter(rule...)
+}
@@ -0,0 +1,31 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicySources(t *testing.T) {
+	platform := NewStaticSource(
+		[][]string{{"operator", "tenant_a", "metrics", "read"}},
+		[][]string{{"sre", "operator", "tenant_a"}},
+	)
+	base := newManager(RBACWithDomain, nil)
+	base.cacheInsert("p", []string{"auditor", "tenant_a", "logs", "read"}, SourceLocal)
+
+	m := newManager(RBACWithDomain, []Option{WithPolicySources(platform, base)})
+	m.cacheInsert("p", []string{"alice", "tenant_a", "docs", "edit"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "auditor", "tenant_a"}, SourceLocal)
+	m.cacheInsert("g", []string{"carol", "operator", "tenant_a"}, SourceLocal)
+
+	assert.True(t, m.Enforce("alice", "tenant_a", "docs", "edit"))
+	assert.True(t, m.Enforce("operator", "tenant_a", "metrics", "read"))
+	assert.True(t, m.Enforce("sre", "tenant_a", "metrics", "read"))
+	assert.True(t, m.Enforce("carol", "tenant_a", "metrics", "read"))
+	assert.True(t, m.Enforce("bob", "tenant_a", "logs", "read"))
+	assert.False(t, m.Enforce("bob", "tenant_b", "logs", "read"))
+	assert.Equal(t, 1, m.PolicyCount())
+	assert.True(t, m.EnforceWithContext([]string{"dave", "tenant_a", "metrics", "read"}, nil,
+		[][]string{{"dave", "operator", "tenant_a"}}))
+}
@@ -0,0 +1,77 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// WithSQLEnforcement makes the manager keep no rules in memory: policies aren't loaded,
+// no listener or periodic sync runs, and Enforce evaluates each request with
+// QueryEnforce. This suits memory-constrained environments such as serverless
+// functions, at the cost of a round trip per request. The matcher passed to
+// NewManager is ignored, and functions reading the cache, such as Filter, Events or
+// PolicyCount, see no rules.
+func WithSQLEnforcement() Option {
+	return func(m *Manager) {
+		m.sqlOnly = true
+	}
+}
+
+// QueryEnforce evaluates a request (sub, dom, obj, act) of the RBACWithDomain model with
+// a single query joining "p" and "g" rules in the database, rather than against the
+// cache.
+func (m *Manager) QueryEnforce(ctx context.Context, request ...string) (bool, error) {
+	return m.queryEnforce(ctx, m.pseudonymizeRequest(request))
+}
+
+// queryEnforce is QueryEnforce for a pseudonymized request
+func (m *Manager) queryEnforce(ctx context.Context, request []string) (bool, error) {
+	if len(request) != 4 {
+		return false, fmt.Errorf("tulip.QueryEnforce: request has %d values, expected 4", len(request))
+	}
+	if m.isClosed() {
+		return false, fmt.Errorf("tulip.QueryEnforce: %w", ErrClosed)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return false, fmt.Errorf("tulip.QueryEnforce: %w", err)
+	}
+	request, err := m.encodeValues(request)
+	if err != nil {
+		return false, fmt.Errorf("tulip.QueryEnforce: %w", err)
+	}
+	var allowed bool
+	c := m.cols
+	err = m.readerPool().QueryRow(ctx, fmt.Sprintf(`
+		SELECT EXISTS (
+			SELECT 1 FROM %[1]s p
+			WHERE p.%[2]s = 'p' AND p.%[5]s = $2 AND p.%[6]s = $3 AND p.%[7]s = $4
+			AND (p.%[3]s IS NULL OR p.%[3]s <= now())
+			AND (p.%[4]s = $1 OR EXISTS (
+				SELECT 1 FROM %[1]s g
+				WHERE g.%[2]s = 'g' AND g.%[4]s = $1 AND g.%[5]s = p.%[4]s AND g.%[6]s = $2
+				AND (g.%[3]s IS NULL OR g.%[3]s <= now())
+			))
+		)
+	`, m.tableName, c.ptype, c.from, c.v[0], c.v[1], c.v[2], c.v[3]), request[0], request[1], request[2], request[3]).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("tulip.QueryEnforce: %w", err)
+	}
+	return allowed, nil
+}
+
+// enforceSQL is Enforce for managers created with WithSQLEnforcement. Requests are
+// denied if the query fails.
+func (m *Manager) enforceSQL(ctx context.Context, request []string) bool {
+	ctx, cancel := context.WithTimeout(ctx, m.timeouts.query)
+	defer cancel()
+	allowed, err := m.queryEnforce(ctx, request)
+	if err != nil {
+		if logger := m.log(ctx); logger != nil {
+			logger.Error("denied request, enforcement query failed", zap.Error(err))
+		}
+		return false
+	}
+	return allowed
+}
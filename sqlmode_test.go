@@ -0,0 +1,35 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testSQLEnforcement(t *testing.T, connStr string, opts []Option) {
+	opts = append(opts,
+		WithTableName(BrokenRandomLowerAlphaString(5)),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithSQLEnforcement(),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}, {"alice", "uni", "class_b", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 0, m.PolicyCount())
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.True(t, m.Enforce("alice", "uni", "class_b", "teach"))
+	assert.False(t, m.Enforce("aaron", "uni", "class_b", "teach"))
+	assert.False(t, m.Enforce("aaron", "lab", "class_a", "teach"))
+
+	_, err = m.QueryEnforce(context.Background(), "aaron", "uni")
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// StartupPolicy decides the requests enforced before the manager first loaded its
+// rules, see WithStartupPolicy
+type StartupPolicy int
+
+const (
+	// StartupDeny denies every request
+	StartupDeny StartupPolicy = iota + 1
+	// StartupAllow grants every request, for services that would rather fail open
+	// than be unavailable
+	StartupAllow
+	// StartupError denies every request and makes the methods returning an error,
+	// such as EnforceErr and EnforceWith, return ErrNotReady
+	StartupError
+)
+
+func (p StartupPolicy) String() string {
+	switch p {
+	case StartupDeny:
+		return "deny"
+	case StartupAllow:
+		return "allow"
+	case StartupError:
+		return "error"
+	}
+	return fmt.Sprintf("StartupPolicy(%d)", int(p))
+}
+
+// WithStartupPolicy makes NewManager return without waiting for the rules to be
+// loaded: they are loaded in the background, trying again until it succeeds, and
+// requests enforced in the meantime are decided by policy rather than by an empty
+// cache. Ready tells whether the rules are loaded and Health returns ErrNotReady
+// until they are. Rules of a warm start are enforced right away, see WithWarmStart.
+func WithStartupPolicy(policy StartupPolicy) Option {
+	return func(m *Manager) {
+		m.startup = policy
+	}
+}
+
+// Ready tells whether requests are evaluated against the rules, which is the case
+// once the manager loaded them or started from the rules of WithWarmStart or
+// WithInitialRules. It is only false with WithStartupPolicy.
+func (m *Manager) Ready() bool {
+	return m.startup == 0 || atomic.LoadInt32(&m.ready) == 1
+}
+
+// setReady records that the cache holds rules to evaluate requests against
+func (m *Manager) setReady() {
+	atomic.StoreInt32(&m.ready, 1)
+}
+
+// EnforceErr is Enforce returning ErrNotReady rather than denying request when the
+// manager has StartupError and hasn't loaded its rules yet
+func (m *Manager) EnforceErr(request ...string) (bool, error) {
+	if !m.Ready() && m.startup == StartupError {
+		return false, fmt.Errorf("tulip.EnforceErr: %w", ErrNotReady)
+	}
+	return m.enforce(context.Background(), "default", m.matcher, request), nil
+}
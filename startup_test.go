@@ -0,0 +1,70 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy  StartupPolicy
+		allowed bool
+		err     error
+	}{
+		{StartupDeny, false, nil},
+		{StartupAllow, true, nil},
+		{StartupError, false, ErrNotReady},
+	} {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			s := NewMemoryStorage()
+			_, err := s.Insert(context.Background(), []StoredRule{{PType: "p", Rule: []string{"alice", "uni", "class_a", "teach"}}})
+			require.NoError(t, err)
+			gated := &gatedStorage{s, make(chan struct{})}
+			m, err := NewManagerWithStorage(context.Background(), gated, RBACWithDomain,
+				WithoutPeriodicSync(),
+				WithStartupPolicy(c.policy),
+				WithNamedMatcher("rbac", RBACWithDomain),
+			)
+			require.NoError(t, err)
+			defer m.Close()
+			assert.False(t, m.Ready())
+			assert.ErrorIs(t, m.Health(), ErrNotReady)
+			assert.Equal(t, c.allowed, m.Enforce("alice", "uni", "class_a", "teach"))
+			assert.Equal(t, c.allowed, m.Enforce("bob", "uni", "class_a", "teach"))
+			allowed, err := m.EnforceErr("alice", "uni", "class_a", "teach")
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.allowed, allowed)
+			allowed, err = m.EnforceWith("rbac", "alice", "uni", "class_a", "teach")
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.allowed, allowed)
+
+			close(gated.gate)
+			retryUntil(t, 10*time.Millisecond, 100, m.Ready, func() string { return "waiting for the initial load" })
+			assert.NoError(t, m.Health())
+			assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+			assert.False(t, m.Enforce("bob", "uni", "class_a", "teach"))
+			allowed, err = m.EnforceErr("bob", "uni", "class_a", "teach")
+			assert.NoError(t, err)
+			assert.False(t, allowed)
+		})
+	}
+}
+
+func TestStartupPolicyWarmStart(t *testing.T) {
+	gated := &gatedStorage{NewMemoryStorage(), make(chan struct{})}
+	m, err := NewManagerWithStorage(context.Background(), gated, RBACWithDomain,
+		WithoutPeriodicSync(),
+		WithStartupPolicy(StartupError),
+		WithInitialRules(map[string][][]string{"p": {{"alice", "uni", "class_a", "teach"}}}),
+	)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.True(t, m.Ready())
+	allowed, err := m.EnforceErr("alice", "uni", "class_a", "teach")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+}
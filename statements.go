@@ -0,0 +1,86 @@
+package tulip
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
+)
+
+// statements holds the SQL of the hot queries, formatted once by newManager. Keeping
+// the text fixed lets pgx prepare each of them once per connection and reuse it.
+type statements struct {
+	insert     string
+	remove     string
+	removeMany string
+	load       string
+}
+
+func newStatements(m *Manager) statements {
+	c := m.cols
+	s := statements{
+		remove:     fmt.Sprintf("DELETE FROM %s WHERE %s = $1", m.tableName, c.id),
+		removeMany: fmt.Sprintf("DELETE FROM %s WHERE %s = ANY($1)", m.tableName, c.id),
+		load: fmt.Sprintf(
+			`SELECT %s, %s, %s FROM %s`, c.ptype, c.values(""), c.from, m.tableName,
+		),
+	}
+	if m.groupExpiry {
+		s.load = fmt.Sprintf(
+			`SELECT t.%s, %s, t.%s, e.expires_at FROM %s t LEFT JOIN %s_expiry e ON e.id = t.%s`,
+			c.ptype, c.values("t."), c.from, m.tableName, m.tableName, c.id,
+		)
+	}
+	if m.normalized {
+		// the view's trigger skips existing rules, ON CONFLICT can't target a view
+		s.insert = fmt.Sprintf(`
+			INSERT INTO %s (%s)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, m.tableName, c.all())
+	} else {
+		s.insert = fmt.Sprintf(`
+			INSERT INTO %s (%s)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (%s) DO NOTHING
+		`, m.tableName, c.all(), c.id)
+	}
+	return s
+}
+
+// StatementCacheMode tells how connections cache statements, see WithStatementCache
+type StatementCacheMode int
+
+const (
+	// StatementCachePrepare prepares each statement as a named prepared statement
+	// the first time a connection runs it. This is the pgx default.
+	StatementCachePrepare StatementCacheMode = iota
+	// StatementCacheDescribe only caches statement descriptions, for poolers such as
+	// PgBouncer in transaction mode that don't support named prepared statements
+	StatementCacheDescribe
+	// StatementCacheDisabled parses every statement anew
+	StatementCacheDisabled
+)
+
+// WithStatementCache configures the statement cache of every connection, holding up
+// to capacity statements. By default pgx prepares up to 512 statements per connection.
+func WithStatementCache(mode StatementCacheMode, capacity int) Option {
+	return func(m *Manager) {
+		m.stmtCacheMode = mode
+		m.stmtCacheCapacity = capacity
+		m.stmtCacheSet = true
+	}
+}
+
+// statementCache returns the statement cache builder for connections as configured
+// with WithStatementCache
+func (m *Manager) statementCache() func(conn *pgconn.PgConn) stmtcache.Cache {
+	if m.stmtCacheMode == StatementCacheDisabled || m.stmtCacheCapacity <= 0 {
+		return nil
+	}
+	mode := stmtcache.ModePrepare
+	if m.stmtCacheMode == StatementCacheDescribe {
+		mode = stmtcache.ModeDescribe
+	}
+	return func(conn *pgconn.PgConn) stmtcache.Cache {
+		return stmtcache.New(conn, mode, m.stmtCacheCapacity)
+	}
+}
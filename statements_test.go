@@ -0,0 +1,21 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatements(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithTableName("rules")})
+	assert.Equal(t, "DELETE FROM rules WHERE id = $1", m.stmts.remove)
+	assert.Contains(t, m.stmts.insert, "ON CONFLICT (id) DO NOTHING")
+	// adopted tables may name their primary key constraint differently
+	m = newManager(RBACWithDomain, []Option{WithColumns(Columns{ID: "Rule ID"})})
+	assert.Contains(t, m.stmts.insert, `ON CONFLICT ("Rule ID") DO NOTHING`)
+	assert.NotContains(t, newManager(RBACWithDomain, []Option{WithNormalizedSchema()}).stmts.insert, "ON CONFLICT")
+
+	assert.Nil(t, newManager(RBACWithDomain, []Option{WithStatementCache(StatementCacheDisabled, 100)}).statementCache())
+	assert.Nil(t, newManager(RBACWithDomain, []Option{WithStatementCache(StatementCachePrepare, 0)}).statementCache())
+	assert.NotNil(t, newManager(RBACWithDomain, []Option{WithStatementCache(StatementCacheDescribe, 100)}).statementCache())
+}
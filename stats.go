@@ -0,0 +1,247 @@
+package tulip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Stats is a snapshot of the manager's state
+type Stats struct {
+	PolicyCount         int
+	GroupingPolicyCount int
+
+	// LastSync is the time policies were last fully loaded from the database
+	LastSync time.Time
+	// SinceLastSync is the time elapsed since LastSync
+	SinceLastSync time.Duration
+
+	// Notifications is the number of change notifications received
+	Notifications int64
+	// AvgNotificationLag and MaxNotificationLag measure the delay between a change
+	// being made in the database and its notification being received. They depend on
+	// the database and application clocks being in sync.
+	AvgNotificationLag time.Duration
+	MaxNotificationLag time.Duration
+
+	// ListenerConnected tells whether the notification listener is currently
+	// connected. It is always false in polling mode.
+	ListenerConnected bool
+	// ListenerErrors is the number of times the notification listener failed
+	ListenerErrors int64
+
+	// NotificationsByOrigin counts the change notifications received by the instance
+	// ID of the manager that made the change, see WithInstanceID. Changes made by
+	// other means are counted under the empty string.
+	NotificationsByOrigin map[string]int64
+
+	// EnforceByDomain and EnforceBySubject count the decisions made by domain and by
+	// subject of the request, see WithEnforceStats. They are nil without it.
+	EnforceByDomain  map[string]EnforceCount
+	EnforceBySubject map[string]EnforceCount
+}
+
+// stats holds the counters behind Stats
+type stats struct {
+	mutex         sync.Mutex
+	lastSync      time.Time
+	notifications int64
+	totalLag      time.Duration
+	maxLag        time.Duration
+	loadErr       error
+	limitErr      error
+	listening     bool
+	listenErr     error
+	listenErrors  int64
+	byOrigin      map[string]int64
+}
+
+// StalenessFunc is called with the time elapsed since the last successful sync
+type StalenessFunc func(staleness time.Duration)
+
+// WithStalenessAlert calls f as long as the last successful sync is older than
+// threshold while no notification listener is connected to keep the cache up-to-date.
+// Staleness is checked every 15 seconds, or every threshold if shorter, whether
+// periodic sync is enabled or not.
+func WithStalenessAlert(threshold time.Duration, f StalenessFunc) Option {
+	return func(m *Manager) {
+		m.stalenessThreshold = threshold
+		m.onStale = f
+	}
+}
+
+// Stats returns a snapshot of the manager's state
+func (m *Manager) Stats() Stats {
+	m.mutex.Lock()
+	res := Stats{
+		PolicyCount:         m.p.Len(),
+		GroupingPolicyCount: m.g.Len(),
+	}
+	m.mutex.Unlock()
+	if m.enforceStats != nil {
+		m.enforceStats.snapshot(&res)
+	}
+	m.stats.mutex.Lock()
+	defer m.stats.mutex.Unlock()
+	res.LastSync = m.stats.lastSync
+	if !res.LastSync.IsZero() {
+		res.SinceLastSync = time.Since(res.LastSync)
+	}
+	res.Notifications = m.stats.notifications
+	if m.stats.notifications > 0 {
+		res.AvgNotificationLag = m.stats.totalLag / time.Duration(m.stats.notifications)
+	}
+	res.MaxNotificationLag = m.stats.maxLag
+	res.ListenerConnected = m.stats.listening
+	res.ListenerErrors = m.stats.listenErrors
+	if len(m.stats.byOrigin) > 0 {
+		res.NotificationsByOrigin = make(map[string]int64, len(m.stats.byOrigin))
+		for origin, n := range m.stats.byOrigin {
+			res.NotificationsByOrigin[origin] = n
+		}
+	}
+	return res
+}
+
+// Health returns nil if the manager is in a good state, otherwise an error describing
+// the problem.
+func (m *Manager) Health() error {
+	if m.isClosed() {
+		return ErrClosed
+	}
+	if !m.Ready() {
+		return ErrNotReady
+	}
+	m.stats.mutex.Lock()
+	defer m.stats.mutex.Unlock()
+	if m.stats.loadErr != nil {
+		return fmt.Errorf("last policy load failed: %w", m.stats.loadErr)
+	}
+	if m.stats.limitErr != nil {
+		return m.stats.limitErr
+	}
+	if m.stats.listenErr != nil {
+		return fmt.Errorf("notification listener is down: %w", m.stats.listenErr)
+	}
+	return nil
+}
+
+func (m *Manager) recordSync() {
+	m.stats.mutex.Lock()
+	m.stats.lastSync = time.Now()
+	m.stats.loadErr = nil
+	m.stats.limitErr = nil
+	m.stats.mutex.Unlock()
+	m.metricSet(MetricSecondsSinceLastSync, 0, nil)
+}
+
+func (m *Manager) recordLoadError(err error) {
+	m.stats.mutex.Lock()
+	m.stats.loadErr = err
+	m.stats.mutex.Unlock()
+}
+
+// recordListenError records the listener going down with err, or coming up if err is
+// nil.
+func (m *Manager) recordListenError(err error) {
+	m.stats.mutex.Lock()
+	m.stats.listening = err == nil
+	m.stats.listenErr = err
+	if err != nil {
+		m.stats.listenErrors++
+	}
+	m.stats.mutex.Unlock()
+}
+
+// listenerDown tells whether the last attempt to listen for notifications failed
+func (m *Manager) listenerDown() bool {
+	m.stats.mutex.Lock()
+	defer m.stats.mutex.Unlock()
+	return m.stats.listenErr != nil
+}
+
+// recordLimitExceeded marks the manager unhealthy after dropping rule because the
+// cache is full.
+func (m *Manager) recordLimitExceeded(ptype string, rule []string) {
+	if m.logger != nil {
+		m.logger.Error("dropped rule, policy limit reached",
+			zap.Int("max_policies", m.maxPolicies),
+			zap.String("ptype", ptype),
+			zap.Strings("rule", rule),
+		)
+	}
+	m.stats.mutex.Lock()
+	m.stats.limitErr = fmt.Errorf("%w: cache holds %d rules", ErrTooManyPolicies, m.maxPolicies)
+	m.stats.mutex.Unlock()
+}
+
+func (m *Manager) observeNotificationLag(lag time.Duration) {
+	if lag < 0 {
+		// clocks are skewed
+		lag = 0
+	}
+	m.stats.mutex.Lock()
+	m.stats.notifications++
+	m.stats.totalLag += lag
+	if lag > m.stats.maxLag {
+		m.stats.maxLag = lag
+	}
+	m.stats.mutex.Unlock()
+	m.metricObserve(MetricNotificationLagSeconds, lag.Seconds(), nil)
+}
+
+// recordOrigins counts the change notifications of batch by origin
+func (m *Manager) recordOrigins(batch []policyNotification) {
+	m.stats.mutex.Lock()
+	defer m.stats.mutex.Unlock()
+	for _, obj := range batch {
+		if obj.Op != "INSERT" && obj.Op != "DELETE" {
+			continue
+		}
+		if m.stats.byOrigin == nil {
+			m.stats.byOrigin = map[string]int64{}
+		}
+		m.stats.byOrigin[obj.Origin]++
+	}
+}
+
+// stalenessCheckInterval is how often the staleness of the cache is checked, see
+// WithStalenessAlert
+const stalenessCheckInterval = 15 * time.Second
+
+// monitorStaleness checks the staleness of the cache until the manager is closed, on
+// its own timer as periodic sync may be disabled
+func (m *Manager) monitorStaleness() {
+	interval := stalenessCheckInterval
+	if m.onStale != nil && m.stalenessThreshold > 0 && m.stalenessThreshold < interval {
+		interval = m.stalenessThreshold
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.checkStaleness()
+		}
+	}
+}
+
+// checkStaleness reports the time since the last successful sync to the metrics
+// collector and to the staleness alert.
+func (m *Manager) checkStaleness() {
+	m.stats.mutex.Lock()
+	lastSync, listening := m.stats.lastSync, m.stats.listening
+	m.stats.mutex.Unlock()
+	if lastSync.IsZero() {
+		return
+	}
+	staleness := time.Since(lastSync)
+	m.metricSet(MetricSecondsSinceLastSync, staleness.Seconds(), nil)
+	if m.onStale != nil && !listening && staleness > m.stalenessThreshold {
+		m.onStale(staleness)
+	}
+}
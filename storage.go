@@ -0,0 +1,272 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredRule is a rule as kept by a Storage
+type StoredRule struct {
+	PType string
+	Rule  []string
+	// EffectiveFrom is when the rule takes effect, zero for right away
+	EffectiveFrom time.Time
+	// ExpiresAt is when the rule stops applying, zero for never, see WithGroupExpiry
+	ExpiresAt time.Time
+}
+
+// StorageChange is a modification of a Storage reported by Watch
+type StorageChange struct {
+	StoredRule
+	// Deleted tells whether the rule was deleted rather than inserted
+	Deleted bool
+}
+
+// Storage keeps the rules of a manager. Managers created with NewManager keep them in
+// Postgres, NewManagerWithStorage lets other backends get the manager's cache and
+// matchers. Rules are given as they should be stored: ids, codecs and such are up to
+// the implementation.
+type Storage interface {
+	// Load calls f with every stored rule, stopping at the first error
+	Load(ctx context.Context, f func(StoredRule) error) error
+	// Insert stores rules in a single atomic operation, skipping those already stored.
+	// It returns the number of rules inserted.
+	Insert(ctx context.Context, rules []StoredRule) (inserted int, err error)
+	// Delete removes rules in a single atomic operation, skipping those not stored. It
+	// returns the number of rules deleted.
+	Delete(ctx context.Context, rules []StoredRule) (deleted int, err error)
+	// Watch calls f with every change made to the storage, by any client, in the order
+	// they were made, until ctx is done. It calls ready once it watches, before
+	// reporting any change: changes made earlier may be missed. It returns nil right
+	// away if the storage can't be watched, in which case the manager relies on
+	// periodic syncs. When it fails, the manager reloads all rules and watches again.
+	Watch(ctx context.Context, ready func(), f func(StorageChange)) error
+}
+
+// NewManagerWithStorage creates a manager keeping its rules in s rather than in
+// Postgres, which NewManager keeps behind the same interface. Options that depend on
+// SQL, such as WithSQLEnforcement, are not supported, and neither are idempotency
+// keys, snapshots, event logs, RemoveFilteredPolicies, QueryPolicies and QueryEnforce:
+// those return ErrUnsupported.
+func NewManagerWithStorage(ctx context.Context, s Storage, matcher Matcher, opts ...Option) (*Manager, error) {
+	m := newManager(matcher, opts)
+	m.storage = s
+	if m.sqlOnly {
+		return nil, fmt.Errorf("tulip.NewManagerWithStorage: %w: SQL enforcement", ErrUnsupported)
+	}
+	if m.eventLog {
+		return nil, fmt.Errorf("tulip.NewManagerWithStorage: %w: event log", ErrUnsupported)
+	}
+	if m.groupExpiry {
+		return nil, fmt.Errorf("tulip.NewManagerWithStorage: %w: group expiry", ErrUnsupported)
+	}
+	if m.pollingOnly && m.syncInterval <= 0 {
+		return nil, fmt.Errorf("tulip.NewManagerWithStorage: polling sync requires a positive interval, got %v", m.syncInterval)
+	}
+	m.startWebhook()
+	if err := m.start(ctx); err != nil {
+		return nil, fmt.Errorf("tulip.NewManagerWithStorage: %w", err)
+	}
+	return m, nil
+}
+
+// checkPostgres returns ErrUnsupported unless the rules are kept in Postgres
+func (m *Manager) checkPostgres() error {
+	if _, ok := m.storage.(*postgresStorage); !ok {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// idempotentStorage is implemented by storages that tell which rules they inserted
+// and apply a change at most once per idempotency key, unless key is empty
+type idempotentStorage interface {
+	// insertOnce is Insert telling which rules were inserted, in order, and whether
+	// the change was already applied under key
+	insertOnce(ctx context.Context, rules []StoredRule, key string) (inserted int, added []bool, done bool, err error)
+	// deleteOnce is Delete telling whether the change was already applied under key
+	deleteOnce(ctx context.Context, rules []StoredRule, key string) (deleted int, done bool, err error)
+}
+
+// insertStored inserts rules in the storage in a single operation, see
+// idempotentStorage for added and done. added is nil if the storage doesn't tell.
+func (m *Manager) insertStored(sets []typedRules, from time.Time, key string) (inserted int, added []bool, done bool, err error) {
+	var rules []StoredRule
+	for _, set := range sets {
+		for _, rule := range set.rules {
+			if err := checkRule(set.ptype, rule); err != nil {
+				return 0, nil, false, err
+			}
+			rules = append(rules, StoredRule{PType: set.ptype, Rule: trimRule(rule), EffectiveFrom: from})
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	if s, ok := m.storage.(idempotentStorage); ok {
+		return s.insertOnce(ctx, rules, key)
+	}
+	if key != "" {
+		return 0, nil, false, ErrUnsupported
+	}
+	if len(rules) == 0 {
+		return 0, nil, false, nil
+	}
+	inserted, err = m.storage.Insert(ctx, rules)
+	return inserted, nil, false, err
+}
+
+// deleteStored deletes rules from the storage in a single operation, see
+// idempotentStorage for done
+func (m *Manager) deleteStored(sets []typedRules, key string) (deleted int, done bool, err error) {
+	var rules []StoredRule
+	for _, set := range sets {
+		for _, rule := range set.rules {
+			rules = append(rules, StoredRule{PType: set.ptype, Rule: trimRule(rule)})
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeouts.mutation)
+	defer cancel()
+	if s, ok := m.storage.(idempotentStorage); ok {
+		return s.deleteOnce(ctx, rules, key)
+	}
+	if key != "" {
+		return 0, false, ErrUnsupported
+	}
+	if len(rules) == 0 {
+		return 0, false, nil
+	}
+	deleted, err = m.storage.Delete(ctx, rules)
+	return deleted, false, err
+}
+
+func (m *Manager) applyChange(c StorageChange) {
+	obj := policyNotification{Op: "INSERT", PType: c.PType, Rule: padRule(c.Rule)}
+	if c.Deleted {
+		obj.Op = "DELETE"
+	}
+	if !c.EffectiveFrom.IsZero() {
+		from := c.EffectiveFrom
+		obj.EffectiveFrom = &from
+	}
+	m.applyNotifications([]policyNotification{obj})
+}
+
+// MemoryStorage is a Storage keeping rules in memory. Managers sharing one see each
+// other's changes, which makes it handy to test an application without a database.
+type MemoryStorage struct {
+	mutex    sync.Mutex
+	rules    map[string]StoredRule
+	watchers map[*memoryWatcher]struct{}
+}
+
+// memoryWatcher queues changes for a Watch call without ever blocking writers
+type memoryWatcher struct {
+	mutex   sync.Mutex
+	changes []StorageChange
+	wake    chan struct{}
+}
+
+// NewMemoryStorage returns an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		rules:    map[string]StoredRule{},
+		watchers: map[*memoryWatcher]struct{}{},
+	}
+}
+
+func memoryKey(ptype string, rule []string) string {
+	return ptype + "\x00" + strings.Join(trimRule(rule), "\x00")
+}
+
+func (s *MemoryStorage) Load(ctx context.Context, f func(StoredRule) error) error {
+	s.mutex.Lock()
+	rules := make([]StoredRule, 0, len(s.rules))
+	for _, r := range s.rules {
+		r.Rule = append([]string(nil), r.Rule...)
+		rules = append(rules, r)
+	}
+	s.mutex.Unlock()
+	for _, r := range rules {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Insert(ctx context.Context, rules []StoredRule) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for _, r := range rules {
+		key := memoryKey(r.PType, r.Rule)
+		if _, ok := s.rules[key]; ok {
+			continue
+		}
+		r.Rule = append([]string(nil), trimRule(r.Rule)...)
+		s.rules[key] = r
+		s.notify(StorageChange{StoredRule: r})
+		n++
+	}
+	return n, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, rules []StoredRule) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for _, r := range rules {
+		key := memoryKey(r.PType, r.Rule)
+		stored, ok := s.rules[key]
+		if !ok {
+			continue
+		}
+		delete(s.rules, key)
+		s.notify(StorageChange{StoredRule: stored, Deleted: true})
+		n++
+	}
+	return n, nil
+}
+
+// notify queues c for every watcher. Caller must hold s.mutex.
+func (s *MemoryStorage) notify(c StorageChange) {
+	for w := range s.watchers {
+		w.mutex.Lock()
+		w.changes = append(w.changes, c)
+		w.mutex.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *MemoryStorage) Watch(ctx context.Context, ready func(), f func(StorageChange)) error {
+	w := &memoryWatcher{wake: make(chan struct{}, 1)}
+	s.mutex.Lock()
+	s.watchers[w] = struct{}{}
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.watchers, w)
+		s.mutex.Unlock()
+	}()
+	ready()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.wake:
+		}
+		w.mutex.Lock()
+		changes := w.changes
+		w.changes = nil
+		w.mutex.Unlock()
+		for _, c := range changes {
+			f(c)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package tulip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	s := NewMemoryStorage()
+	_, err := s.Insert(context.Background(), []StoredRule{{PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}}})
+	require.NoError(t, err)
+
+	m, err := NewManagerWithStorage(context.Background(), s, RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+	other, err := NewManagerWithStorage(context.Background(), s, RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer other.Close()
+	assert.Equal(t, 1, m.PolicyCount())
+	// both managers watch in the background
+	retryUntil(t, 10*time.Millisecond, 100, func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return len(s.watchers) == 2
+	}, func() string { return "waiting for watchers" })
+
+	inserted, err := m.AddPolicies(nil, [][]string{{"aaron", "teacher", "uni"}, {"bob", "teacher", "uni"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, inserted)
+	ok, err := m.AddPolicy("g", []string{"aaron", "teacher", "uni"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.ErrorIs(t, m.CreatePolicy("g", []string{"aaron", "teacher", "uni"}), ErrRuleExists)
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	waitForNotification(t, other, 1, 2)
+	assert.True(t, other.Enforce("bob", "uni", "class_a", "teach"))
+
+	require.NoError(t, other.RemovePolicy("g", []string{"bob", "teacher", "uni"}))
+	assert.ErrorIs(t, other.RemovePolicy("g", []string{"bob", "teacher", "uni"}), ErrRuleNotFound)
+	waitForNotification(t, m, 1, 1)
+	assert.False(t, m.Enforce("bob", "uni", "class_a", "teach"))
+
+	_, err = m.AddPolicies([][]string{{"alice", "", "class_a"}}, nil)
+	assert.ErrorIs(t, err, ErrEmptyValue)
+	_, err = m.QueryPolicies(context.Background())
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = m.AddPoliciesWithKey("key", nil, [][]string{{"carol", "teacher", "uni"}})
+	assert.ErrorIs(t, err, ErrUnsupported)
+	assert.ErrorIs(t, m.RemoveFilteredPolicies(nil, []string{"aaron"}), ErrUnsupported)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, m.WaitForSync(ctx))
+	assert.Equal(t, 1, m.GroupingPolicyCount())
+}
+
+// slowStorage is a MemoryStorage that starts watching once release is closed
+type slowStorage struct {
+	*MemoryStorage
+	release chan struct{}
+}
+
+func (s slowStorage) Watch(ctx context.Context, ready func(), f func(StorageChange)) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.MemoryStorage.Watch(ctx, ready, f)
+}
+
+func TestStorageWatchReady(t *testing.T) {
+	s := slowStorage{NewMemoryStorage(), make(chan struct{})}
+	m, err := NewManagerWithStorage(context.Background(), s, RBACWithDomain, WithoutPeriodicSync())
+	require.NoError(t, err)
+	defer m.Close()
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, m.Stats().ListenerConnected)
+
+	close(s.release)
+	<-m.listening
+	assert.True(t, m.Stats().ListenerConnected)
+	_, err = s.Insert(context.Background(), []StoredRule{{PType: "g", Rule: []string{"alice", "teacher", "uni"}}})
+	require.NoError(t, err)
+	waitForNotification(t, m, 0, 1)
+}
+
+func TestPostgresStorage(t *testing.T) {
+	m := newManager(RBACWithDomain, nil)
+	assert.IsType(t, &postgresStorage{}, m.storage)
+	assert.NoError(t, m.checkPostgres())
+	m.storage = NewMemoryStorage()
+	assert.ErrorIs(t, m.checkPostgres(), ErrUnsupported)
+}
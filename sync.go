@@ -0,0 +1,124 @@
+package tulip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SyncSource tells what brought the cache up to date in a SyncReport
+type SyncSource string
+
+const (
+	// SyncLoad is a full load of all policies
+	SyncLoad SyncSource = "load"
+	// SyncNotification is a batch of change notifications
+	SyncNotification SyncSource = "notification"
+)
+
+// SyncReport describes an update of the cache
+type SyncReport struct {
+	Source SyncSource
+	// PolicyCount and GroupingPolicyCount are the cache sizes after the update
+	PolicyCount         int
+	GroupingPolicyCount int
+	// Added and Removed count the cached rules that changed
+	Added   int
+	Removed int
+	// Notifications is the size of the notification batch, zero for loads
+	Notifications int
+	Duration      time.Duration
+}
+
+// WithSyncHook specifies a function called after each full load and each batch of
+// notifications has been applied to the cache, e.g. to refresh caches derived from
+// policies. It runs on the goroutine that updated the cache, so it should return
+// quickly.
+func WithSyncHook(f func(SyncReport)) Option {
+	return func(m *Manager) {
+		m.syncHook = f
+	}
+}
+
+func (m *Manager) syncComplete(report SyncReport) {
+	if m.syncHook != nil {
+		m.syncHook(report)
+	}
+}
+
+// opSync is the notification op of the markers sent by WaitForSync
+const opSync = "SYNC"
+
+// WaitForSync blocks until the cache reflects every change committed before the call,
+// or until ctx is done.
+//
+// It sends a marker notification on the manager's channel and waits for the listener
+// to receive it. Since notifications are delivered in commit order, all earlier
+// changes have been applied by then. In polling mode, or while the listener is down,
+// it reloads all policies instead.
+func (m *Manager) WaitForSync(ctx context.Context) error {
+	if m.isClosed() {
+		return fmt.Errorf("tulip.WaitForSync: %w", ErrClosed)
+	}
+	if m.pollingOnly || m.checkPostgres() != nil || m.listenerDown() {
+		if _, _, err := m.loadPolicies(ctx); err != nil {
+			return fmt.Errorf("tulip.WaitForSync: %w", err)
+		}
+		return nil
+	}
+	select {
+	case <-m.listening:
+	case <-ctx.Done():
+		return fmt.Errorf("tulip.WaitForSync: %w", ctx.Err())
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("tulip.WaitForSync: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	ch := make(chan struct{})
+	m.syncMutex.Lock()
+	m.syncWaiters[token] = ch
+	m.syncMutex.Unlock()
+	defer func() {
+		m.syncMutex.Lock()
+		delete(m.syncWaiters, token)
+		m.syncMutex.Unlock()
+	}()
+
+	payload, err := json.Marshal(policyNotification{Version: notificationVersion, Op: opSync, Token: token})
+	if err != nil {
+		return fmt.Errorf("tulip.WaitForSync: %w", err)
+	}
+	if _, err := m.pool.Exec(ctx, "SELECT pg_notify($1, $2)", m.channel(), string(payload)); err != nil {
+		return fmt.Errorf("tulip.WaitForSync: %w", err)
+	}
+	select {
+	case <-ch:
+		if logger := m.log(ctx); logger != nil {
+			logger.Debug("cache in sync", zap.String("token", token))
+		}
+		return nil
+	case <-m.done:
+		return fmt.Errorf("tulip.WaitForSync: %w", ErrClosed)
+	case <-ctx.Done():
+		return fmt.Errorf("tulip.WaitForSync: %w", ctx.Err())
+	}
+}
+
+// resolveSync releases the WaitForSync call waiting for token, if any. Markers sent by
+// other managers listening on the same channel are ignored.
+func (m *Manager) resolveSync(token string) {
+	m.syncMutex.Lock()
+	defer m.syncMutex.Unlock()
+	if ch, ok := m.syncWaiters[token]; ok {
+		close(ch)
+		delete(m.syncWaiters, token)
+	}
+}
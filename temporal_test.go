@@ -0,0 +1,62 @@
+package tulip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	c, err := ParseCondition("BYDAY=MO,TU,WE,TH,FR; TIME=09:00-17:00; TZID=Europe/Paris")
+	require.NoError(t, err)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	// Wednesday
+	assert.True(t, c.Holds(time.Date(2021, 9, 15, 9, 0, 0, 0, paris)))
+	assert.True(t, c.Holds(time.Date(2021, 9, 15, 16, 59, 0, 0, paris)))
+	assert.False(t, c.Holds(time.Date(2021, 9, 15, 17, 0, 0, 0, paris)))
+	assert.False(t, c.Holds(time.Date(2021, 9, 15, 16, 0, 0, 0, time.UTC)), "18:00 in Paris")
+	// Saturday
+	assert.False(t, c.Holds(time.Date(2021, 9, 18, 10, 0, 0, 0, paris)))
+
+	c, err = ParseCondition("TIME=22:00-06:00;BYMONTH=12;BYMONTHDAY=24-26")
+	require.NoError(t, err)
+	assert.True(t, c.Holds(time.Date(2021, 12, 25, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, c.Holds(time.Date(2021, 12, 25, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, c.Holds(time.Date(2021, 12, 25, 12, 0, 0, 0, time.UTC)))
+	assert.False(t, c.Holds(time.Date(2021, 12, 27, 23, 0, 0, 0, time.UTC)))
+	assert.False(t, c.Holds(time.Date(2021, 11, 25, 23, 0, 0, 0, time.UTC)))
+
+	c, err = ParseCondition("BYHOUR=9-11,14")
+	require.NoError(t, err)
+	assert.True(t, c.Holds(time.Date(2021, 1, 1, 14, 30, 0, 0, time.UTC)))
+	assert.False(t, c.Holds(time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	for _, s := range []string{"BYDAY=XX", "BYHOUR=24", "TIME=9", "FREQ=DAILY", "BYDAY", "TZID=Mars/Olympus"} {
+		_, err := ParseCondition(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTemporalRBAC(t *testing.T) {
+	now := time.Date(2021, 9, 15, 10, 0, 0, 0, time.UTC)
+	m := newManager(TemporalRBAC, []Option{WithClock(func() time.Time { return now })})
+	m.cacheInsert("p", []string{"contractor", "acme", "repo", "push"}, SourceLocal)
+	m.cacheInsert("p", []string{"alice", "acme", "repo", "read", "BYDAY=SA,SU"}, SourceLocal)
+	m.cacheInsert("g", []string{"bob", "contractor", "acme", "BYDAY=MO,TU,WE,TH,FR;TIME=09:00-17:00"}, SourceLocal)
+	m.cacheInsert("g", []string{"carol", "contractor", "acme", "BYDAY=??"}, SourceLocal)
+
+	assert.True(t, m.Enforce("bob", "acme", "repo", "push"))
+	assert.False(t, m.Enforce("alice", "acme", "repo", "read"))
+	assert.False(t, m.Enforce("carol", "acme", "repo", "push"), "invalid conditions never hold")
+
+	saturday := time.Date(2021, 9, 18, 10, 0, 0, 0, time.UTC)
+	assert.False(t, m.EnforceAt(saturday, "bob", "acme", "repo", "push"))
+	assert.True(t, m.EnforceAt(saturday, "alice", "acme", "repo", "read"))
+
+	assert.NoError(t, ValidateCondition("g", []string{"bob", "contractor", "acme", "BYDAY=MO"}))
+	assert.NoError(t, ValidateCondition("p", []string{"alice", "acme", "repo", "read"}))
+	assert.Error(t, ValidateCondition("g", []string{"carol", "contractor", "acme", "BYDAY=??"}))
+}
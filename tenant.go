@@ -0,0 +1,169 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// WithSchema places the rule table, and every other object the manager creates, in
+// Postgres schema name, which is created if needed unless the table creation is
+// skipped. The manager's connections use name as their search path. name must be made
+// of lowercase letters, digits and underscores.
+func WithSchema(name string) Option {
+	return func(m *Manager) {
+		m.schema = name
+	}
+}
+
+// qualifiedTableName returns the table name prefixed with the schema if there is one
+func (m *Manager) qualifiedTableName() string {
+	if m.schema != "" {
+		return m.schema + "." + m.tableName
+	}
+	return m.tableName
+}
+
+// TenantFunc returns the tenant that domain belongs to, or an empty string if there
+// is none
+type TenantFunc func(domain string) string
+
+// ManagerGroup serves many tenants from one database, each with its own rule table in
+// a schema named after the tenant, for isolation stronger than a shared table. A
+// tenant's manager is created, along with its schema, when first used. Each manager
+// has its own connection pool and listener connection.
+type ManagerGroup struct {
+	conn    interface{}
+	matcher Matcher
+	tenant  TenantFunc
+	opts    []Option
+	mutex   sync.Mutex
+	tenants map[string]*tenantManager
+	closed  bool
+}
+
+type tenantManager struct {
+	ready chan struct{}
+	m     *Manager
+	err   error
+}
+
+// NewManagerGroup returns a group creating tenant managers with conn, matcher and
+// opts, as NewManager would. Requests given to Enforce are routed with tenant, based
+// on their domain.
+func NewManagerGroup(conn interface{}, matcher Matcher, tenant TenantFunc, opts ...Option) *ManagerGroup {
+	return &ManagerGroup{
+		conn:    conn,
+		matcher: matcher,
+		tenant:  tenant,
+		opts:    opts,
+		tenants: map[string]*tenantManager{},
+	}
+}
+
+// Manager returns the manager of tenant, creating it if needed. Concurrent calls for
+// the same tenant share a single creation, a failed creation is retried on the next
+// call. tenant must be a valid schema name, see WithSchema.
+func (g *ManagerGroup) Manager(ctx context.Context, tenant string) (*Manager, error) {
+	if !plainIdentRe.MatchString(tenant) {
+		return nil, fmt.Errorf("tulip.ManagerGroup.Manager: %w: %q", ErrInvalidSchemaName, tenant)
+	}
+	g.mutex.Lock()
+	if g.closed {
+		g.mutex.Unlock()
+		return nil, fmt.Errorf("tulip.ManagerGroup.Manager: %w", ErrClosed)
+	}
+	t, ok := g.tenants[tenant]
+	if ok {
+		g.mutex.Unlock()
+		select {
+		case <-t.ready:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("tulip.ManagerGroup.Manager: %w", ctx.Err())
+		}
+	} else {
+		t = &tenantManager{ready: make(chan struct{})}
+		g.tenants[tenant] = t
+		g.mutex.Unlock()
+		opts := append(g.opts[:len(g.opts):len(g.opts)], WithSchema(tenant))
+		t.m, t.err = NewManager(ctx, g.conn, g.matcher, opts...)
+		g.mutex.Lock()
+		if t.err != nil {
+			delete(g.tenants, tenant)
+		} else if g.closed {
+			// Close ran while the manager was created
+			t.m.Close()
+			t.err = ErrClosed
+		}
+		// under the lock so that Close either sees the manager or runs before
+		close(t.ready)
+		g.mutex.Unlock()
+	}
+	if t.err != nil {
+		return nil, fmt.Errorf("tulip.ManagerGroup.Manager: %w", t.err)
+	}
+	return t.m, nil
+}
+
+// Enforce evaluates request with the manager of the tenant of its domain, the
+// second value. The request is denied if the domain has no tenant or the manager
+// can't be created.
+func (g *ManagerGroup) Enforce(request ...string) bool {
+	if len(request) < 2 {
+		return false
+	}
+	tenant := g.tenant(request[1])
+	if tenant == "" {
+		return false
+	}
+	m, err := g.Manager(context.Background(), tenant)
+	if err != nil {
+		return false
+	}
+	return m.Enforce(request...)
+}
+
+// Tenants returns the tenants whose manager is created, sorted
+func (g *ManagerGroup) Tenants() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var res []string
+	for name, t := range g.tenants {
+		select {
+		case <-t.ready:
+			if t.err == nil {
+				res = append(res, name)
+			}
+		default:
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Close closes the managers of all tenants. Managers still being created are closed
+// once ready.
+func (g *ManagerGroup) Close() error {
+	g.mutex.Lock()
+	if g.closed {
+		g.mutex.Unlock()
+		return nil
+	}
+	g.closed = true
+	var ready []*Manager
+	for _, t := range g.tenants {
+		select {
+		case <-t.ready:
+			if t.err == nil {
+				ready = append(ready, t.m)
+			}
+		default:
+		}
+	}
+	g.mutex.Unlock()
+	for _, m := range ready {
+		m.Close()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package tulip
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWithSchema(t *testing.T) {
+	stmts := SchemaSQL(WithTableName("acl"), WithSchema("acme"))
+	require.Len(t, stmts, 8)
+	assert.Equal(t, "CREATE SCHEMA IF NOT EXISTS acme", stmts[0])
+	assert.Contains(t, stmts[5], "tg_notify_acl('acme_acl_rules')")
+	assert.Contains(t, stmts[7], "VALUES ('acl', 'acme_acl_rules', 3, '")
+	assert.Equal(t, "acme.acl", newManager(nil, []Option{WithTableName("acl"), WithSchema("acme")}).qualifiedTableName())
+
+	_, err := NewManager(context.Background(), "", nil, WithSchema("Acme Corp"))
+	assert.ErrorIs(t, err, ErrInvalidSchemaName)
+}
+
+func TestManagerGroupRouting(t *testing.T) {
+	g := NewManagerGroup("", RBACWithDomain, func(domain string) string { return "" })
+	assert.False(t, g.Enforce("alice", "uni", "class_a", "teach"))
+	_, err := g.Manager(context.Background(), "drop table")
+	assert.ErrorIs(t, err, ErrInvalidSchemaName)
+	require.NoError(t, g.Close())
+	_, err = g.Manager(context.Background(), "acme")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func testManagerGroup(t *testing.T, connStr string, opts []Option) {
+	prefix := BrokenRandomLowerAlphaString(5)
+	opts = append(opts, WithZapLogger(zaptest.NewLogger(t)))
+	g := NewManagerGroup(connStr, RBACWithDomain, func(domain string) string {
+		return prefix + "_" + strings.SplitN(domain, "/", 2)[0]
+	}, opts...)
+	defer g.Close()
+
+	acme, err := g.Manager(context.Background(), prefix+"_acme")
+	require.NoError(t, err)
+	_, err = acme.AddPolicies([][]string{{"alice", "acme/hr", "payroll", "read"}}, nil)
+	require.NoError(t, err)
+	globex, err := g.Manager(context.Background(), prefix+"_globex")
+	require.NoError(t, err)
+	_, err = globex.AddPolicies([][]string{{"alice", "globex/hr", "payroll", "read"}}, nil)
+	require.NoError(t, err)
+
+	assert.True(t, g.Enforce("alice", "acme/hr", "payroll", "read"))
+	assert.True(t, g.Enforce("alice", "globex/hr", "payroll", "read"))
+	assert.Equal(t, 1, acme.PolicyCount())
+	assert.Equal(t, 1, globex.PolicyCount())
+	assert.Equal(t, []string{prefix + "_acme", prefix + "_globex"}, g.Tenants())
+
+	again, err := g.Manager(context.Background(), prefix+"_acme")
+	require.NoError(t, err)
+	assert.Same(t, acme, again)
+}
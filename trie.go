@@ -0,0 +1,219 @@
+package tulip
+
+import (
+	"sort"
+	"strings"
+)
+
+// radixNode is a node of a radix tree mapping rule values to the rules holding them
+type radixNode struct {
+	// label is the part of the key on the edge leading to this node
+	label    string
+	children []*radixNode // sorted by first byte of label
+	rules    Policies     // rules whose key ends at this node
+}
+
+// childIndex returns the position of the child whose label starts with b, or where
+// it would be inserted.
+func (n *radixNode) childIndex(b byte) int {
+	return sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].label[0] >= b
+	})
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (n *radixNode) insert(key string, rule []string) {
+	for key != "" {
+		i := n.childIndex(key[0])
+		if i == len(n.children) || n.children[i].label[0] != key[0] {
+			child := &radixNode{label: key}
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = child
+			n = child
+			break
+		}
+		c := n.children[i]
+		l := commonPrefixLen(c.label, key)
+		if l < len(c.label) {
+			// split the edge so that the common prefix gets its own node
+			mid := &radixNode{label: c.label[:l], children: []*radixNode{c}}
+			c.label = c.label[l:]
+			n.children[i] = mid
+			c = mid
+		}
+		n = c
+		key = key[l:]
+	}
+	n.rules.Insert(rule)
+}
+
+func (n *radixNode) remove(key string, rule []string) {
+	var path []*radixNode
+	for key != "" {
+		path = append(path, n)
+		i := n.childIndex(key[0])
+		if i == len(n.children) || !strings.HasPrefix(key, n.children[i].label) {
+			return
+		}
+		key = key[len(n.children[i].label):]
+		n = n.children[i]
+	}
+	if !n.rules.Remove(rule) || len(path) == 0 {
+		return
+	}
+	// prune the emptied node and merge a leftover single child into its parent
+	parent := path[len(path)-1]
+	switch {
+	case len(n.rules) > 0:
+	case len(n.children) == 0:
+		i := parent.childIndex(n.label[0])
+		parent.children = append(parent.children[:i], parent.children[i+1:]...)
+		if len(parent.rules) == 0 && len(parent.children) == 1 && len(path) > 1 {
+			parent.mergeChild()
+		}
+	case len(n.children) == 1:
+		n.mergeChild()
+	}
+}
+
+// mergeChild merges the only child of n into n
+func (n *radixNode) mergeChild() {
+	c := n.children[0]
+	n.label += c.label
+	n.children = c.children
+	n.rules = c.rules
+}
+
+// collect appends the rules of n and all of its descendants to res
+func (n *radixNode) collect(res Policies) Policies {
+	res = append(res, n.rules...)
+	for _, c := range n.children {
+		res = c.collect(res)
+	}
+	return res
+}
+
+// prefixIndex indexes rules by the value at position col so that prefix lookups take
+// time proportional to the key length rather than to the number of rules.
+type prefixIndex struct {
+	col  int
+	root radixNode
+}
+
+func newPrefixIndex(col int, rules Policies) *prefixIndex {
+	ix := &prefixIndex{col: col}
+	for _, rule := range rules {
+		ix.insert(rule)
+	}
+	return ix
+}
+
+func (ix *prefixIndex) insert(rule []string) {
+	ix.root.insert(rule[ix.col], rule)
+}
+
+func (ix *prefixIndex) remove(rule []string) {
+	ix.root.remove(rule[ix.col], rule)
+}
+
+// withPrefix returns rules whose indexed value starts with prefix
+func (ix *prefixIndex) withPrefix(prefix string) Policies {
+	n := &ix.root
+	for prefix != "" {
+		i := n.childIndex(prefix[0])
+		if i == len(n.children) {
+			return nil
+		}
+		c := n.children[i]
+		l := commonPrefixLen(c.label, prefix)
+		if l == len(prefix) {
+			n = c
+			break
+		}
+		if l < len(c.label) {
+			return nil
+		}
+		prefix = prefix[l:]
+		n = c
+	}
+	return n.collect(nil)
+}
+
+// prefixesOf returns rules whose indexed value is a prefix of s, including s itself
+func (ix *prefixIndex) prefixesOf(s string) Policies {
+	n := &ix.root
+	res := append(Policies(nil), n.rules...)
+	for s != "" {
+		i := n.childIndex(s[0])
+		if i == len(n.children) || !strings.HasPrefix(s, n.children[i].label) {
+			break
+		}
+		n = n.children[i]
+		s = s[len(n.label):]
+		res = append(res, n.rules...)
+	}
+	return res
+}
+
+// WithPrefixIndex maintains a radix tree over the value at valueIndex of each policy,
+// typically the object, speeding up FilterPrefix and FilterPrefixesOf on that
+// position. This is useful for hierarchical object names such as paths.
+func WithPrefixIndex(valueIndex int) Option {
+	return func(m *Manager) {
+		m.prefixIndex = newPrefixIndex(valueIndex, nil)
+	}
+}
+
+// FilterPrefix returns policies whose value at valueIndex starts with prefix
+func (m *Manager) FilterPrefix(valueIndex int, prefix string) Policies {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
+	var res Policies
+	if m.prefixIndex != nil && m.prefixIndex.col == valueIndex {
+		res = m.prefixIndex.withPrefix(prefix)
+		sort.Sort(res)
+	} else {
+		for _, rule := range m.p {
+			if strings.HasPrefix(rule[valueIndex], prefix) {
+				res = append(res, rule)
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// FilterPrefixesOf returns policies whose value at valueIndex is a prefix of value.
+// For example with paths as objects, it finds rules granted on value or on any of its
+// parents that end with a separator.
+func (m *Manager) FilterPrefixesOf(valueIndex int, value string) Policies {
+	mu := m.cacheMutex()
+	mu.RLock()
+	defer mu.RUnlock()
+	var res Policies
+	if m.prefixIndex != nil && m.prefixIndex.col == valueIndex {
+		res = m.prefixIndex.prefixesOf(value)
+		sort.Sort(res)
+	} else {
+		for _, rule := range m.p {
+			if strings.HasPrefix(value, rule[valueIndex]) {
+				res = append(res, rule)
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
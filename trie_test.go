@@ -0,0 +1,83 @@
+package tulip
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixIndex(t *testing.T) {
+	ix := newPrefixIndex(1, nil)
+	for _, rule := range [][]string{
+		{"alice", "/org/42/projects/a"},
+		{"alice", "/org/42/projects/b"},
+		{"bob", "/org/42/"},
+		{"bob", "/org/42/projects/a"},
+		{"carol", "/org/7/"},
+		{"dave", "/"},
+	} {
+		ix.insert(rule)
+	}
+	res := ix.withPrefix("/org/42/projects/")
+	sort.Sort(res)
+	assert.Equal(t, Policies{
+		{"alice", "/org/42/projects/a"},
+		{"alice", "/org/42/projects/b"},
+		{"bob", "/org/42/projects/a"},
+	}, res)
+	assert.Len(t, ix.withPrefix("/org/4"), 4)
+	assert.Len(t, ix.withPrefix("/org/43"), 0)
+
+	res = ix.prefixesOf("/org/42/projects/a/files")
+	sort.Sort(res)
+	assert.Equal(t, Policies{
+		{"alice", "/org/42/projects/a"},
+		{"bob", "/org/42/"},
+		{"bob", "/org/42/projects/a"},
+		{"dave", "/"},
+	}, res)
+
+	ix.remove([]string{"bob", "/org/42/"})
+	ix.remove([]string{"dave", "/"})
+	ix.remove([]string{"eve", "/org/42/projects/a"})
+	res = ix.prefixesOf("/org/42/projects/a")
+	sort.Sort(res)
+	assert.Equal(t, Policies{
+		{"alice", "/org/42/projects/a"},
+		{"bob", "/org/42/projects/a"},
+	}, res)
+}
+
+func TestPrefixIndexMatchesScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	segments := []string{"a", "ab", "b", "abc", "/"}
+	randomPath := func() string {
+		var sb strings.Builder
+		for i := r.Intn(5); i >= 0; i-- {
+			sb.WriteString(segments[r.Intn(len(segments))])
+		}
+		return sb.String()
+	}
+	m := newManager(RBACWithDomain, []Option{WithPrefixIndex(2)})
+	for i := 0; i < 2000; i++ {
+		rule := []string{fmt.Sprintf("u%d", r.Intn(5)), "dom", randomPath(), "read"}
+		if r.Intn(3) == 0 {
+			m.cacheRemove("p", rule, SourceRemote)
+		} else {
+			m.cacheInsert("p", rule, SourceRemote)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		path := randomPath()
+		ix := m.prefixIndex
+		m.prefixIndex = nil
+		wantPrefix, wantPrefixesOf := m.FilterPrefix(2, path), m.FilterPrefixesOf(2, path)
+		m.prefixIndex = ix
+		assert.Equal(t, wantPrefix, m.FilterPrefix(2, path), "FilterPrefix(%q)", path)
+		assert.Equal(t, wantPrefixesOf, m.FilterPrefixesOf(2, path), "FilterPrefixesOf(%q)", path)
+	}
+}
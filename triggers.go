@@ -0,0 +1,196 @@
+package tulip
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// TriggerTableName is the table recording the notification triggers installed by
+// managers, one row per rule table, in the schema of the rule table
+const TriggerTableName = "tulip_trigger"
+
+var triggerTableSQL = fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		table_name text PRIMARY KEY,
+		channel text NOT NULL,
+		version integer NOT NULL,
+		checksum text NOT NULL,
+		trigger_tables text[] NOT NULL,
+		installed_at timestamptz NOT NULL DEFAULT now()
+	)
+`, TriggerTableName)
+
+// notifyTriggers returns the statements installing the notification triggers of the
+// manager's table and the tables they are created on
+func (m *Manager) notifyTriggers() (stmts, tables []string) {
+	if m.normalized {
+		return normalizedTriggerSQL(m.tableName, m.channel()),
+			[]string{m.tableName + "_grant", m.tableName + "_membership"}
+	}
+	stmts, tables = triggerSQL(m.tableName, m.channel(), m.cols), []string{m.tableName}
+	if m.groupExpiry {
+		stmts = append(stmts, expiryTriggerSQL(m.tableName, m.channel(), m.cols)...)
+		tables = append(tables, m.tableName+"_expiry")
+	}
+	return stmts, tables
+}
+
+// triggerChecksum identifies the definition of triggers installed by stmts, so that
+// changes that don't bump notificationVersion, such as WithColumns, are upgraded too
+func triggerChecksum(stmts []string) string {
+	h := sha256.Sum256([]byte(strings.Join(stmts, ";")))
+	return hex.EncodeToString(h[:])
+}
+
+// notifyTriggerSQL returns the statements installing the notification triggers of the
+// manager's table and recording them in TriggerTableName
+func (m *Manager) notifyTriggerSQL() []string {
+	stmts, tables := m.notifyTriggers()
+	return append(stmts, triggerTableSQL, fmt.Sprintf(`
+		INSERT INTO %s (table_name, channel, version, checksum, trigger_tables)
+		VALUES (%s, %s, %d, '%s', ARRAY[%s]::text[])
+		ON CONFLICT (table_name) DO UPDATE SET
+			channel = EXCLUDED.channel,
+			version = EXCLUDED.version,
+			checksum = EXCLUDED.checksum,
+			trigger_tables = EXCLUDED.trigger_tables,
+			installed_at = now()
+	`, TriggerTableName, quoteLiteral(m.tableName), quoteLiteral(m.channel()), notificationVersion,
+		triggerChecksum(stmts), quoteLiterals(tables)))
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func quoteLiterals(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = quoteLiteral(s)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// triggerUpToDate tells whether the notification triggers recorded for the manager's
+// table are still in place and either match the ones the manager would install or
+// were installed by a newer release, in which case they are left alone. Triggers of a
+// newer version are never downgraded, the listener reads newer payloads.
+func (m *Manager) triggerUpToDate(ctx context.Context, tx pgx.Tx) (bool, error) {
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", TriggerTableName).Scan(&exists); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+	var version int
+	var checksum string
+	var tables []string
+	err := tx.QueryRow(ctx,
+		fmt.Sprintf("SELECT version, checksum, trigger_tables FROM %s WHERE table_name = $1", TriggerTableName),
+		m.tableName,
+	).Scan(&version, &checksum, &tables)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// the table may have been dropped and created again since
+	for _, t := range tables {
+		var installed bool
+		err := tx.QueryRow(ctx,
+			"SELECT EXISTS (SELECT FROM pg_trigger WHERE tgrelid = to_regclass($1) AND tgname = $2)",
+			t, "notify_"+t,
+		).Scan(&installed)
+		if err != nil {
+			return false, err
+		}
+		if !installed {
+			return false, nil
+		}
+	}
+	if version > notificationVersion {
+		if logger := m.log(ctx); logger != nil {
+			logger.Info("keeping notification trigger installed by a newer release",
+				zap.String("table_name", m.tableName),
+				zap.Int("version", version),
+			)
+		}
+		return true, nil
+	}
+	stmts, _ := m.notifyTriggers()
+	return version == notificationVersion && checksum == triggerChecksum(stmts), nil
+}
+
+// CleanupTriggers drops the notification triggers and functions recorded in
+// TriggerTableName whose rule table no longer exists under the recorded name, e.g.
+// because it was renamed or dropped, and forgets them. Triggers left on a renamed
+// table would otherwise keep notifying a stale channel. It returns the names of the
+// tables whose triggers were removed.
+func (m *Manager) CleanupTriggers(ctx context.Context) ([]string, error) {
+	if m.isClosed() {
+		return nil, fmt.Errorf("tulip.CleanupTriggers: %w", ErrClosed)
+	}
+	if err := m.checkPostgres(); err != nil {
+		return nil, fmt.Errorf("tulip.CleanupTriggers: %w", err)
+	}
+	var removed []string
+	err := m.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		removed = nil
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockKey(TriggerTableName)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, triggerTableSQL); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, fmt.Sprintf(
+			"SELECT table_name, trigger_tables FROM %s WHERE to_regclass(table_name) IS NULL ORDER BY table_name",
+			TriggerTableName,
+		))
+		if err != nil {
+			return err
+		}
+		var orphans [][]string
+		for rows.Next() {
+			var table string
+			var tables []string
+			if err := rows.Scan(&table, &tables); err != nil {
+				rows.Close()
+				return err
+			}
+			removed = append(removed, table)
+			orphans = append(orphans, tables)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for i, table := range removed {
+			// dropping the functions drops the triggers using them, wherever the tables
+			// they are on were renamed to
+			for _, t := range orphans[i] {
+				if _, err := tx.Exec(ctx, fmt.Sprintf("DROP FUNCTION IF EXISTS tg_notify_%s() CASCADE", t)); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE table_name = $1", TriggerTableName), table); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tulip.CleanupTriggers: %w", err)
+	}
+	if logger := m.log(ctx); logger != nil && len(removed) > 0 {
+		logger.Info("removed orphaned notification triggers", zap.Strings("tables", removed))
+	}
+	return removed, nil
+}
@@ -0,0 +1,42 @@
+package tulip
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testCleanupTriggers(t *testing.T, connStr string, opts []Option) {
+	table := BrokenRandomLowerAlphaString(5)
+	opts = append(opts, WithTableName(table), WithZapLogger(zaptest.NewLogger(t)))
+	ctx := context.Background()
+	m, err := NewManager(ctx, connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+	// the trigger is up to date, starting again leaves it alone
+	other, err := NewManager(ctx, connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	require.NoError(t, other.Close())
+
+	triggers := func() (n int) {
+		require.NoError(t, m.pool.QueryRow(ctx,
+			"SELECT count(*) FROM pg_trigger WHERE tgname = $1", "notify_"+table,
+		).Scan(&n))
+		return n
+	}
+	assert.Equal(t, 1, triggers())
+	removed, err := m.CleanupTriggers(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, removed, table)
+
+	_, err = m.pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s RENAME TO %s_old", table, table))
+	require.NoError(t, err)
+	removed, err = m.CleanupTriggers(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, removed, table)
+	assert.Equal(t, 0, triggers())
+}
@@ -0,0 +1,197 @@
+// Package tuliptest provides helpers for tests that need a real tulip.Manager.
+//
+// Each helper provisions a throwaway database on the PostgreSQL server named by the
+// PG_CONN environment variable and removes it once the test finishes. The server
+// can come from anywhere, such as a local install or a CI service container. Without
+// PG_CONN, a server is started in a Docker container for the test and removed with
+// it. To share one container across the tests of a package, start it from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		pg, err := tuliptest.StartPostgres(context.Background())
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		os.Setenv(tuliptest.EnvConnString, pg.ConnString)
+//		code := m.Run()
+//		pg.Stop()
+//		os.Exit(code)
+//	}
+package tuliptest
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pckhoi/tulip"
+)
+
+// EnvConnString is the environment variable holding the connection string of the
+// PostgreSQL server used by this package.
+const EnvConnString = "PG_CONN"
+
+// EnvImage is the environment variable overriding the Docker image run by
+// StartPostgres, DefaultImage by default.
+const EnvImage = "TULIPTEST_IMAGE"
+
+// DefaultImage is the Docker image run by StartPostgres unless EnvImage is set
+const DefaultImage = "postgres:14-alpine"
+
+// ConnString returns the connection string from EnvConnString. When it's empty, it
+// starts a server with StartPostgres that is removed when the test completes, and
+// skips the test if Docker isn't available.
+func ConnString(t testing.TB) string {
+	t.Helper()
+	if connStr := os.Getenv(EnvConnString); connStr != "" {
+		return connStr
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skipf("tuliptest: %s is not set and docker is not installed", EnvConnString)
+	}
+	pg, err := StartPostgres(context.Background())
+	if err != nil {
+		t.Skipf("tuliptest: %s is not set and %v", EnvConnString, err)
+	}
+	t.Cleanup(func() {
+		if err := pg.Stop(); err != nil {
+			t.Errorf("tuliptest: %v", err)
+		}
+	})
+	return pg.ConnString
+}
+
+// Postgres is a PostgreSQL server running in a Docker container, see StartPostgres
+type Postgres struct {
+	// ConnString connects to the server as superuser
+	ConnString string
+
+	container string
+}
+
+// StartPostgres runs a PostgreSQL server in a Docker container, with the docker
+// command, and returns once it accepts connections. The server listens on a random
+// port of the loopback interface. Stop removes the container along with its data.
+func StartPostgres(ctx context.Context) (*Postgres, error) {
+	image := os.Getenv(EnvImage)
+	if image == "" {
+		image = DefaultImage
+	}
+	password := randomLowerAlpha(16)
+	out, err := docker(ctx, "run", "-d", "--rm", "-e", "POSTGRES_PASSWORD="+password, "-p", "127.0.0.1::5432", image)
+	if err != nil {
+		return nil, err
+	}
+	pg := &Postgres{container: out}
+	out, err = docker(ctx, "port", pg.container, "5432/tcp")
+	if err != nil {
+		pg.Stop()
+		return nil, err
+	}
+	// one line per address the port is published on
+	addr := strings.SplitN(out, "\n", 2)[0]
+	pg.ConnString = fmt.Sprintf("postgres://postgres:%s@%s/postgres?sslmode=disable", password, addr)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for {
+		conn, err := pgx.Connect(ctx, pg.ConnString)
+		if err == nil {
+			conn.Close(ctx)
+			return pg, nil
+		}
+		select {
+		case <-ctx.Done():
+			pg.Stop()
+			return nil, fmt.Errorf("tuliptest: waiting for postgres: %w", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// Stop removes the container of the server
+func (pg *Postgres) Stop() error {
+	_, err := docker(context.Background(), "rm", "-f", "-v", pg.container)
+	return err
+}
+
+// docker runs the docker command with args and returns its trimmed output
+func docker(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("tuliptest: docker %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// NewDatabase creates an empty database and returns its name. The database is dropped
+// when the test completes, after any cleanup registered later (such as closing a
+// Manager) has run.
+func NewDatabase(t testing.TB, connStr string) string {
+	t.Helper()
+	ctx := context.Background()
+	dbName := "tulip_test_" + randomLowerAlpha(8)
+	conn, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		t.Fatalf("tuliptest: connect: %v", err)
+	}
+	defer conn.Close(ctx)
+	if _, err = conn.Exec(ctx, "CREATE DATABASE "+dbName); err != nil {
+		t.Fatalf("tuliptest: create database: %v", err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(ctx, connStr)
+		if err != nil {
+			t.Errorf("tuliptest: connect: %v", err)
+			return
+		}
+		defer conn.Close(ctx)
+		if _, err = conn.Exec(ctx, "DROP DATABASE "+dbName); err != nil {
+			t.Errorf("tuliptest: drop database: %v", err)
+		}
+	})
+	return dbName
+}
+
+// NewManager returns a ready Manager backed by a fresh database. The manager is closed
+// and the database dropped when the test completes. opts are applied after the
+// database options so callers can still customize everything else.
+func NewManager(t testing.TB, matcher tulip.Matcher, opts ...tulip.Option) *tulip.Manager {
+	t.Helper()
+	connStr := ConnString(t)
+	dbName := NewDatabase(t, connStr)
+	opts = append([]tulip.Option{
+		tulip.WithDatabase(dbName),
+		tulip.WithSkipDatabaseCreate(),
+	}, opts...)
+	m, err := tulip.NewManager(context.Background(), connStr, matcher, opts...)
+	if err != nil {
+		t.Fatalf("tuliptest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := m.Close(); err != nil {
+			t.Errorf("tuliptest: close manager: %v", err)
+		}
+	})
+	return m
+}
+
+func randomLowerAlpha(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = letters[int(b[i])%len(letters)]
+	}
+	return string(b)
+}
@@ -0,0 +1,19 @@
+package tuliptest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pckhoi/tulip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManager(t *testing.T) {
+	m := NewManager(t, tulip.RBACWithDomain)
+	_, err := m.AddPolicy("p", []string{"alice", "uni", "class_a", "teach"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return m.Enforce("alice", "uni", "class_a", "teach")
+	}, time.Second, 10*time.Millisecond)
+}
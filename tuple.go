@@ -0,0 +1,132 @@
+package tulip
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TuplePType is the policy type relation tuples are stored under
+const TuplePType = "t"
+
+// Tuple is a Zanzibar-style relation tuple `object#relation@subject`, such as
+// "doc:readme#viewer@alice". The subject is either a user or a userset
+// `object#relation`, such as "group:eng#member", granting the relation to every
+// subject that has relation on object.
+type Tuple struct {
+	Object   string
+	Relation string
+	Subject  string
+}
+
+// ParseTuple parses a tuple written as `object#relation@subject`
+func ParseTuple(s string) (Tuple, error) {
+	i := strings.Index(s, "#")
+	j := strings.Index(s, "@")
+	if i <= 0 || j <= i+1 || j == len(s)-1 {
+		return Tuple{}, fmt.Errorf("tulip.ParseTuple: invalid tuple %q", s)
+	}
+	return Tuple{Object: s[:i], Relation: s[i+1 : j], Subject: s[j+1:]}, nil
+}
+
+func (t Tuple) String() string {
+	return t.Object + "#" + t.Relation + "@" + t.Subject
+}
+
+// namespace returns the part of object before the first colon, e.g. "doc" for
+// "doc:readme", or "" if object has no namespace.
+func namespace(object string) string {
+	if i := strings.Index(object, ":"); i >= 0 {
+		return object[:i]
+	}
+	return ""
+}
+
+// WithNamespace configures userset rewrites for objects of namespace name, i.e. whose
+// identifier starts with "name:". Each relation maps to the relations on the same
+// object that imply it, e.g.
+//
+//	WithNamespace("doc", map[string][]string{
+//		"viewer": {"editor"},
+//		"editor": {"owner"},
+//	})
+//
+// makes every owner of a doc an editor and every editor a viewer. Rewrites under the
+// empty name apply to objects without a namespace.
+func WithNamespace(name string, rewrites map[string][]string) Option {
+	return func(m *Manager) {
+		if m.namespaces == nil {
+			m.namespaces = map[string]map[string][]string{}
+		}
+		m.namespaces[name] = rewrites
+	}
+}
+
+func tupleRules(tuples []Tuple) [][]string {
+	rules := make([][]string, len(tuples))
+	for i, t := range tuples {
+		rules[i] = []string{t.Object, t.Relation, t.Subject}
+	}
+	return rules
+}
+
+// AddTuples adds relation tuples to the storage. It returns the number of tuples
+// inserted.
+func (m *Manager) AddTuples(tuples ...Tuple) (inserted int, err error) {
+	inserted, err = m.addRules([]typedRules{{TuplePType, tupleRules(tuples)}}, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("tulip.AddTuples: %w", err)
+	}
+	return inserted, nil
+}
+
+// RemoveTuples removes relation tuples from the storage
+func (m *Manager) RemoveTuples(tuples ...Tuple) error {
+	if err := m.removeRules([]typedRules{{TuplePType, tupleRules(tuples)}}); err != nil {
+		return fmt.Errorf("tulip.RemoveTuples: %w", err)
+	}
+	return nil
+}
+
+// Tuples returns the stored tuples matching object and relation, either of which may
+// be empty to match any value.
+func (m *Manager) Tuples(object, relation string) []Tuple {
+	rules := m.FilterType(TuplePType, object, relation)
+	res := make([]Tuple, len(rules))
+	for i, rule := range rules {
+		res[i] = Tuple{Object: rule[0], Relation: rule[1], Subject: rule[2]}
+	}
+	return res
+}
+
+// Check tells whether subject has relation on object, following usersets and the
+// rewrites configured with WithNamespace.
+func (m *Manager) Check(object, relation, subject string) bool {
+	return m.check(object, relation, subject, map[string]bool{})
+}
+
+func (m *Manager) check(object, relation, subject string, visited map[string]bool) bool {
+	userset := object + "#" + relation
+	if visited[userset] {
+		return false
+	}
+	visited[userset] = true
+	if userset == subject {
+		return true
+	}
+	for _, rule := range m.FilterType(TuplePType, object, relation) {
+		s := rule[2]
+		if s == subject {
+			return true
+		}
+		if i := strings.Index(s, "#"); i > 0 && m.check(s[:i], s[i+1:], subject, visited) {
+			return true
+		}
+	}
+	for _, implied := range m.namespaces[namespace(object)][relation] {
+		if m.check(object, implied, subject, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package tulip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTuple(t *testing.T) {
+	tup, err := ParseTuple("doc:readme#viewer@group:eng#member")
+	require.NoError(t, err)
+	assert.Equal(t, Tuple{"doc:readme", "viewer", "group:eng#member"}, tup)
+	assert.Equal(t, "doc:readme#viewer@group:eng#member", tup.String())
+
+	for _, s := range []string{"", "doc:readme", "#viewer@alice", "doc#@alice", "doc#viewer@"} {
+		_, err := ParseTuple(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m := newManager(nil, []Option{
+		WithNamespace("doc", map[string][]string{
+			"viewer": {"editor"},
+			"editor": {"owner"},
+		}),
+	})
+	for _, s := range []string{
+		"doc:readme#owner@alice",
+		"doc:readme#viewer@group:eng#member",
+		"group:eng#member@bob",
+		"group:eng#member@group:sre#member",
+		"group:sre#member@carol",
+		"group:sre#member@group:eng#member",
+	} {
+		tup, err := ParseTuple(s)
+		require.NoError(t, err)
+		m.cacheInsert(TuplePType, tupleRules([]Tuple{tup})[0], SourceLocal)
+	}
+
+	assert.True(t, m.Check("doc:readme", "viewer", "alice"))
+	assert.True(t, m.Check("doc:readme", "editor", "alice"))
+	assert.True(t, m.Check("doc:readme", "viewer", "bob"))
+	assert.True(t, m.Check("doc:readme", "viewer", "carol"))
+	assert.True(t, m.Check("doc:readme", "viewer", "group:eng#member"))
+	assert.False(t, m.Check("doc:readme", "editor", "bob"))
+	assert.False(t, m.Check("doc:readme", "viewer", "dave"))
+	assert.False(t, m.Check("group:eng", "member", "alice"))
+	assert.Len(t, m.Tuples("group:eng", ""), 2)
+}
@@ -0,0 +1,66 @@
+package tulip
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// usageLog records when rules last granted access and how many times
+type usageLog struct {
+	mutex   sync.Mutex
+	started time.Time
+	last    map[string]time.Time
+	hits    map[string]int64
+}
+
+// WithUsageTracking records the last time each rule granted access, so that
+// UnusedPolicies can tell which rules were never needed, and counts the times they did
+// for HotPolicies. Built-in matchers record the rules they match. Usage is kept in
+// memory and starts over when the process restarts.
+func WithUsageTracking() Option {
+	return func(m *Manager) {
+		m.usage = &usageLog{started: time.Now(), last: map[string]time.Time{}, hits: map[string]int64{}}
+	}
+}
+
+func usageKey(ptype string, rule []string) string {
+	return ptype + "\x00" + strings.Join(padRule(rule), "\x00")
+}
+
+// RecordUsage notes that rule of type ptype granted access. Custom matchers should call
+// it for the rules behind each allowed request when usage is tracked. It does nothing
+// without WithUsageTracking.
+func (m *Manager) RecordUsage(ptype string, rule []string) {
+	if m.usage == nil {
+		return
+	}
+	key := usageKey(ptype, rule)
+	now := time.Now()
+	m.usage.mutex.Lock()
+	m.usage.last[key] = now
+	m.usage.hits[key]++
+	m.usage.mutex.Unlock()
+}
+
+// UnusedPolicies returns the cached rules, keyed by type, that haven't granted access
+// since the given time. It requires WithUsageTracking and returns ErrUsageWindow if
+// tracking started after since.
+func (m *Manager) UnusedPolicies(since time.Time) (map[string]Policies, error) {
+	if m.usage == nil || m.usage.started.After(since) {
+		return nil, fmt.Errorf("tulip.UnusedPolicies: %w", ErrUsageWindow)
+	}
+	sets := m.snapshot()
+	m.usage.mutex.Lock()
+	defer m.usage.mutex.Unlock()
+	res := map[string]Policies{}
+	for ptype, rules := range sets {
+		for _, rule := range rules {
+			if last, ok := m.usage.last[usageKey(ptype, rule)]; !ok || last.Before(since) {
+				res[ptype] = append(res[ptype], rule)
+			}
+		}
+	}
+	return res, nil
+}
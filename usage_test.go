@@ -0,0 +1,37 @@
+package tulip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnusedPolicies(t *testing.T) {
+	_, err := newManager(RBACWithDomain, nil).UnusedPolicies(time.Now())
+	assert.ErrorIs(t, err, ErrUsageWindow)
+
+	m := newManager(RBACWithDomain, []Option{WithUsageTracking()})
+	since := time.Now()
+	_, err = m.UnusedPolicies(since.Add(-time.Hour))
+	assert.ErrorIs(t, err, ErrUsageWindow)
+
+	m.cacheInsert("p", []string{"teacher", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"teacher", "uni", "class_b", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"bob", "uni", "class_c", "teach"}, SourceLocal)
+	m.cacheInsert("g", []string{"alice", "teacher", "uni"}, SourceLocal)
+	m.cacheInsert("g", []string{"carol", "teacher", "uni"}, SourceLocal)
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("alice", "uni", "class_c", "teach"))
+
+	unused, err := m.UnusedPolicies(since)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Policies{
+		"p": {
+			{"bob", "uni", "class_c", "teach", "", ""},
+			{"teacher", "uni", "class_b", "teach", "", ""},
+		},
+		"g": {{"carol", "teacher", "uni", "", "", ""}},
+	}, unused)
+}
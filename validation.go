@@ -0,0 +1,178 @@
+package tulip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ValidationHook checks a rule about to be stored, returning an error to reject it
+type ValidationHook func(ptype string, rule []string) error
+
+// ValidationConfig configures WithValidation
+type ValidationConfig struct {
+	// Arity maps each accepted rule type to its number of values. Rules of other types,
+	// or with a different number of values, are rejected. Any rule is accepted if nil.
+	// Types used internally, such as BundlePType, must be listed to be accepted.
+	Arity map[string]int
+	// Hooks are called in order with every rule passing the arity check
+	Hooks []ValidationHook
+	// StrictTrigger creates a trigger enforcing Arity on every row written to the table,
+	// so that systems writing to it directly can't store invalid rules either. Hooks
+	// aren't run by the trigger, see NewValidationHandler for a way to share them. It
+	// requires Arity.
+	StrictTrigger bool
+}
+
+// WithValidation makes the manager reject rules not matching cfg with ErrInvalidRule,
+// before they are written. Rules are checked as given, before
+// WithPseudonymizedSubjects or a codec transform them.
+func WithValidation(cfg ValidationConfig) Option {
+	return func(m *Manager) {
+		m.validation = &cfg
+	}
+}
+
+// ValidateRule checks rule of type ptype as the manager does before storing it. It
+// returns ErrEmptyValue or ErrInvalidRule if the rule would be rejected.
+func (m *Manager) ValidateRule(ptype string, rule []string) error {
+	if err := checkRule(ptype, rule); err != nil {
+		return err
+	}
+	if m.validation == nil {
+		return nil
+	}
+	if m.validation.Arity != nil {
+		n, ok := m.validation.Arity[ptype]
+		if !ok {
+			return fmt.Errorf("%w: rule type %q is not allowed", ErrInvalidRule, ptype)
+		}
+		if len(trimRule(rule)) != n {
+			return fmt.Errorf("%w: rule of type %q needs %d values, got %v", ErrInvalidRule, ptype, n, rule)
+		}
+	}
+	for _, hook := range m.validation.Hooks {
+		if err := hook(ptype, rule); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+	return nil
+}
+
+// validateSets checks every rule of sets with ValidateRule
+func (m *Manager) validateSets(sets []typedRules) error {
+	if m.validation == nil {
+		return nil
+	}
+	for _, set := range sets {
+		for _, rule := range set.rules {
+			if err := m.ValidateRule(set.ptype, rule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validationTriggerSQL returns a trigger rejecting rows whose type isn't in arity or
+// whose values don't match its arity
+func validationTriggerSQL(t string, c columns, arity map[string]int) []string {
+	ptypes := make([]string, 0, len(arity))
+	for ptype := range arity {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	var cases strings.Builder
+	for _, ptype := range ptypes {
+		fmt.Fprintf(&cases, " WHEN '%s' THEN %d", strings.ReplaceAll(ptype, "'", "''"), arity[ptype])
+	}
+	return []string{
+		fmt.Sprintf(`
+			create or replace function tg_validate_%[1]s ()
+			returns trigger
+			language plpgsql
+			as $$
+				declare
+					arity integer;
+					vals text[] := ARRAY[%[2]s];
+				begin
+					arity := CASE NEW.%[3]s%[4]s END;
+					IF arity IS NULL THEN
+						RAISE EXCEPTION 'rule type %% is not allowed', NEW.%[3]s
+							USING ERRCODE = 'check_violation';
+					END IF;
+					FOR i IN 1..%[5]d LOOP
+						IF (i <= arity) <> (coalesce(vals[i], '') <> '') THEN
+							RAISE EXCEPTION 'rule of type %% needs %% values', NEW.%[3]s, arity
+								USING ERRCODE = 'check_violation';
+						END IF;
+					END LOOP;
+					RETURN NEW;
+				end;
+			$$
+		`, t, c.values("NEW."), c.ptype, cases.String(), ruleWidth),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS validate_%s ON %s", t, t),
+		fmt.Sprintf(`
+			CREATE TRIGGER validate_%s
+			BEFORE INSERT OR UPDATE
+			ON %s
+			FOR EACH ROW
+			EXECUTE PROCEDURE tg_validate_%s()
+		`, t, t, t),
+	}
+}
+
+// ValidationRequest is the body accepted by the handler of NewValidationHandler
+type ValidationRequest struct {
+	Rules []StoredRule `json:"rules"`
+}
+
+// ValidationResult tells whether the rule at Index of a ValidationRequest is valid
+type ValidationResult struct {
+	Index int    `json:"index"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// ValidationResponse is the body returned by the handler of NewValidationHandler
+type ValidationResponse struct {
+	// Valid is true if every rule is valid
+	Valid   bool               `json:"valid"`
+	Results []ValidationResult `json:"results"`
+}
+
+// NewValidationHandler returns a handler checking proposed rules with ValidateRule, so
+// that systems writing to the table directly apply the same checks as the manager.
+// It accepts POST requests with a JSON ValidationRequest such as
+//
+//	{"rules": [{"PType": "p", "Rule": ["alice", "uni", "class_a", "teach"]}]}
+//
+// and responds 200 with a JSON ValidationResponse, whether or not the rules are valid,
+// or 400 if the body can't be decoded.
+func NewValidationHandler(m *Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req ValidationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		resp := ValidationResponse{Valid: true, Results: make([]ValidationResult, len(req.Rules))}
+		for i, rule := range req.Rules {
+			resp.Results[i] = ValidationResult{Index: i, Valid: true}
+			if err := m.ValidateRule(rule.PType, rule.Rule); err != nil {
+				resp.Valid = false
+				resp.Results[i].Valid = false
+				resp.Results[i].Error = err.Error()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
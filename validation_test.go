@@ -0,0 +1,100 @@
+package tulip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestValidation(t *testing.T) {
+	m, err := NewManagerWithStorage(context.Background(), NewMemoryStorage(), RBACWithDomain,
+		WithoutPeriodicSync(),
+		WithValidation(ValidationConfig{
+			Arity: map[string]int{"p": 4, "g": 3},
+			Hooks: []ValidationHook{func(ptype string, rule []string) error {
+				if ptype == "g" && rule[1] == "admin" {
+					return errors.New("admins are managed elsewhere")
+				}
+				return nil
+			}},
+		}),
+	)
+	require.NoError(t, err)
+	defer m.Close()
+
+	assert.NoError(t, m.ValidateRule("p", []string{"teacher", "uni", "class_a", "teach"}))
+	assert.ErrorIs(t, m.ValidateRule("p", []string{"teacher", "uni", "class_a"}), ErrInvalidRule)
+	assert.ErrorIs(t, m.ValidateRule("p2", []string{"teacher", "uni", "class_a", "teach"}), ErrInvalidRule)
+	assert.ErrorIs(t, m.ValidateRule("g", []string{"aaron", "", "uni"}), ErrEmptyValue)
+	assert.EqualError(t, m.ValidateRule("g", []string{"aaron", "admin", "uni"}),
+		"tulip: invalid rule: admins are managed elsewhere")
+
+	_, err = m.AddPolicies(nil, [][]string{{"aaron", "teacher", "uni"}, {"aaron", "admin", "uni"}})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	_, err = m.AddPolicy("g", []string{"aaron", "teacher"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.Equal(t, 0, m.GroupingPolicyCount())
+}
+
+func TestValidationHandler(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithValidation(ValidationConfig{Arity: map[string]int{"p": 4}})})
+	h := NewValidationHandler(m)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"rules": [
+		{"PType": "p", "Rule": ["teacher", "uni", "class_a", "teach"]},
+		{"PType": "g", "Rule": ["aaron", "teacher", "uni"]}
+	]}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp ValidationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.False(t, resp.Valid)
+	require.Len(t, resp.Results, 2)
+	assert.True(t, resp.Results[0].Valid)
+	assert.False(t, resp.Results[1].Valid)
+	assert.Equal(t, 1, resp.Results[1].Index)
+	assert.Contains(t, resp.Results[1].Error, `rule type "g" is not allowed`)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func testStrictTrigger(t *testing.T, connStr string, opts []Option) {
+	tableName := BrokenRandomLowerAlphaString(5)
+	opts = append(opts,
+		WithTableName(tableName),
+		WithZapLogger(zaptest.NewLogger(t)),
+		WithValidation(ValidationConfig{Arity: map[string]int{"p": 4, "g": 3}, StrictTrigger: true}),
+	)
+	m, err := NewManager(context.Background(), connStr, RBACWithDomain, opts...)
+	require.NoError(t, err)
+	defer m.Close()
+
+	_, err = m.AddPolicies(
+		[][]string{{"teacher", "uni", "class_a", "teach"}},
+		[][]string{{"aaron", "teacher", "uni"}},
+	)
+	require.NoError(t, err)
+
+	// rows written behind the manager's back are checked as well
+	ctx := context.Background()
+	_, err = m.pool.Exec(ctx, fmt.Sprintf("INSERT INTO %s (id, p_type, v0, v1) VALUES ('x', 'g', 'bob', 'teacher')", tableName))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rule of type g needs 3 values")
+	_, err = m.pool.Exec(ctx, fmt.Sprintf("INSERT INTO %s (id, p_type, v0) VALUES ('y', 'p2', 'bob')", tableName))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rule type p2 is not allowed")
+}
@@ -0,0 +1,222 @@
+package tulip
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// warmStart holds the rules enforced while the first load is in progress and where
+// the loaded rules are kept for the next start
+type warmStart struct {
+	path  string
+	rules map[string][][]string
+	// mutex serializes writes of the file, seq orders them and sum is the checksum of
+	// the content last written
+	mutex   sync.Mutex
+	seq     uint64
+	written uint64
+	sum     [sha256.Size]byte
+}
+
+// WithWarmStart keeps the loaded rules in the file at path, in the format read by
+// ParsePolicyCSV, and starts the next manager created with the same path from them:
+// it enforces the rules read from the file as soon as it is returned while it loads
+// the rules from the database in the background, cutting cold start latency. Until
+// the first load succeeds, which is retried until the manager is closed, Stats
+// reports a zero LastSync and enforcement uses the rules of the file, however old.
+// The file is written after loads that find it out of date, including periodic syncs,
+// and holds the rules as cached, i.e. decoded, see WithCodec, so it should be kept as
+// private as the table. A missing or unreadable file is ignored and the manager
+// loads its rules before it is returned, as without WithWarmStart.
+func WithWarmStart(path string) Option {
+	return func(m *Manager) {
+		if m.warm == nil {
+			m.warm = &warmStart{}
+		}
+		m.warm.path = path
+	}
+}
+
+// WithInitialRules starts the manager from rules, keyed by type as returned by
+// ParsePolicyCSV, such as a snapshot shipped with the service, while it loads the
+// rules from the database in the background, see WithWarmStart. They take precedence
+// over the file of WithWarmStart, which is still written after loads.
+func WithInitialRules(rules map[string][][]string) Option {
+	return func(m *Manager) {
+		if m.warm == nil {
+			m.warm = &warmStart{}
+		}
+		m.warm.rules = rules
+	}
+}
+
+// warmUp fills the cache with the initial rules or the rules of the warm start file. It
+// returns false if there are none, in which case the rules must be loaded before the
+// manager is used.
+func (m *Manager) warmUp(ctx context.Context) bool {
+	if m.warm == nil {
+		return false
+	}
+	rules := m.warm.rules
+	if rules == nil {
+		if m.warm.path == "" {
+			return false
+		}
+		f, err := os.Open(m.warm.path)
+		if err == nil {
+			rules, err = ParsePolicyCSV(f)
+			f.Close()
+		}
+		if err != nil {
+			if logger := m.log(ctx); logger != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("ignoring warm start file", zap.String("path", m.warm.path), zap.Error(err))
+			}
+			return false
+		}
+	}
+	var p, g Policies
+	extra := map[string]*Policies{}
+	for ptype, rs := range rules {
+		set := make(Policies, 0, len(rs))
+		for _, rule := range rs {
+			set = append(set, padRule(rule))
+		}
+		sort.Sort(set)
+		set = uniqueRules(set)
+		switch ptype {
+		case "p":
+			p = set
+		case "g":
+			g = set
+		default:
+			extra[ptype] = &set
+		}
+	}
+	m.mutex.Lock()
+	m.replaceCache(p, g, extra)
+	m.mutex.Unlock()
+	m.setReady()
+	if logger := m.log(ctx); logger != nil {
+		logger.Info("warm started, loading policies in the background",
+			zap.Int("policy_count", len(p)),
+			zap.Int("group_count", len(g)),
+		)
+	}
+	return true
+}
+
+// uniqueRules drops the duplicates of sorted rules
+func uniqueRules(p Policies) Policies {
+	res := p[:0]
+	for i, rule := range p {
+		if i == 0 || compareRules(p[i-1], rule) != 0 {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
+
+// initialLoad loads the rules in the background, after a warm start or with a startup
+// policy, trying again with backoff until it succeeds or the manager is closed
+func (m *Manager) initialLoad() {
+	backoff := minListenBackoff
+	for {
+		err := m.LoadPolicies()
+		if err == nil || m.isClosed() {
+			return
+		}
+		if m.logger != nil {
+			m.logger.Error("initial policy load failed", zap.Error(err), zap.Duration("backoff", backoff))
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+// encodeWarmStart returns the cached rules in the format of the warm start file, or
+// nil without WithWarmStart. Caller must hold m.mutex.
+func (m *Manager) encodeWarmStart() []byte {
+	if m.warm == nil || m.warm.path == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	write := func(ptype string, p Policies) {
+		for _, rule := range p {
+			w.Write(append([]string{ptype}, trimRule(rule)...))
+		}
+	}
+	write("p", m.p)
+	write("g", m.g)
+	ptypes := make([]string, 0, len(m.extra))
+	for ptype := range m.extra {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	for _, ptype := range ptypes {
+		write(ptype, *m.extra[ptype])
+	}
+	w.Flush()
+	m.warm.seq++
+	return buf.Bytes()
+}
+
+// saveWarmStart writes data returned by encodeWarmStart to the warm start file unless
+// the file already holds it or data is older than what was last written
+func (m *Manager) saveWarmStart(ctx context.Context, data []byte, seq uint64) {
+	if data == nil {
+		return
+	}
+	m.warm.mutex.Lock()
+	defer m.warm.mutex.Unlock()
+	sum := sha256.Sum256(data)
+	if seq <= m.warm.written || sum == m.warm.sum {
+		return
+	}
+	if err := writeFileAtomic(m.warm.path, data); err != nil {
+		if logger := m.log(ctx); logger != nil {
+			logger.Error("error writing warm start file", zap.String("path", m.warm.path), zap.Error(err))
+		}
+		return
+	}
+	m.warm.written, m.warm.sum = seq, sum
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers see either the
+// old or the new content
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
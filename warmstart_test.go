@@ -0,0 +1,97 @@
+package tulip
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedStorage holds loads until gate is closed
+type gatedStorage struct {
+	*MemoryStorage
+	gate chan struct{}
+}
+
+func (s *gatedStorage) Load(ctx context.Context, f func(StoredRule) error) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.gate:
+	}
+	return s.MemoryStorage.Load(ctx, f)
+}
+
+func TestWarmStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.csv")
+	s := NewMemoryStorage()
+	_, err := s.Insert(context.Background(), []StoredRule{
+		{PType: "p", Rule: []string{"teacher", "uni", "class_a", "teach"}},
+		{PType: "g", Rule: []string{"aaron", "teacher", "uni"}},
+	})
+	require.NoError(t, err)
+
+	// without a file the rules are loaded before the manager is returned
+	m, err := NewManagerWithStorage(context.Background(), s, RBACWithDomain, WithoutPeriodicSync(), WithWarmStart(path))
+	require.NoError(t, err)
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	m.Close()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "p,teacher,uni,class_a,teach\ng,aaron,teacher,uni\n", string(b))
+
+	_, err = s.Insert(context.Background(), []StoredRule{{PType: "g", Rule: []string{"bob", "teacher", "uni"}}})
+	require.NoError(t, err)
+	gated := &gatedStorage{s, make(chan struct{})}
+	m, err = NewManagerWithStorage(context.Background(), gated, RBACWithDomain, WithoutPeriodicSync(), WithWarmStart(path))
+	require.NoError(t, err)
+	defer m.Close()
+	assert.True(t, m.Enforce("aaron", "uni", "class_a", "teach"))
+	assert.False(t, m.Enforce("bob", "uni", "class_a", "teach"))
+	assert.True(t, m.Stats().LastSync.IsZero())
+
+	close(gated.gate)
+	retryUntil(t, 10*time.Millisecond, 100, func() bool {
+		return m.Enforce("bob", "uni", "class_a", "teach")
+	}, func() string { return "waiting for the initial load" })
+	retryUntil(t, 10*time.Millisecond, 100, func() bool {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b) == "p,teacher,uni,class_a,teach\ng,aaron,teacher,uni\ng,bob,teacher,uni\n"
+	}, func() string { return "waiting for the file to be written" })
+}
+
+func TestWarmStartInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.csv")
+	require.NoError(t, os.WriteFile(path, []byte("p\n"), 0600))
+	s := NewMemoryStorage()
+	_, err := s.Insert(context.Background(), []StoredRule{{PType: "p", Rule: []string{"alice", "uni", "class_a", "teach"}}})
+	require.NoError(t, err)
+	m, err := NewManagerWithStorage(context.Background(), s, RBACWithDomain, WithoutPeriodicSync(), WithWarmStart(path))
+	require.NoError(t, err)
+	defer m.Close()
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	assert.False(t, m.Stats().LastSync.IsZero())
+}
+
+func TestInitialRules(t *testing.T) {
+	gated := &gatedStorage{NewMemoryStorage(), make(chan struct{})}
+	m, err := NewManagerWithStorage(context.Background(), gated, RBACWithDomain, WithoutPeriodicSync(),
+		WithInitialRules(map[string][][]string{
+			"p": {{"alice", "uni", "class_a", "teach"}, {"alice", "uni", "class_a", "teach"}},
+		}),
+	)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.Equal(t, 1, m.PolicyCount())
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+
+	close(gated.gate)
+	retryUntil(t, 10*time.Millisecond, 100, func() bool {
+		return m.Stats().PolicyCount == 0
+	}, func() string { return "waiting for the initial load" })
+}
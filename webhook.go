@@ -0,0 +1,215 @@
+package tulip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Defaults of WebhookConfig
+const (
+	DefaultWebhookRetries    = 3
+	DefaultWebhookBackoff    = time.Second
+	DefaultWebhookBufferSize = 1024
+	DefaultWebhookBatchSize  = 100
+)
+
+// AuditEventType is the kind of an AuditEvent
+type AuditEventType string
+
+const (
+	// AuditPolicyChange reports a rule inserted or removed through the manager
+	AuditPolicyChange AuditEventType = "policy_change"
+	// AuditDecision reports the outcome of a request
+	AuditDecision AuditEventType = "decision"
+)
+
+// AuditEvent is an event sent to webhooks. Fields that don't apply to its type are
+// omitted.
+type AuditEvent struct {
+	Type    AuditEventType `json:"type"`
+	Time    time.Time      `json:"time"`
+	Op      EventOp        `json:"op,omitempty"`
+	PType   string         `json:"p_type,omitempty"`
+	Rule    []string       `json:"rule,omitempty"`
+	Request []string       `json:"request,omitempty"`
+	Allowed *bool          `json:"allowed,omitempty"`
+}
+
+// WebhookConfig configures WithWebhook
+type WebhookConfig struct {
+	// URLs receive every event
+	URLs []string
+	// Header is added to every request, e.g. to authenticate
+	Header http.Header
+	// Client sends the requests, defaults to a client with a timeout of DefaultTimeout
+	Client *http.Client
+	// DecisionSampleRate is the fraction of decisions sent, from 0 for none to 1 for all
+	DecisionSampleRate float64
+	// Retries is the number of times a failed delivery is retried, defaults to
+	// DefaultWebhookRetries
+	Retries int
+	// Backoff is the delay before the first retry, doubled on each retry. Defaults to
+	// DefaultWebhookBackoff.
+	Backoff time.Duration
+	// BufferSize is the number of events that can wait for delivery, further events
+	// are dropped. Defaults to DefaultWebhookBufferSize.
+	BufferSize int
+	// BatchSize is the maximum number of events sent in one request, defaults to
+	// DefaultWebhookBatchSize
+	BatchSize int
+}
+
+// WithWebhook makes the manager POST audit events to webhooks, e.g. to feed a SIEM
+// without giving it access to the database. Events are sent asynchronously as JSON
+// arrays of AuditEvent. Only changes made through this manager are sent, so that
+// every change is reported once however many managers share the table. Events that
+// can't be delivered after the retries, or are still queued on Close, are dropped
+// and logged.
+func WithWebhook(cfg WebhookConfig) Option {
+	return func(m *Manager) {
+		if cfg.Client == nil {
+			cfg.Client = &http.Client{Timeout: DefaultTimeout}
+		}
+		if cfg.Retries == 0 {
+			cfg.Retries = DefaultWebhookRetries
+		}
+		if cfg.Backoff <= 0 {
+			cfg.Backoff = DefaultWebhookBackoff
+		}
+		if cfg.BufferSize <= 0 {
+			cfg.BufferSize = DefaultWebhookBufferSize
+		}
+		if cfg.BatchSize <= 0 {
+			cfg.BatchSize = DefaultWebhookBatchSize
+		}
+		m.webhook = &webhook{cfg: cfg, queue: make(chan AuditEvent, cfg.BufferSize)}
+	}
+}
+
+type webhook struct {
+	cfg   WebhookConfig
+	queue chan AuditEvent
+}
+
+// audit queues ev for the webhooks without blocking
+func (m *Manager) audit(ev AuditEvent) {
+	if m.webhook == nil {
+		return
+	}
+	ev.Time = time.Now()
+	select {
+	case m.webhook.queue <- ev:
+	default:
+		if m.logger != nil {
+			m.logger.Warn("dropped audit event, webhook queue is full", zap.String("type", string(ev.Type)))
+		}
+	}
+}
+
+// auditDecision queues the decision on request if it is sampled
+func (m *Manager) auditDecision(request []string, allowed bool) {
+	if m.webhook == nil || m.webhook.cfg.DecisionSampleRate <= 0 {
+		return
+	}
+	if rate := m.webhook.cfg.DecisionSampleRate; rate < 1 && rand.Float64() >= rate {
+		return
+	}
+	m.audit(AuditEvent{Type: AuditDecision, Request: request, Allowed: &allowed})
+}
+
+// startWebhook starts delivering audit events until the manager is closed
+func (m *Manager) startWebhook() {
+	if m.webhook != nil {
+		m.goBackground(m.dispatchAuditEvents)
+	}
+}
+
+func (m *Manager) dispatchAuditEvents() {
+	for {
+		var batch []AuditEvent
+		select {
+		case <-m.done:
+			return
+		case ev := <-m.webhook.queue:
+			batch = append(batch, ev)
+		}
+	collect:
+		for len(batch) < m.webhook.cfg.BatchSize {
+			select {
+			case ev := <-m.webhook.queue:
+				batch = append(batch, ev)
+			default:
+				break collect
+			}
+		}
+		body, err := json.Marshal(batch)
+		if err != nil {
+			if m.logger != nil {
+				m.logger.Error("error marshaling audit events", zap.Error(err))
+			}
+			continue
+		}
+		for _, url := range m.webhook.cfg.URLs {
+			if err := m.deliver(url, body); err != nil {
+				if m.isClosed() {
+					return
+				}
+				if m.logger != nil {
+					m.logger.Error("dropped audit events, webhook delivery failed",
+						zap.String("url", url),
+						zap.Int("count", len(batch)),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+	}
+}
+
+// deliver posts body to url, retrying with exponential backoff
+func (m *Manager) deliver(url string, body []byte) error {
+	backoff := m.webhook.cfg.Backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = m.post(url, body); err == nil {
+			return nil
+		}
+		if attempt >= m.webhook.cfg.Retries {
+			return err
+		}
+		select {
+		case <-m.done:
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (m *Manager) post(url string, body []byte) error {
+	ctx, cancel := m.closingContext(m.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range m.webhook.cfg.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.webhook.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package tulip
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	var mutex sync.Mutex
+	var events []AuditEvent
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		if requests == 1 {
+			// the first delivery is retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		var batch []AuditEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		events = append(events, batch...)
+	}))
+	defer srv.Close()
+
+	m := newManager(RBACWithDomain, []Option{WithWebhook(WebhookConfig{
+		URLs:               []string{srv.URL},
+		Header:             http.Header{"X-Token": {"secret"}},
+		DecisionSampleRate: 1,
+		Backoff:            time.Millisecond,
+	})})
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"bob", "uni", "class_a", "teach"}, SourceRemote)
+	assert.True(t, m.Enforce("alice", "uni", "class_a", "teach"))
+	m.startWebhook()
+
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(events)
+	}
+	retryUntil(t, 10*time.Millisecond, 100, func() bool { return count() == 2 }, func() string { return "events not delivered" })
+	require.NoError(t, m.Close())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, AuditPolicyChange, events[0].Type)
+	assert.Equal(t, EventInsert, events[0].Op)
+	assert.Equal(t, "p", events[0].PType)
+	assert.Equal(t, []string{"alice", "uni", "class_a", "teach"}, events[0].Rule)
+	assert.Equal(t, AuditDecision, events[1].Type)
+	assert.Equal(t, []string{"alice", "uni", "class_a", "teach"}, events[1].Request)
+	require.NotNil(t, events[1].Allowed)
+	assert.True(t, *events[1].Allowed)
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	m := newManager(RBACWithDomain, []Option{WithWebhook(WebhookConfig{BufferSize: 1})})
+	m.cacheInsert("p", []string{"alice", "uni", "class_a", "teach"}, SourceLocal)
+	m.cacheInsert("p", []string{"bob", "uni", "class_a", "teach"}, SourceLocal)
+	assert.Len(t, m.webhook.queue, 1)
+	// decisions aren't sampled by default
+	m.Enforce("alice", "uni", "class_a", "teach")
+	ev := <-m.webhook.queue
+	assert.Equal(t, []string{"alice", "uni", "class_a", "teach"}, ev.Rule)
+	assert.Len(t, m.webhook.queue, 0)
+}